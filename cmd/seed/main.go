@@ -0,0 +1,120 @@
+// Command seed loads SRD spell data into the database. It reads
+// dnd5eapi-style JSON files from a directory:
+//
+//	classes.json      [{"index", "name", "url"}]
+//	subclasses.json   [{"index", "name", "url"}]
+//	spells.json       [spell objects with "classes" and "subclasses" references]
+//	spell-slots.json  [{"caster_type", "caster_level", "slots"}]
+//
+// Missing files are skipped. Everything is upserted in one transaction, so a
+// failed run changes nothing, and running it again is a no-op.
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"log"
+	"os"
+	"path/filepath"
+	"github.com/joho/godotenv"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+func main() {
+	dir := flag.String("dir", "data", "directory containing the SRD JSON files")
+	dryRun := flag.Bool("dry-run", false, "report what would change without committing it")
+	flag.Parse()
+
+	godotenv.Load()
+	db, err := sql.Open("postgres", os.Getenv("POSTGRES_DBURL"))
+	if err != nil {
+		log.Fatal(err)
+	}
+	defer db.Close()
+
+	report, err := seed(context.Background(), db, *dir, *dryRun)
+	if err != nil {
+		log.Fatalf("seeding: %v", err)
+	}
+
+	if *dryRun {
+		fmt.Println("Dry run, nothing was committed:")
+	}
+	fmt.Printf("classes:     %s\n", report.Classes)
+	fmt.Printf("subclasses:  %s\n", report.Subclasses)
+	fmt.Printf("spells:      %s\n", report.Spells)
+	fmt.Printf("spell slots: %s\n", report.SpellSlots)
+}
+
+func seed(ctx context.Context, db *sql.DB, dir string, dryRun bool) (report, error) {
+	var classes, subclasses []srdReference
+	var spells []srdSpell
+	var slots []srdSpellSlots
+	for name, v := range map[string]interface{}{
+		"classes.json":		&classes,
+		"subclasses.json":	&subclasses,
+		"spells.json":		&spells,
+		"spell-slots.json":	&slots,
+	} {
+		if err := readJSON(filepath.Join(dir, name), v); err != nil {
+			return report{}, err
+		}
+	}
+
+	tx, err := db.BeginTx(ctx, nil)
+	if err != nil {
+		return report{}, err
+	}
+	defer tx.Rollback()
+
+	s := newSeeder(database.New(db).WithTx(tx))
+
+	// Classes and subclasses go first so spells can link to them.
+	for _, class := range classes {
+		if err := s.upsertClass(ctx, class); err != nil {
+			return report{}, fmt.Errorf("class %s: %w", class.Index, err)
+		}
+	}
+	for _, subclass := range subclasses {
+		if err := s.upsertSubclass(ctx, subclass); err != nil {
+			return report{}, fmt.Errorf("subclass %s: %w", subclass.Index, err)
+		}
+	}
+	for _, spell := range spells {
+		if err := s.upsertSpell(ctx, spell); err != nil {
+			return report{}, fmt.Errorf("spell %s: %w", spell.Index, err)
+		}
+	}
+	for _, row := range slots {
+		if err := s.upsertSpellSlots(ctx, row); err != nil {
+			return report{}, fmt.Errorf("spell slots %s %d: %w", row.CasterType, row.CasterLevel, err)
+		}
+	}
+
+	if dryRun {
+		return s.report, nil
+	}
+	return s.report, tx.Commit()
+}
+
+// readJSON decodes the file at path into v. A missing file leaves v as it
+// is.
+func readJSON(path string, v interface{}) error {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		log.Printf("%s not found, skipping", path)
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if err := json.Unmarshal(data, v); err != nil {
+		return fmt.Errorf("%s: %w", path, err)
+	}
+	return nil
+}
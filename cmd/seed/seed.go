@@ -0,0 +1,422 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"reflect"
+	"slices"
+	"github.com/kblasti/spellbook/internal/database"
+	"github.com/sqlc-dev/pqtype"
+)
+
+// srdReference is how SRD files refer to another resource.
+type srdReference struct {
+	Index	string	`json:"index"`
+	Name	string	`json:"name"`
+	URL		string	`json:"url"`
+}
+
+type srdSpell struct {
+	Index			string				`json:"index"`
+	Name			string				`json:"name"`
+	Desc			[]string			`json:"desc"`
+	HigherLevel		[]string			`json:"higher_level"`
+	Range			string				`json:"range"`
+	Components		[]string			`json:"components"`
+	Material		string				`json:"material"`
+	Ritual			bool				`json:"ritual"`
+	Duration		string				`json:"duration"`
+	Concentration	bool				`json:"concentration"`
+	CastingTime		string				`json:"casting_time"`
+	Level			int32				`json:"level"`
+	AttackType		string				`json:"attack_type"`
+	Damage			json.RawMessage		`json:"damage"`
+	School			json.RawMessage		`json:"school"`
+	Classes			[]srdReference		`json:"classes"`
+	Subclasses		[]srdReference		`json:"subclasses"`
+}
+
+// srdSpellSlots is one row of a slot table: the slots available to a caster
+// type at one caster level.
+type srdSpellSlots struct {
+	CasterType	string				`json:"caster_type"`
+	CasterLevel	int32				`json:"caster_level"`
+	Slots		json.RawMessage		`json:"slots"`
+}
+
+// counts tallies what seeding did with one kind of resource.
+type counts struct {
+	Created		int
+	Updated		int
+	Unchanged	int
+}
+
+func (c counts) String() string {
+	return fmt.Sprintf("%d created, %d updated, %d unchanged", c.Created, c.Updated, c.Unchanged)
+}
+
+type report struct {
+	Classes		counts
+	Subclasses	counts
+	Spells		counts
+	SpellSlots	counts
+}
+
+// seeder upserts SRD data. Every method is idempotent: running it again
+// with the same input leaves the database as it is and counts everything as
+// unchanged.
+type seeder struct {
+	q			*database.Queries
+	report		report
+	classes		map[string]int32
+	subclasses	map[string]int32
+}
+
+func newSeeder(q *database.Queries) *seeder {
+	return &seeder{
+		q:			q,
+		classes:	map[string]int32{},
+		subclasses:	map[string]int32{},
+	}
+}
+
+func (s *seeder) upsertClass(ctx context.Context, class srdReference) error {
+	url := sql.NullString{String: class.URL, Valid: class.URL != ""}
+
+	existing, err := s.q.GetClassByIndex(ctx, class.Index)
+	if err == sql.ErrNoRows {
+		created, err := s.q.AddClass(ctx, database.AddClassParams{
+			Index:	class.Index,
+			Name:	class.Name,
+			Url:	url,
+		})
+		if err != nil {
+			return err
+		}
+		s.classes[class.Index] = created.ID
+		s.report.Classes.Created++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.classes[class.Index] = existing.ID
+	if existing.Name == class.Name && existing.Url == url {
+		s.report.Classes.Unchanged++
+		return nil
+	}
+
+	err = s.q.UpdateClass(ctx, database.UpdateClassParams{
+		ID:		existing.ID,
+		Name:	class.Name,
+		Url:	url,
+	})
+	if err != nil {
+		return err
+	}
+	s.report.Classes.Updated++
+	return nil
+}
+
+func (s *seeder) upsertSubclass(ctx context.Context, subclass srdReference) error {
+	url := sql.NullString{String: subclass.URL, Valid: subclass.URL != ""}
+
+	existing, err := s.q.GetSubclassByIndex(ctx, subclass.Index)
+	if err == sql.ErrNoRows {
+		created, err := s.q.AddSubclass(ctx, database.AddSubclassParams{
+			Index:	subclass.Index,
+			Name:	subclass.Name,
+			Url:	url,
+		})
+		if err != nil {
+			return err
+		}
+		s.subclasses[subclass.Index] = created.ID
+		s.report.Subclasses.Created++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	s.subclasses[subclass.Index] = existing.ID
+	if existing.Name == subclass.Name && existing.Url == url {
+		s.report.Subclasses.Unchanged++
+		return nil
+	}
+
+	err = s.q.UpdateSubclass(ctx, database.UpdateSubclassParams{
+		ID:		existing.ID,
+		Name:	subclass.Name,
+		Url:	url,
+	})
+	if err != nil {
+		return err
+	}
+	s.report.Subclasses.Updated++
+	return nil
+}
+
+func (s *seeder) classID(ctx context.Context, index string) (int32, error) {
+	if id, ok := s.classes[index]; ok {
+		return id, nil
+	}
+	class, err := s.q.GetClassByIndex(ctx, index)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("unknown class %q", index)
+	}
+	if err != nil {
+		return 0, err
+	}
+	s.classes[index] = class.ID
+	return class.ID, nil
+}
+
+func (s *seeder) subclassID(ctx context.Context, index string) (int32, error) {
+	if id, ok := s.subclasses[index]; ok {
+		return id, nil
+	}
+	subclass, err := s.q.GetSubclassByIndex(ctx, index)
+	if err == sql.ErrNoRows {
+		return 0, fmt.Errorf("unknown subclass %q", index)
+	}
+	if err != nil {
+		return 0, err
+	}
+	s.subclasses[index] = subclass.ID
+	return subclass.ID, nil
+}
+
+// upsertSpell creates or updates a spell along with its class and subclass
+// lists. Every change is recorded as an import revision in the spell's
+// history.
+func (s *seeder) upsertSpell(ctx context.Context, spell srdSpell) error {
+	params := spellUpdateParams(spell)
+
+	existing, err := s.q.GetSpell(ctx, spell.Index)
+	if err == sql.ErrNoRows {
+		created, err := s.q.CreateSpell(ctx, database.CreateSpellParams{
+			Index:			params.Index,
+			Name:			params.Name,
+			Range:			params.Range,
+			Material:		params.Material,
+			Ritual:			params.Ritual,
+			Duration:		params.Duration,
+			Concentration:	params.Concentration,
+			CastingTime:	params.CastingTime,
+			Level:			params.Level,
+			AttackType:		params.AttackType,
+			School:			params.School,
+			Desc:			params.Desc,
+			HigherLevel:	params.HigherLevel,
+			Components:		params.Components,
+			Damage:			params.Damage,
+			Url:			"/api/spells/" + spell.Index,
+		})
+		if err != nil {
+			return err
+		}
+		if err := s.linkSpell(ctx, created.ID, spell); err != nil {
+			return err
+		}
+		if err := s.q.CreateImportRevision(ctx, spell.Index); err != nil {
+			return err
+		}
+		s.report.Spells.Created++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	spellID, err := s.q.GetSpellID(ctx, spell.Index)
+	if err != nil {
+		return err
+	}
+	classes, err := s.q.GetSpellClassIndexes(ctx, spellID)
+	if err != nil {
+		return err
+	}
+	subclasses, err := s.q.GetSpellSubclassIndexes(ctx, spellID)
+	if err != nil {
+		return err
+	}
+
+	textChanged := !spellMatches(existing, params)
+	linksChanged := !sameIndexes(classes, spell.Classes) || !sameIndexes(subclasses, spell.Subclasses)
+	if !textChanged && !linksChanged {
+		s.report.Spells.Unchanged++
+		return nil
+	}
+
+	if textChanged {
+		if _, err := s.q.UpdateSpell(ctx, params); err != nil {
+			return err
+		}
+		if err := s.q.CreateImportRevision(ctx, spell.Index); err != nil {
+			return err
+		}
+	}
+	if linksChanged {
+		if err := s.q.DeleteSpellClasses(ctx, spellID); err != nil {
+			return err
+		}
+		if err := s.q.DeleteSpellSubclasses(ctx, spellID); err != nil {
+			return err
+		}
+		if err := s.linkSpell(ctx, spellID, spell); err != nil {
+			return err
+		}
+	}
+	s.report.Spells.Updated++
+	return nil
+}
+
+func (s *seeder) linkSpell(ctx context.Context, spellID int32, spell srdSpell) error {
+	for _, class := range spell.Classes {
+		classID, err := s.classID(ctx, class.Index)
+		if err != nil {
+			return fmt.Errorf("spell %s: %w", spell.Index, err)
+		}
+		_, err = s.q.AddSpellClass(ctx, database.AddSpellClassParams{
+			SpellID:	spellID,
+			ClassID:	classID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	for _, subclass := range spell.Subclasses {
+		subclassID, err := s.subclassID(ctx, subclass.Index)
+		if err != nil {
+			return fmt.Errorf("spell %s: %w", spell.Index, err)
+		}
+		_, err = s.q.AddSpellSubclass(ctx, database.AddSpellSubclassParams{
+			SpellID:	spellID,
+			SubclassID:	subclassID,
+		})
+		if err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func (s *seeder) upsertSpellSlots(ctx context.Context, row srdSpellSlots) error {
+	existing, err := s.q.GetSpellSlotsMax(ctx, database.GetSpellSlotsMaxParams{
+		CasterType:		row.CasterType,
+		CasterLevel:	row.CasterLevel,
+	})
+	if err == sql.ErrNoRows {
+		_, err := s.q.AddSpellSlots(ctx, database.AddSpellSlotsParams{
+			CasterType:		row.CasterType,
+			CasterLevel:	row.CasterLevel,
+			Slots:			row.Slots,
+		})
+		if err != nil {
+			return err
+		}
+		s.report.SpellSlots.Created++
+		return nil
+	}
+	if err != nil {
+		return err
+	}
+
+	if jsonEqual(existing, row.Slots) {
+		s.report.SpellSlots.Unchanged++
+		return nil
+	}
+
+	err = s.q.UpdateSpellSlots(ctx, database.UpdateSpellSlotsParams{
+		CasterType:		row.CasterType,
+		CasterLevel:	row.CasterLevel,
+		Slots:			row.Slots,
+	})
+	if err != nil {
+		return err
+	}
+	s.report.SpellSlots.Updated++
+	return nil
+}
+
+// spellUpdateParams converts an SRD spell into the columns stored for it,
+// the same way the API stores spells created over HTTP.
+func spellUpdateParams(spell srdSpell) database.UpdateSpellParams {
+	return database.UpdateSpellParams{
+		Name:			spell.Name,
+		Range:			sql.NullString{String: spell.Range, Valid: true},
+		Material:		sql.NullString{String: spell.Material, Valid: true},
+		Ritual:			sql.NullBool{Bool: spell.Ritual, Valid: true},
+		Duration:		sql.NullString{String: spell.Duration, Valid: true},
+		Concentration:	sql.NullBool{Bool: spell.Concentration, Valid: true},
+		CastingTime:	sql.NullString{String: spell.CastingTime, Valid: true},
+		Level:			sql.NullInt32{Int32: spell.Level, Valid: true},
+		AttackType:		sql.NullString{String: spell.AttackType, Valid: true},
+		School:			pqtype.NullRawMessage{RawMessage: spell.School, Valid: len(spell.School) > 0},
+		Desc:			spell.Desc,
+		HigherLevel:	spell.HigherLevel,
+		Components:		spell.Components,
+		Damage:			pqtype.NullRawMessage{RawMessage: spell.Damage, Valid: len(spell.Damage) > 0},
+		Index:			spell.Index,
+	}
+}
+
+// spellMatches reports whether the stored spell already has the text in
+// params. JSON columns are compared by value since Postgres doesn't keep
+// their formatting.
+func spellMatches(existing database.GetSpellRow, params database.UpdateSpellParams) bool {
+	return existing.Name == params.Name &&
+		existing.Range == params.Range &&
+		existing.Material == params.Material &&
+		existing.Ritual == params.Ritual &&
+		existing.Duration == params.Duration &&
+		existing.Concentration == params.Concentration &&
+		existing.CastingTime == params.CastingTime &&
+		existing.Level == params.Level &&
+		existing.AttackType == params.AttackType &&
+		slices.Equal(existing.Desc, params.Desc) &&
+		slices.Equal(existing.HigherLevel, params.HigherLevel) &&
+		slices.Equal(existing.Components, params.Components) &&
+		jsonEqual(nullJSON(existing.School), nullJSON(params.School)) &&
+		jsonEqual(nullJSON(existing.Damage), nullJSON(params.Damage))
+}
+
+func nullJSON(value pqtype.NullRawMessage) json.RawMessage {
+	if !value.Valid || len(value.RawMessage) == 0 {
+		return json.RawMessage("null")
+	}
+	return value.RawMessage
+}
+
+func jsonEqual(a, b json.RawMessage) bool {
+	var x, y interface{}
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+// referenceIndexes returns the indexes of refs in byte order.
+func referenceIndexes(refs []srdReference) []string {
+	indexes := []string{}
+	for _, ref := range refs {
+		indexes = append(indexes, ref.Index)
+	}
+	slices.Sort(indexes)
+	return indexes
+}
+
+// sameIndexes reports whether the stored indexes and refs name the same
+// resources. Both sides are sorted here because the database's ORDER BY
+// follows its collation, which can disagree with Go's byte order.
+func sameIndexes(stored []string, refs []srdReference) bool {
+	stored = slices.Clone(stored)
+	slices.Sort(stored)
+	return slices.Equal(stored, referenceIndexes(refs))
+}
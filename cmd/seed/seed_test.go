@@ -0,0 +1,142 @@
+package main
+
+import (
+	"database/sql"
+	"encoding/json"
+	"os"
+	"path/filepath"
+	"slices"
+	"testing"
+	"github.com/kblasti/spellbook/internal/database"
+	"github.com/sqlc-dev/pqtype"
+)
+
+func testSpell() srdSpell {
+	return srdSpell{
+		Index:			"fire-bolt",
+		Name:			"Fire Bolt",
+		Desc:			[]string{"You hurl a mote of fire."},
+		Range:			"120 feet",
+		Components:		[]string{"V", "S"},
+		Duration:		"Instantaneous",
+		CastingTime:	"1 action",
+		Level:			0,
+		AttackType:		"ranged",
+		School:			json.RawMessage(`{"index": "evocation", "name": "Evocation"}`),
+		Damage:			json.RawMessage(`{"damage_type": {"index": "fire"}}`),
+	}
+}
+
+// storedSpell is what reading testSpell back from the database returns.
+func storedSpell() database.GetSpellRow {
+	return database.GetSpellRow{
+		Index:			"fire-bolt",
+		Name:			"Fire Bolt",
+		Range:			sql.NullString{String: "120 feet", Valid: true},
+		Material:		sql.NullString{String: "", Valid: true},
+		Ritual:			sql.NullBool{Bool: false, Valid: true},
+		Duration:		sql.NullString{String: "Instantaneous", Valid: true},
+		Concentration:	sql.NullBool{Bool: false, Valid: true},
+		CastingTime:	sql.NullString{String: "1 action", Valid: true},
+		Level:			sql.NullInt32{Int32: 0, Valid: true},
+		AttackType:		sql.NullString{String: "ranged", Valid: true},
+		// Postgres reformats JSONB and reorders its keys.
+		School:			pqtype.NullRawMessage{RawMessage: json.RawMessage(`{"name":"Evocation","index":"evocation"}`), Valid: true},
+		Desc:			[]string{"You hurl a mote of fire."},
+		Components:		[]string{"V", "S"},
+		Damage:			pqtype.NullRawMessage{RawMessage: json.RawMessage(`{"damage_type":{"index":"fire"}}`), Valid: true},
+	}
+}
+
+func TestSpellMatches(t *testing.T) {
+	if !spellMatches(storedSpell(), spellUpdateParams(testSpell())) {
+		t.Error("spellMatches reported a change for identical spells")
+	}
+
+	tests := []struct {
+		name	string
+		modify	func(*srdSpell)
+	}{
+		{"name", func(s *srdSpell) { s.Name = "Firebolt" }},
+		{"level", func(s *srdSpell) { s.Level = 1 }},
+		{"desc", func(s *srdSpell) { s.Desc = append(s.Desc, "It ignites objects.") }},
+		{"components", func(s *srdSpell) { s.Components = []string{"V"} }},
+		{"school", func(s *srdSpell) { s.School = json.RawMessage(`{"index": "conjuration"}`) }},
+		{"damage removed", func(s *srdSpell) { s.Damage = nil }},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spell := testSpell()
+			tt.modify(&spell)
+			if spellMatches(storedSpell(), spellUpdateParams(spell)) {
+				t.Errorf("spellMatches missed a change to %s", tt.name)
+			}
+		})
+	}
+}
+
+func TestReferenceIndexesSorted(t *testing.T) {
+	got := referenceIndexes([]srdReference{{Index: "wizard"}, {Index: "bard"}, {Index: "sorcerer"}})
+	want := []string{"bard", "sorcerer", "wizard"}
+	if !slices.Equal(got, want) {
+		t.Errorf("referenceIndexes() = %v, want %v", got, want)
+	}
+}
+
+func TestSameIndexes(t *testing.T) {
+	refs := []srdReference{{Index: "oath-of-the-ancients"}, {Index: "oath-ofthe-crown"}}
+
+	tests := []struct {
+		name	string
+		stored	[]string
+		want	bool
+	}{
+		{"byte order", []string{"oath-of-the-ancients", "oath-ofthe-crown"}, true},
+		// A collation that ignores hyphens sorts these the other way round.
+		{"collation order", []string{"oath-ofthe-crown", "oath-of-the-ancients"}, true},
+		{"missing link", []string{"oath-of-the-ancients"}, false},
+		{"extra link", []string{"oath-of-the-ancients", "oath-ofthe-crown", "oath-of-vengeance"}, false},
+		{"different link", []string{"oath-of-the-ancients", "oath-of-vengeance"}, false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			stored := slices.Clone(tt.stored)
+			if got := sameIndexes(stored, refs); got != tt.want {
+				t.Errorf("sameIndexes(%v) = %v, want %v", tt.stored, got, tt.want)
+			}
+			if !slices.Equal(stored, tt.stored) {
+				t.Errorf("sameIndexes reordered its input to %v", stored)
+			}
+		})
+	}
+
+	if !sameIndexes([]string{}, nil) {
+		t.Error("sameIndexes() = false for a spell with no links")
+	}
+}
+
+func TestReadJSON(t *testing.T) {
+	dir := t.TempDir()
+
+	var missing []srdReference
+	if err := readJSON(filepath.Join(dir, "classes.json"), &missing); err != nil || missing != nil {
+		t.Errorf("readJSON of a missing file = %v, %v; want nil, nil", missing, err)
+	}
+
+	path := filepath.Join(dir, "spell-slots.json")
+	os.WriteFile(path, []byte(`[{"caster_type": "full", "caster_level": 1, "slots": {"1": 2}}]`), 0o644)
+	var slots []srdSpellSlots
+	if err := readJSON(path, &slots); err != nil {
+		t.Fatal(err)
+	}
+	if len(slots) != 1 || slots[0].CasterType != "full" || slots[0].CasterLevel != 1 {
+		t.Errorf("readJSON() = %+v", slots)
+	}
+
+	os.WriteFile(path, []byte(`{"not": "a list"}`), 0o644)
+	if err := readJSON(path, &slots); err == nil {
+		t.Error("readJSON accepted a file of the wrong shape")
+	}
+}
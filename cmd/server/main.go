@@ -6,21 +6,41 @@ import (
   "github.com/joho/godotenv"
   "github.com/kblasti/spellbook/internal/database"
   "github.com/kblasti/spellbook/internal/api"
+  "github.com/kblasti/spellbook/internal/auth"
+  "github.com/kblasti/spellbook/internal/mail"
+  "github.com/kblasti/spellbook/internal/oidc"
+  "github.com/kblasti/spellbook/internal/ratelimit"
+  "context"
   "database/sql"
   "log"
-  "golang.org/x/time/rate"
+  "time"
 )
 
-var globalLimiter = rate.NewLimiter(rate.Limit(1), 3)
+// rateLimitPolicy reads a rate limit policy such as "120/m" from env.
+func rateLimitPolicy(env, fallback string) ratelimit.Policy {
+	value := os.Getenv(env)
+	if value == "" {
+		value = fallback
+	}
+	policy, err := ratelimit.ParsePolicy(value)
+	if err != nil {
+		log.Fatalf("%s: %v", env, err)
+	}
+	return policy
+}
+
+// minSecretLength is the shortest SECRET accepted, in bytes. It signs MFA
+// challenges and email links, and access tokens unless JWT_KEYS_DIR is set.
+const minSecretLength = 32
 
-func limitMiddleware(next http.Handler) http.Handler {
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-		if !globalLimiter.Allow() {
-			http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
-			return
-		}
-		next.ServeHTTP(w, r)
-	})
+// secretFromEnv reads SECRET, refusing to start with one that is missing or
+// short enough to guess.
+func secretFromEnv() string {
+	secret := os.Getenv("SECRET")
+	if len(secret) < minSecretLength {
+		log.Fatalf("SECRET must be set to at least %d bytes", minSecretLength)
+	}
+	return secret
 }
 
 func main() {
@@ -30,17 +50,79 @@ func main() {
   if err != nil {
       log.Fatal(err)
   }
+  if len(os.Args) > 1 && os.Args[1] == "migrate" {
+    runMigrate(db, os.Args[2:])
+    return
+  }
+  if os.Getenv("MIGRATE_ON_START") == "true" {
+    migrateOnStart(db)
+  }
   dbQueries := database.New(db)
+  var mailer mail.Mailer = mail.NewLogMailer(os.Stdout)
+  if smtpHost := os.Getenv("SMTP_HOST"); smtpHost != "" {
+    mailer = mail.NewSMTPMailer(
+      smtpHost,
+      os.Getenv("SMTP_PORT"),
+      os.Getenv("SMTP_USERNAME"),
+      os.Getenv("SMTP_PASSWORD"),
+      os.Getenv("MAIL_FROM"),
+    )
+  }
+  secret := secretFromEnv()
+  keys := auth.NewHMACKeySet(secret)
+  if keysDir := os.Getenv("JWT_KEYS_DIR"); keysDir != "" {
+    keys, err = auth.LoadKeySet(keysDir, os.Getenv("JWT_SIGNING_KEY_ID"))
+    if err != nil {
+      log.Fatalf("loading JWT keys: %v", err)
+    }
+  }
   cfg := &api.APIConfig{
     DB:         dbQueries,
+    Conn:       db,
     Platform:   os.Getenv("PLATFORM"),
-    Secret:     os.Getenv("SECRET"),
+    Secret:     secret,
+    Keys:       keys,
+    TrustProxyHeaders: os.Getenv("TRUST_PROXY") == "true",
+    Mailer:     mailer,
+    AppURL:     os.Getenv("APP_URL"),
+    RequireVerifiedEmail: os.Getenv("REQUIRE_VERIFIED_EMAIL") == "true",
+  }
+  if issuer := os.Getenv("OIDC_ISSUER"); issuer != "" {
+    ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+    provider, err := oidc.Discover(ctx, oidc.Config{
+      Issuer:       issuer,
+      ClientID:     os.Getenv("OIDC_CLIENT_ID"),
+      ClientSecret: os.Getenv("OIDC_CLIENT_SECRET"),
+      RedirectURL:  os.Getenv("OIDC_REDIRECT_URL"),
+    }, nil)
+    cancel()
+    if err != nil {
+      log.Fatalf("discovering OIDC provider: %v", err)
+    }
+    cfg.OIDC = provider
   }
   port := os.Getenv("PORT")
   filepathRoot:= "/app/"
   mux := http.NewServeMux()
+  // account wraps routes that manage the account itself, which API keys
+  // can't reach.
+  account := func(h http.HandlerFunc) http.Handler {
+    return cfg.AuthMiddleware(cfg.RequireScope(auth.ScopeAccount)(h))
+  }
+  // authLimit applies the stricter rate limit for unauthenticated account
+  // endpoints on top of the default one.
+  authLimit := cfg.RateLimit(ratelimit.New(rateLimitPolicy("RATE_LIMIT_AUTH", "10/m")))
+  // admin wraps user administration routes.
+  admin := func(h http.HandlerFunc) http.Handler {
+    return cfg.AuthMiddleware(cfg.RequireScope(auth.ScopeAccount)(cfg.RequirePermission(auth.PermissionUsersManage)(h)))
+  }
+  // spellEditor wraps routes that change the spell compendium.
+  spellEditor := func(h http.HandlerFunc) http.Handler {
+    return cfg.AuthMiddleware(cfg.RequireScope(auth.ScopeSpellsWrite)(cfg.RequirePermission(auth.PermissionSpellsEdit)(h)))
+  }
   mux.Handle(filepathRoot, http.StripPrefix("/app", http.FileServer(http.Dir("."))))
 
+  mux.HandleFunc("GET /.well-known/jwks.json", cfg.HandlerJWKS)
   mux.HandleFunc("GET /api/healthz", func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Content-Type", "text/plain; charset=utf-8")
         w.WriteHeader(http.StatusOK)
@@ -51,34 +133,67 @@ func main() {
       w.WriteHeader(http.StatusOK)
       w.Write([]byte("Welcome to the api homepage!\nThis work includes material from the System Reference Document 5.2.1 (“SRD 5.2.1”) by Wizards of the\nCoast LLC, available at https://www.dndbeyond.com/srd. The SRD 5.2.1 is licensed under the Creative\nCommons Attribution 4.0 International License, available at https://creativecommons.org/licenses/by/4.0/\nlegalcode.\n"))
   })
-  mux.Handle( 
-    "POST /api/spells/update/{index}", 
-    cfg.AuthMiddleware( 
-      cfg.AdminOnly( 
-        http.HandlerFunc(cfg.HandlerUpdateSpell), 
-      ), 
-    ), 
-  )
-  mux.Handle(
-    "POST /api/admin/users",
-    cfg.AuthMiddleware(
-      cfg.AdminOnly(
-        http.HandlerFunc(cfg.HandlerCreateAdminUser),
-      ),
-    ),
-  )
+  mux.Handle("POST /api/spells", spellEditor(cfg.HandlerCreateSpell))
+  mux.Handle("POST /api/spells/update/{index}", spellEditor(cfg.HandlerUpdateSpell))
+  mux.Handle("PATCH /api/spells/{index}", spellEditor(cfg.HandlerPatchSpell))
+  mux.Handle("DELETE /api/spells/{index}", spellEditor(cfg.HandlerDeleteSpell))
+  // GET /api/spells/{index}/history would conflict with
+  // /api/spells/levels/{level}, which is more specific than a wildcard in
+  // the last segment, so the history list is matched that way instead.
+  spellHistory := spellEditor(cfg.HandlerGetSpellHistory)
+  mux.HandleFunc("GET /api/spells/{index}/{resource}", func(w http.ResponseWriter, r *http.Request) {
+    if r.PathValue("resource") != "history" {
+      http.NotFound(w, r)
+      return
+    }
+    spellHistory.ServeHTTP(w, r)
+  })
+  mux.Handle("GET /api/spells/{index}/history/diff", spellEditor(cfg.HandlerDiffSpellRevisions))
+  mux.Handle("GET /api/spells/{index}/history/{revision}", spellEditor(cfg.HandlerGetSpellRevision))
+  mux.Handle("POST /api/spells/{index}/history/{revision}/revert", spellEditor(cfg.HandlerRevertSpell))
+  mux.Handle("POST /api/admin/users", admin(cfg.HandlerCreateAdminUser))
+  mux.Handle("GET /api/admin/users", admin(cfg.HandlerAdminGetUsers))
+  mux.Handle("GET /api/admin/users/{id}", admin(cfg.HandlerAdminGetUser))
+  mux.Handle("GET /api/admin/users/{id}/characters", admin(cfg.HandlerAdminGetUserCharacters))
+  mux.Handle("POST /api/admin/users/{id}/disable", admin(cfg.HandlerDisableUser))
+  mux.Handle("POST /api/admin/users/{id}/enable", admin(cfg.HandlerEnableUser))
+  mux.Handle("POST /api/admin/users/{id}/password-reset", admin(cfg.HandlerForcePasswordReset))
+  mux.Handle("DELETE /api/admin/users/{id}/sessions", admin(cfg.HandlerAdminRevokeSessions))
+  mux.Handle("POST /api/admin/users/{id}/unlock", admin(cfg.HandlerUnlockUser))
+  mux.Handle("PUT /api/admin/users/{id}/role", admin(cfg.HandlerSetUserRole))
+  mux.Handle("GET /api/admin/roles", admin(cfg.HandlerGetRoles))
+  mux.Handle("GET /api/admin/audit", admin(cfg.HandlerGetAuditLog))
   mux.HandleFunc("GET /api/spells", cfg.HandlerGetAllSpells)
+  mux.HandleFunc("GET /api/spells/search", cfg.HandlerSearchSpells)
+  mux.HandleFunc("GET /api/spells/export", cfg.HandlerExportSpells)
+  mux.HandleFunc("GET /api/spells/cards/{index}", cfg.HandlerGetSpellCard)
   mux.HandleFunc("GET /api/spells/{index}", cfg.HandlerGetSpell)
   mux.HandleFunc("GET /api/classes/{class}", cfg.HandlerGetSpellsClass)
   mux.HandleFunc("GET /api/subclasses/{subclass}", cfg.HandlerGetSpellsSubclass)
   mux.HandleFunc("GET /api/spells/levels/{level}", cfg.HandlerGetSpellsLevel)
   mux.HandleFunc("GET /api/spells/concentration", cfg.HandlerGetSpellsConcentration)
   mux.HandleFunc("GET /api/spells/ritual", cfg.HandlerGetSpellsRitual)
-  mux.HandleFunc("POST /api/users", cfg.HandlerCreateUser)
-  mux.HandleFunc("POST /api/login", cfg.HandlerLogin)
-  mux.HandleFunc("POST /api/refresh", cfg.HandlerRefresh)
+  mux.Handle("POST /api/users", authLimit(http.HandlerFunc(cfg.HandlerCreateUser)))
+  mux.Handle("POST /api/login", authLimit(http.HandlerFunc(cfg.HandlerLogin)))
+  mux.Handle("POST /api/login/mfa", authLimit(http.HandlerFunc(cfg.HandlerLoginMFA)))
+  mux.Handle("GET /api/oidc/login", authLimit(http.HandlerFunc(cfg.HandlerOIDCLogin)))
+  mux.Handle("GET /api/oidc/callback", authLimit(http.HandlerFunc(cfg.HandlerOIDCCallback)))
+  mux.Handle("POST /api/2fa/enroll", account(cfg.HandlerEnrollTOTP))
+  mux.Handle("POST /api/2fa/confirm", account(cfg.HandlerConfirmTOTP))
+  mux.Handle("POST /api/2fa/disable", account(cfg.HandlerDisableTOTP))
+  mux.Handle("POST /api/refresh", authLimit(http.HandlerFunc(cfg.HandlerRefresh)))
   mux.HandleFunc("POST /api/revoke", cfg.HandlerRevoke)
+  mux.Handle("GET /api/sessions", account(cfg.HandlerGetSessions))
+  mux.Handle("DELETE /api/sessions", account(cfg.HandlerRevokeAllSessions))
+  mux.Handle("DELETE /api/sessions/{id}", account(cfg.HandlerRevokeSession))
+  mux.Handle("POST /api/keys", account(cfg.HandlerCreateAPIKey))
+  mux.Handle("GET /api/keys", account(cfg.HandlerGetAPIKeys))
+  mux.Handle("DELETE /api/keys/{id}", account(cfg.HandlerRevokeAPIKey))
   mux.HandleFunc("PUT /api/users", cfg.HandlerUpdateUser)
+  mux.Handle("POST /api/users/verify", authLimit(http.HandlerFunc(cfg.HandlerVerifyEmail)))
+  mux.Handle("POST /api/users/verify/resend", authLimit(account(cfg.HandlerResendVerificationEmail)))
+  mux.Handle("POST /api/password/forgot", authLimit(http.HandlerFunc(cfg.HandlerForgotPassword)))
+  mux.Handle("POST /api/password/reset", authLimit(http.HandlerFunc(cfg.HandlerResetPassword)))
   mux.HandleFunc("POST /api/users/delete", cfg.HandlerDeleteUser)
   mux.HandleFunc("POST /api/characters/delete", cfg.HandlerDeleteCharacter)
   mux.HandleFunc("POST /api/characters", cfg.HandlerCreateCharacter)
@@ -88,10 +203,13 @@ func main() {
   mux.HandleFunc("POST /api/characters/spells", cfg.HandlerCharacterSpells)
   mux.HandleFunc("POST /api/characters/spells/list", cfg.HandlerGetCharacterSpells)
   mux.HandleFunc("POST /api/characters/spells/delete", cfg.HandlerRemoveCharacterSpell)
+  mux.HandleFunc("GET /api/characters/{id}/spellcards.pdf", cfg.HandlerGetCharacterSpellCards)
+
+  defaultLimit := cfg.RateLimit(ratelimit.New(rateLimitPolicy("RATE_LIMIT_DEFAULT", "120/m")))
 
   srv := &http.Server{
         Addr:    ":" + port,
-        Handler: limitMiddleware(api.EnableCORS(mux)),
+        Handler: api.RequestID(api.EnableCORS(defaultLimit(mux))),
     }  
 
   log.Printf("Serving files from %s on port: %s\n", filepathRoot, port)
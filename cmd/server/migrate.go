@@ -0,0 +1,73 @@
+package main
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"log"
+	"github.com/kblasti/spellbook/internal/migrate"
+	"github.com/kblasti/spellbook/sql/schema"
+)
+
+// runMigrate handles "server migrate up|down|status".
+func runMigrate(db *sql.DB, args []string) {
+	if len(args) != 1 {
+		log.Fatal("usage: server migrate up|down|status")
+	}
+
+	migrator, err := migrate.New(db, schema.FS)
+	if err != nil {
+		log.Fatalf("loading migrations: %v", err)
+	}
+	ctx := context.Background()
+
+	switch args[0] {
+	case "up":
+		applied, err := migrator.Up(ctx)
+		for _, m := range applied {
+			fmt.Printf("applied %03d_%s\n", m.Version, m.Name)
+		}
+		if err != nil {
+			log.Fatal(err)
+		}
+		if len(applied) == 0 {
+			fmt.Println("database is up to date")
+		}
+	case "down":
+		m, err := migrator.Down(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		fmt.Printf("rolled back %03d_%s\n", m.Version, m.Name)
+	case "status":
+		statuses, err := migrator.Status(ctx)
+		if err != nil {
+			log.Fatal(err)
+		}
+		for _, s := range statuses {
+			appliedAt := "pending"
+			if s.Applied {
+				appliedAt = s.AppliedAt.Format("2006-01-02 15:04:05")
+			}
+			fmt.Printf("%-20s %03d_%s\n", appliedAt, s.Version, s.Name)
+		}
+	default:
+		log.Fatalf("unknown migrate command %q, want up, down or status", args[0])
+	}
+}
+
+// migrateOnStart applies pending migrations before the server starts
+// serving. Replicas starting together wait on the migration lock.
+func migrateOnStart(db *sql.DB) {
+	migrator, err := migrate.New(db, schema.FS)
+	if err != nil {
+		log.Fatalf("loading migrations: %v", err)
+	}
+	applied, err := migrator.Up(context.Background())
+	for _, m := range applied {
+		log.Printf("applied migration %03d_%s", m.Version, m.Name)
+	}
+	if err != nil {
+		log.Fatalf("migrating: %v", err)
+	}
+}
@@ -9,10 +9,10 @@ require (
 	github.com/joho/godotenv v1.5.1
 	github.com/lib/pq v1.11.2
 	github.com/sqlc-dev/pqtype v0.3.0
+	golang.org/x/time v0.15.0
 )
 
 require (
 	golang.org/x/crypto v0.21.0 // indirect
 	golang.org/x/sys v0.40.0 // indirect
-	golang.org/x/time v0.15.0 // indirect
 )
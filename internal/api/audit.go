@@ -0,0 +1,96 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/database"
+	"github.com/sqlc-dev/pqtype"
+)
+
+// Audit actions.
+const (
+	auditLoginLockout	= "login.lockout"
+	auditLoginUnlock	= "login.unlock"
+	auditUserCreateAdmin	= "user.create_admin"
+	auditUserEmail		= "user.email_change"
+	auditUserPassword	= "user.password_change"
+	auditUserRole		= "user.role_change"
+	auditUserDisable	= "user.disable"
+	auditUserEnable		= "user.enable"
+	auditUserPasswordReset	= "user.password_reset"
+	auditUserSessionsRevoke	= "user.sessions_revoke"
+	auditSpellCreate		= "spell.create"
+	auditSpellUpdate		= "spell.update"
+	auditSpellDelete		= "spell.delete"
+	auditSpellRevert		= "spell.revert"
+)
+
+// auditEvent describes one security-relevant change. Before and After
+// summarise the target on either side of it and are omitted when nil.
+type auditEvent struct {
+	Action		string
+	TargetType	string
+	TargetID	string
+	Before		interface{}
+	After		interface{}
+	Details		interface{}
+}
+
+// recordAudit appends event to the audit log using q. It's meant to run in
+// the transaction making the change, so the entry and the change commit or
+// roll back together. actorID is uuid.Nil for events with no authenticated
+// actor.
+func (cfg *APIConfig) recordAudit(r *http.Request, q *database.Queries, actorID uuid.UUID, event auditEvent) error {
+	details := json.RawMessage("{}")
+	if event.Details != nil {
+		data, err := json.Marshal(event.Details)
+		if err != nil {
+			return err
+		}
+		details = data
+	}
+
+	before, err := auditSummary(event.Before)
+	if err != nil {
+		return err
+	}
+	after, err := auditSummary(event.After)
+	if err != nil {
+		return err
+	}
+
+	return q.CreateAuditEntry(r.Context(), database.CreateAuditEntryParams{
+		ActorID:	uuid.NullUUID{UUID: actorID, Valid: actorID != uuid.Nil},
+		Action:		event.Action,
+		TargetType:	event.TargetType,
+		TargetID:	event.TargetID,
+		IpAddress:	nullString(cfg.clientIP(r)),
+		Details:	details,
+		RequestID:	nullString(requestIDFromContext(r.Context())),
+		Before:		before,
+		After:		after,
+	})
+}
+
+func auditSummary(v interface{}) (pqtype.NullRawMessage, error) {
+	if v == nil {
+		return pqtype.NullRawMessage{}, nil
+	}
+	data, err := json.Marshal(v)
+	if err != nil {
+		return pqtype.NullRawMessage{}, err
+	}
+	return pqtype.NullRawMessage{RawMessage: data, Valid: true}, nil
+}
+
+// auditInTx makes a change with fn and records event in the same
+// transaction.
+func (cfg *APIConfig) auditInTx(r *http.Request, actorID uuid.UUID, event auditEvent, fn func(q *database.Queries) error) error {
+	return cfg.inTx(r.Context(), func(q *database.Queries) error {
+		if err := fn(q); err != nil {
+			return err
+		}
+		return cfg.recordAudit(r, q, actorID, event)
+	})
+}
@@ -0,0 +1,33 @@
+package api
+
+import (
+	"database/sql"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// clientIP returns the address of the caller. Proxy headers are only honoured
+// when the server is configured to sit behind a trusted reverse proxy,
+// otherwise anyone could claim any address.
+func (cfg *APIConfig) clientIP(r *http.Request) string {
+	if cfg.TrustProxyHeaders {
+		if forwarded := r.Header.Get("X-Forwarded-For"); forwarded != "" {
+			first, _, _ := strings.Cut(forwarded, ",")
+			return strings.TrimSpace(first)
+		}
+		if realIP := r.Header.Get("X-Real-IP"); realIP != "" {
+			return strings.TrimSpace(realIP)
+		}
+	}
+
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		return r.RemoteAddr
+	}
+	return host
+}
+
+func nullString(s string) sql.NullString {
+	return sql.NullString{String: s, Valid: s != ""}
+}
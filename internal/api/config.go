@@ -2,14 +2,58 @@ package api
 
 import (
 	"net/http"
+	"context"
+	"database/sql"
 	"encoding/json"
+	"errors"
+	"github.com/kblasti/spellbook/internal/auth"
 	"github.com/kblasti/spellbook/internal/database"
+	"github.com/kblasti/spellbook/internal/mail"
+	"github.com/kblasti/spellbook/internal/oidc"
+	"github.com/lib/pq"
 )
 
 type APIConfig struct {
-  DB        *database.Queries
-  Platform  string
-  Secret    string
+  DB                *database.Queries
+  // Conn is the connection DB runs on, used to start transactions.
+  Conn              *sql.DB
+  Platform          string
+  // Secret signs short-lived internal tokens such as MFA challenges and
+  // email verification links.
+  Secret            string
+  // Keys signs and verifies access tokens.
+  Keys              *auth.KeySet
+  TrustProxyHeaders bool
+  Mailer            mail.Mailer
+  AppURL            string
+  // RequireVerifiedEmail stops users who haven't verified their email
+  // address from creating characters.
+  RequireVerifiedEmail bool
+  // OIDC is the external identity provider users can log in with, or nil
+  // if OIDC login is disabled.
+  OIDC              *oidc.Provider
+}
+
+// inTx runs fn with queries bound to a new transaction, committing it if fn
+// succeeds and rolling it back otherwise. fn's error is returned unchanged.
+func (cfg *APIConfig) inTx(ctx context.Context, fn func(q *database.Queries) error) error {
+	tx, err := cfg.Conn.BeginTx(ctx, nil)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback()
+
+	if err := fn(cfg.DB.WithTx(tx)); err != nil {
+		return err
+	}
+	return tx.Commit()
+}
+
+// isUniqueViolation reports whether err is Postgres rejecting a duplicate
+// value for a unique constraint.
+func isUniqueViolation(err error) bool {
+	var pqErr *pq.Error
+	return errors.As(err, &pqErr) && pqErr.Code == "23505"
 }
 
 func respondWithError(w http.ResponseWriter, code int, msg string) {
@@ -27,6 +71,15 @@ func respondWithError(w http.ResponseWriter, code int, msg string) {
     w.Write(data)
 }
 
+// respondWithFieldErrors reports a request that failed validation, listing
+// the problem with each offending field.
+func respondWithFieldErrors(w http.ResponseWriter, errs map[string]string) {
+    respondWithJSON(w, 422, map[string]interface{}{
+        "error":    "Validation failed",
+        "fields":   errs,
+    })
+}
+
 func respondWithJSON(w http.ResponseWriter, code int, payload interface{}) {
     w.Header().Set("Content-Type", "application/json")
     w.WriteHeader(code)
@@ -49,8 +102,9 @@ func respondWithMessage(w http.ResponseWriter, code int, msg string) {
 func EnableCORS(next http.Handler) http.Handler {
     return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
         w.Header().Set("Access-Control-Allow-Origin", "*")
-        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization")
-        w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, DELETE, OPTIONS")
+        w.Header().Set("Access-Control-Allow-Headers", "Content-Type, Authorization, X-API-Key, X-Request-ID")
+        w.Header().Set("Access-Control-Allow-Methods", "GET, POST, PUT, PATCH, DELETE, OPTIONS")
+        w.Header().Set("Access-Control-Expose-Headers", "RateLimit-Policy, RateLimit-Limit, RateLimit-Remaining, RateLimit-Reset, Retry-After, X-Request-ID")
 
         if r.Method == "OPTIONS" {
             return
@@ -0,0 +1,405 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"time"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+// loadPathUser resolves the user named by the {id} path value. It reports
+// whether the handler should continue.
+func (cfg *APIConfig) loadPathUser(w http.ResponseWriter, r *http.Request) (database.User, bool) {
+	userID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid user ID")
+		return database.User{}, false
+	}
+
+	dbUser, err := cfg.DB.GetUserByID(r.Context(), userID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, 404, "User not found")
+		return dbUser, false
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error retrieving user")
+		return dbUser, false
+	}
+
+	return dbUser, true
+}
+
+func (cfg *APIConfig) HandlerAdminGetUsers(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	disabled, err := parseOptionalBool(query, "disabled")
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	filter := database.UserFilter{
+		Query:		query.Get("q"),
+		Role:		query.Get("role"),
+		Disabled:	disabled,
+	}
+
+	page, err := parsePage(query, "email")
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	users, nextCursor, err := cfg.DB.ListUsers(r.Context(), filter, page)
+	if isPageError(err) {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error getting users")
+		return
+	}
+
+	total, err := cfg.DB.CountUsers(r.Context(), filter)
+	if err != nil {
+		respondWithError(w, 500, "Error counting users")
+		return
+	}
+
+	returnSlice := []User{}
+
+	for _, dbUser := range users {
+		returnSlice = append(returnSlice, userFromDB(dbUser))
+	}
+
+	respondWithJSON(w, 200, ListResponse[User]{
+		Data:		returnSlice,
+		NextCursor:	nextCursor,
+		Total:		total,
+	})
+	return
+}
+
+func (cfg *APIConfig) HandlerAdminGetUser(w http.ResponseWriter, r *http.Request) {
+	dbUser, ok := cfg.loadPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, 200, userFromDB(dbUser))
+	return
+}
+
+func (cfg *APIConfig) HandlerAdminGetUserCharacters(w http.ResponseWriter, r *http.Request) {
+	dbUser, ok := cfg.loadPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	page, err := parsePage(r.URL.Query(), "name")
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	characters, nextCursor, err := cfg.DB.ListUserCharacters(r.Context(), dbUser.ID, page)
+	if isPageError(err) {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error getting characters")
+		return
+	}
+
+	total, err := cfg.DB.CountUserCharacters(r.Context(), dbUser.ID)
+	if err != nil {
+		respondWithError(w, 500, "Error counting characters")
+		return
+	}
+
+	returnSlice := []Character{}
+
+	for _, character := range characters {
+		val := Character{
+			ID:				character.ID,
+			Name:			character.Name,
+			ClassLevels:	character.ClassLevels,
+		}
+		returnSlice = append(returnSlice, val)
+	}
+
+	respondWithJSON(w, 200, ListResponse[Character]{
+		Data:		returnSlice,
+		NextCursor:	nextCursor,
+		Total:		total,
+	})
+	return
+}
+
+func (cfg *APIConfig) HandlerDisableUser(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserDisabled(w, r, true)
+}
+
+func (cfg *APIConfig) HandlerEnableUser(w http.ResponseWriter, r *http.Request) {
+	cfg.setUserDisabled(w, r, false)
+}
+
+// setUserDisabled disables or re-enables an account. Disabling also revokes
+// the user's sessions; access tokens already issued stay valid until they
+// expire, but can't be refreshed.
+func (cfg *APIConfig) setUserDisabled(w http.ResponseWriter, r *http.Request, disable bool) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	dbUser, ok := cfg.loadPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	if dbUser.ID == principal.UserID {
+		respondWithError(w, 400, "You can't disable or enable your own account")
+		return
+	}
+
+	disabledAt := sql.NullTime{}
+	action := auditUserEnable
+	if disable {
+		disabledAt = sql.NullTime{Time: time.Now().UTC(), Valid: true}
+		action = auditUserDisable
+	}
+
+	if dbUser.DisabledAt.Valid == disable {
+		respondWithJSON(w, 200, userFromDB(dbUser))
+		return
+	}
+
+	event := auditEvent{
+		Action:		action,
+		TargetType:	"user",
+		TargetID:	dbUser.ID.String(),
+		Before:		map[string]bool{"disabled": !disable},
+		After:		map[string]bool{"disabled": disable},
+	}
+	err := cfg.auditInTx(r, principal.UserID, event, func(q *database.Queries) error {
+		var err error
+		dbUser, err = q.SetUserDisabled(r.Context(), database.SetUserDisabledParams{
+			ID:			dbUser.ID,
+			DisabledAt:	disabledAt,
+		})
+		if err != nil || !disable {
+			return err
+		}
+		return q.RevokeUserRefreshTokens(r.Context(), uuid.NullUUID{UUID: dbUser.ID, Valid: true})
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error updating user")
+		return
+	}
+
+	respondWithJSON(w, 200, userFromDB(dbUser))
+	return
+}
+
+// HandlerForcePasswordReset replaces a user's password with a random one,
+// signs them out everywhere and emails them a reset link.
+func (cfg *APIConfig) HandlerForcePasswordReset(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	dbUser, ok := cfg.loadPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	password, err := auth.MakeRefreshToken()
+	if err != nil {
+		respondWithError(w, 500, "Error resetting password")
+		return
+	}
+
+	hashed, err := auth.HashPassword(password)
+	if err != nil {
+		respondWithError(w, 500, "Error hashing password")
+		return
+	}
+
+	event := auditEvent{
+		Action:		auditUserPasswordReset,
+		TargetType:	"user",
+		TargetID:	dbUser.ID.String(),
+	}
+	err = cfg.auditInTx(r, principal.UserID, event, func(q *database.Queries) error {
+		err := q.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			HashedPassword:	hashed,
+			ID:				dbUser.ID,
+		})
+		if err != nil {
+			return err
+		}
+		return q.RevokeUserRefreshTokens(r.Context(), uuid.NullUUID{UUID: dbUser.ID, Valid: true})
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error updating password")
+		return
+	}
+
+	err = cfg.sendPasswordResetEmail(r.Context(), dbUser, "An administrator has reset the password for your Spellbook account.", "You won't be able to log in with your old password.")
+	if err != nil {
+		respondWithError(w, 500, "Error saving reset token")
+		return
+	}
+
+	respondWithMessage(w, 200, "Password reset, the user has been emailed a reset link")
+	return
+}
+
+func (cfg *APIConfig) HandlerAdminRevokeSessions(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	dbUser, ok := cfg.loadPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	event := auditEvent{
+		Action:		auditUserSessionsRevoke,
+		TargetType:	"user",
+		TargetID:	dbUser.ID.String(),
+	}
+	err := cfg.auditInTx(r, principal.UserID, event, func(q *database.Queries) error {
+		return q.RevokeUserRefreshTokens(r.Context(), uuid.NullUUID{UUID: dbUser.ID, Valid: true})
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error revoking sessions")
+		return
+	}
+
+	respondWithJSON(w, 204, nil)
+	return
+}
+
+// HandlerUnlockUser clears the failed login count and any lockout on a
+// user's account.
+func (cfg *APIConfig) HandlerUnlockUser(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	dbUser, ok := cfg.loadPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	err := cfg.inTx(r.Context(), func(q *database.Queries) error {
+		cleared, err := q.ClearLoginThrottle(r.Context(), accountThrottleKey(dbUser.Email))
+		if err != nil || cleared == 0 {
+			return err
+		}
+		return cfg.recordAudit(r, q, principal.UserID, auditEvent{
+			Action:		auditLoginUnlock,
+			TargetType:	"user",
+			TargetID:	dbUser.ID.String(),
+		})
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error unlocking account")
+		return
+	}
+
+	respondWithMessage(w, 200, "Account unlocked")
+	return
+}
+
+type Role struct {
+	Name		string		`json:"name"`
+	Description	string		`json:"description"`
+	Permissions	[]string	`json:"permissions"`
+}
+
+func (cfg *APIConfig) HandlerGetRoles(w http.ResponseWriter, r *http.Request) {
+	roles, err := cfg.DB.ListRoles(r.Context())
+	if err != nil {
+		respondWithError(w, 500, "Error getting roles")
+		return
+	}
+
+	returnSlice := []Role{}
+
+	for _, role := range roles {
+		val := Role{
+			Name:			role.Name,
+			Description:	role.Description,
+			Permissions:	role.Permissions,
+		}
+		returnSlice = append(returnSlice, val)
+	}
+
+	respondWithJSON(w, 200, returnSlice)
+	return
+}
+
+func (cfg *APIConfig) HandlerSetUserRole(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Role	string	`json:"role"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	before, ok := cfg.loadPathUser(w, r)
+	if !ok {
+		return
+	}
+
+	// Callers can't change their own role. The route requires users:manage,
+	// so the caller keeps it and there is always someone left who can
+	// manage users.
+	if before.ID == principal.UserID {
+		respondWithError(w, 400, "You can't change your own role")
+		return
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	input := Input{}
+
+	err := decoder.Decode(&input)
+	if err != nil {
+		respondWithError(w, 400, "Error decoding input")
+		return
+	}
+
+	_, err = cfg.DB.GetRole(r.Context(), input.Role)
+	if err == sql.ErrNoRows {
+		respondWithError(w, 400, "Unknown role "+input.Role)
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error getting role")
+		return
+	}
+
+	var dbUser database.User
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		var err error
+		dbUser, err = q.SetUserRole(r.Context(), database.SetUserRoleParams{
+			ID:		before.ID,
+			Role:	input.Role,
+		})
+		if err != nil || before.Role == dbUser.Role {
+			return err
+		}
+		return cfg.recordAudit(r, q, principal.UserID, auditEvent{
+			Action:		auditUserRole,
+			TargetType:	"user",
+			TargetID:	dbUser.ID.String(),
+			Before:		map[string]string{"role": before.Role},
+			After:		map[string]string{"role": dbUser.Role},
+		})
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error updating role")
+		return
+	}
+
+	respondWithJSON(w, 200, userFromDB(dbUser))
+	return
+}
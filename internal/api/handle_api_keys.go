@@ -0,0 +1,163 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+type APIKey struct {
+	ID			uuid.UUID		`json:"id"`
+	Name		string			`json:"name"`
+	Prefix		string			`json:"prefix"`
+	Scopes		[]string		`json:"scopes"`
+	CreatedAt	time.Time		`json:"created_at"`
+	LastUsedAt	*time.Time		`json:"last_used_at"`
+	ExpiresAt	*time.Time		`json:"expires_at"`
+}
+
+func apiKeyFromDB(key database.ApiKey) APIKey {
+	val := APIKey{
+		ID:			key.ID,
+		Name:		key.Name,
+		Prefix:		key.Prefix,
+		Scopes:		key.Scopes,
+		CreatedAt:	key.CreatedAt,
+	}
+	if key.LastUsedAt.Valid {
+		val.LastUsedAt = &key.LastUsedAt.Time
+	}
+	if key.ExpiresAt.Valid {
+		val.ExpiresAt = &key.ExpiresAt.Time
+	}
+	return val
+}
+
+func (cfg *APIConfig) HandlerCreateAPIKey(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Name			string		`json:"name"`
+		Scopes			[]string	`json:"scopes"`
+		ExpiresInDays	int			`json:"expires_in_days"`
+	}
+
+	type createResponse struct {
+		APIKey
+		Key		string		`json:"key"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	decoder := json.NewDecoder(r.Body)
+	input := Input{}
+
+	err := decoder.Decode(&input)
+	if err != nil {
+		respondWithError(w, 400, "Error decoding input")
+		return
+	}
+
+	input.Name = strings.TrimSpace(input.Name)
+	if input.Name == "" {
+		respondWithError(w, 400, "API key name is required")
+		return
+	}
+
+	if len(input.Scopes) == 0 {
+		respondWithError(w, 400, "At least one scope is required")
+		return
+	}
+	for _, scope := range input.Scopes {
+		if !auth.IsAPIKeyScope(scope) {
+			respondWithError(w, 400, "Unknown scope "+scope)
+			return
+		}
+	}
+
+	if input.ExpiresInDays < 0 {
+		respondWithError(w, 400, "expires_in_days must not be negative")
+		return
+	}
+
+	var expiresAt sql.NullTime
+	if input.ExpiresInDays > 0 {
+		expiresAt = sql.NullTime{
+			Time:	time.Now().UTC().AddDate(0, 0, input.ExpiresInDays),
+			Valid:	true,
+		}
+	}
+
+	apiKey, prefix, err := auth.MakeAPIKey()
+	if err != nil {
+		respondWithError(w, 500, "Error making API key")
+		return
+	}
+
+	key, err := cfg.DB.CreateAPIKey(r.Context(), database.CreateAPIKeyParams{
+		UserID:		principal.UserID,
+		Name:		input.Name,
+		Prefix:		prefix,
+		KeyHash:	auth.HashToken(apiKey),
+		Scopes:		input.Scopes,
+		ExpiresAt:	expiresAt,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error saving API key")
+		return
+	}
+
+	respondWithJSON(w, 201, createResponse{
+		APIKey:	apiKeyFromDB(key),
+		Key:	apiKey,
+	})
+	return
+}
+
+func (cfg *APIConfig) HandlerGetAPIKeys(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	keys, err := cfg.DB.ListUserAPIKeys(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Error getting API keys")
+		return
+	}
+
+	returnSlice := []APIKey{}
+
+	for _, key := range keys {
+		returnSlice = append(returnSlice, apiKeyFromDB(key))
+	}
+
+	respondWithJSON(w, 200, returnSlice)
+	return
+}
+
+func (cfg *APIConfig) HandlerRevokeAPIKey(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	keyID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid API key ID")
+		return
+	}
+
+	revoked, err := cfg.DB.RevokeAPIKey(r.Context(), database.RevokeAPIKeyParams{
+		ID:		keyID,
+		UserID:	principal.UserID,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error revoking API key")
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, 404, "API key not found")
+		return
+	}
+
+	respondWithJSON(w, 204, nil)
+	return
+}
@@ -0,0 +1,126 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"time"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+type AuditEntry struct {
+	ID			uuid.UUID			`json:"id"`
+	CreatedAt	time.Time			`json:"created_at"`
+	ActorID		*uuid.UUID			`json:"actor_id"`
+	Action		string				`json:"action"`
+	TargetType	string				`json:"target_type"`
+	TargetID	string				`json:"target_id"`
+	IPAddress	string				`json:"ip_address"`
+	RequestID	string				`json:"request_id"`
+	Before		json.RawMessage		`json:"before"`
+	After		json.RawMessage		`json:"after"`
+	Details		json.RawMessage		`json:"details"`
+}
+
+func auditEntryFromDB(entry database.AuditLog) AuditEntry {
+	val := AuditEntry{
+		ID:			entry.ID,
+		CreatedAt:	entry.CreatedAt,
+		Action:		entry.Action,
+		TargetType:	entry.TargetType,
+		TargetID:	entry.TargetID,
+		IPAddress:	entry.IpAddress.String,
+		RequestID:	entry.RequestID.String,
+		Before:		entry.Before.RawMessage,
+		After:		entry.After.RawMessage,
+		Details:	entry.Details,
+	}
+	if entry.ActorID.Valid {
+		val.ActorID = &entry.ActorID.UUID
+	}
+	return val
+}
+
+// HandlerGetAuditLog lists audit log entries, newest first by default,
+// filtered by the optional actor, action, target_type, target_id, since and
+// until query parameters. Times are RFC 3339.
+func (cfg *APIConfig) HandlerGetAuditLog(w http.ResponseWriter, r *http.Request) {
+	query := r.URL.Query()
+
+	filter := database.AuditFilter{
+		Action:		query.Get("action"),
+		TargetType:	query.Get("target_type"),
+		TargetID:	query.Get("target_id"),
+	}
+
+	if actor := query.Get("actor"); actor != "" {
+		actorID, err := uuid.Parse(actor)
+		if err != nil {
+			respondWithError(w, 400, "Invalid actor")
+			return
+		}
+		filter.ActorID = uuid.NullUUID{UUID: actorID, Valid: true}
+	}
+
+	var err error
+	if filter.Since, err = parseOptionalTime(query.Get("since")); err != nil {
+		respondWithError(w, 400, "Invalid since, expected an RFC 3339 time")
+		return
+	}
+	if filter.Until, err = parseOptionalTime(query.Get("until")); err != nil {
+		respondWithError(w, 400, "Invalid until, expected an RFC 3339 time")
+		return
+	}
+
+	if query.Get("order") == "" {
+		query.Set("order", "desc")
+	}
+	page, err := parsePage(query, "created_at")
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	entries, nextCursor, err := cfg.DB.ListAuditEntries(r.Context(), filter, page)
+	if isPageError(err) {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error getting audit log")
+		return
+	}
+
+	total, err := cfg.DB.CountAuditEntries(r.Context(), filter)
+	if err != nil {
+		respondWithError(w, 500, "Error counting audit log entries")
+		return
+	}
+
+	returnSlice := []AuditEntry{}
+
+	for _, entry := range entries {
+		returnSlice = append(returnSlice, auditEntryFromDB(entry))
+	}
+
+	respondWithJSON(w, 200, ListResponse[AuditEntry]{
+		Data:		returnSlice,
+		NextCursor:	nextCursor,
+		Total:		total,
+	})
+	return
+}
+
+// parseOptionalTime parses an RFC 3339 time, returning the zero time for an
+// empty value. The result is in UTC because created_at is a TIMESTAMP
+// column, and Postgres drops the offset of anything compared with it.
+func parseOptionalTime(value string) (time.Time, error) {
+	if value == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339, value)
+	if err != nil {
+		return time.Time{}, err
+	}
+	return t.UTC(), nil
+}
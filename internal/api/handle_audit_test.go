@@ -0,0 +1,63 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestGetAuditLogRejectsBadFilters(t *testing.T) {
+	cfg := &APIConfig{}
+
+	for _, query := range []string{
+		"actor=not-a-uuid",
+		"since=yesterday",
+		"until=2026-13-01T00:00:00Z",
+		"order=sideways",
+	} {
+		t.Run(query, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/admin/audit?"+query, nil)
+			rec := httptest.NewRecorder()
+			cfg.HandlerGetAuditLog(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
+
+func TestParseOptionalTime(t *testing.T) {
+	tests := []struct {
+		value	string
+		want	time.Time
+		wantErr	bool
+	}{
+		{"", time.Time{}, false},
+		{"2026-10-17T08:00:00Z", time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC), false},
+		{"2026-10-17T10:00:00+02:00", time.Date(2026, 10, 17, 8, 0, 0, 0, time.UTC), false},
+		{"2026-10-16T23:30:00-05:00", time.Date(2026, 10, 17, 4, 30, 0, 0, time.UTC), false},
+		{"2026-10-17", time.Time{}, true},
+		{"yesterday", time.Time{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.value, func(t *testing.T) {
+			got, err := parseOptionalTime(tt.value)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseOptionalTime(%q) = %v, want an error", tt.value, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseOptionalTime(%q) error: %v", tt.value, err)
+			}
+			// Equal alone would accept the right instant in the wrong zone.
+			if !got.Equal(tt.want) || (!got.IsZero() && got.Location() != time.UTC) {
+				t.Errorf("parseOptionalTime(%q) = %v, want %v", tt.value, got, tt.want)
+			}
+		})
+	}
+}
@@ -2,6 +2,7 @@ package api
 
 import (
 	"net/http"
+	"database/sql"
 	"encoding/json"
 	"github.com/google/uuid"
 	"github.com/kblasti/spellbook/internal/database"
@@ -14,28 +15,54 @@ type Character struct{
 	ClassLevels	json.RawMessage	`json:"class_levels"`
 }
 
+// loadOwnedCharacter resolves the character with the given ID for userID.
+// Characters owned by someone else are reported as not found so their
+// existence isn't leaked. It reports whether the handler should continue.
+func (cfg *APIConfig) loadOwnedCharacter(w http.ResponseWriter, r *http.Request, userID, charID uuid.UUID) (database.GetUserCharacterRow, bool) {
+	character, err := cfg.DB.GetUserCharacter(r.Context(), database.GetUserCharacterParams{
+		ID:		charID,
+		UserID:	userID,
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, 404, "Character not found")
+		return character, false
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error getting character")
+		return character, false
+	}
+
+	return character, true
+}
+
 func (cfg *APIConfig) HandlerCreateCharacter(w http.ResponseWriter, r *http.Request) {
 	type Input struct{
 		Name		string			`json:"name"`
 		ClassLevels	json.RawMessage	`json:"class_levels"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-    if err != nil {
-        respondWithError(w, 401, "Error retrieving token")
-        return
-    }
+	principal, ok := cfg.authorize(w, r, auth.ScopeCharactersWrite)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
-    userID, _, err := auth.ValidateJWT(token, cfg.Secret)
-    if err != nil {
-        respondWithError(w, 401, "Error validating token")
-        return
-    }
+	if cfg.RequireVerifiedEmail {
+		dbUser, err := cfg.DB.GetUserByID(r.Context(), userID)
+		if err != nil {
+			respondWithError(w, 500, "Error retrieving user")
+			return
+		}
+		if !dbUser.EmailVerifiedAt.Valid {
+			respondWithError(w, 403, "Verify your email address before creating characters")
+			return
+		}
+	}
 
 	decoder := json.NewDecoder(r.Body)
     input := Input{}
 
-    err = decoder.Decode(&input)
+    err := decoder.Decode(&input)
     if err != nil {
         respondWithError(w, 500, "Error decoding input")
         return
@@ -68,22 +95,16 @@ func (cfg *APIConfig) HandlerUpdateCharacter(w http.ResponseWriter, r *http.Requ
 		ClassLevels	json.RawMessage	`json:"class_levels"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-    if err != nil {
-        respondWithError(w, 401, "Error retrieving token")
-        return
-    }
-
-    _, _, err = auth.ValidateJWT(token, cfg.Secret)
-    if err != nil {
-        respondWithError(w, 401, "Error validating token")
-        return
-    }
+	principal, ok := cfg.authorize(w, r, auth.ScopeCharactersWrite)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
 	decoder := json.NewDecoder(r.Body)
     input := Input{}
 
-    err = decoder.Decode(&input)
+    err := decoder.Decode(&input)
     if err != nil {
         respondWithError(w, 500, "Error decoding input")
         return
@@ -93,7 +114,12 @@ func (cfg *APIConfig) HandlerUpdateCharacter(w http.ResponseWriter, r *http.Requ
 		Name:			input.Name,
 		ClassLevels:	input.ClassLevels,
 		ID:				input.ID,
+		UserID:			userID,
 	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, 404, "Character not found")
+		return
+	}
 	if err != nil {
 		respondWithError(w, 500, "Error updating character")
 		return
@@ -114,31 +140,33 @@ func (cfg *APIConfig) HandlerDeleteCharacter(w http.ResponseWriter, r *http.Requ
 		ID uuid.UUID `json:"id"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header)
-    if err != nil {
-        respondWithError(w, 401, "Error retrieving token")
-        return
-    }
-
-    userID, _, err := auth.ValidateJWT(token, cfg.Secret)
-    if err != nil {
-        respondWithError(w, 401, "Error validating token")
-        return
-    }
+	principal, ok := cfg.authorize(w, r, auth.ScopeCharactersWrite)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 
 	decoder := json.NewDecoder(r.Body)
     input := Input{}
 
-    err = decoder.Decode(&input)
+    err := decoder.Decode(&input)
     if err != nil {
         respondWithError(w, 500, "Error decoding input")
         return
     }
 
-	err = cfg.DB.DeleteCharacter(r.Context(), database.DeleteCharacterParams{
+	deleted, err := cfg.DB.DeleteCharacter(r.Context(), database.DeleteCharacterParams{
 		ID:     input.ID,
 		UserID: userID,
 	})
+	if err != nil {
+		respondWithError(w, 500, "Error deleting character")
+		return
+	}
+	if deleted == 0 {
+		respondWithError(w, 404, "Character not found")
+		return
+	}
 
 	respondWithMessage(w, 201, "Character deleted")
 	return
@@ -155,35 +183,28 @@ func (cfg *APIConfig) HandlerGetSpellSlots(w http.ResponseWriter, r *http.Reques
 		WarlockSlots json.RawMessage `json:"warlock_slots"` 
 	} 
 	
-	token, err := auth.GetBearerToken(r.Header) 
-	if err != nil { 
-		respondWithError(w, 401, "Error retrieving token") 
-		return 
-	} 
-	
-	_, _, err = auth.ValidateJWT(token, cfg.Secret) 
-	if err != nil { 
-		respondWithError(w, 401, "Error validating token") 
-		return 
-	} 
+	principal, ok := cfg.authorize(w, r, auth.ScopeCharactersRead)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 	
 	decoder := json.NewDecoder(r.Body)
     input := Input{}
 
-    err = decoder.Decode(&input)
+    err := decoder.Decode(&input)
     if err != nil {
         respondWithError(w, 500, "Error decoding input")
         return
     }
 	
-	classLevelsJSON, err := cfg.DB.GetClassLevels(r.Context(), input.ID) 
-	if err != nil { 
-		respondWithError(w, 500, "Error getting class levels") 
-		return 
-	} 
+	character, ok := cfg.loadOwnedCharacter(w, r, userID, input.ID)
+	if !ok {
+		return
+	}
 	
 	var levels map[string]int 
-	err = json.Unmarshal(classLevelsJSON, &levels) 
+	err = json.Unmarshal(character.ClassLevels, &levels) 
 	if err != nil { 
 		respondWithError(w, 500, "Error parsing class levels") 
 		return 
@@ -205,7 +226,10 @@ func (cfg *APIConfig) HandlerGetSpellSlots(w http.ResponseWriter, r *http.Reques
 		} 
 	} 
 	
-	effectiveCasterLevel, err := cfg.DB.GetCasterLevel(r.Context(), input.ID) 
+	effectiveCasterLevel, err := cfg.DB.GetCasterLevel(r.Context(), database.GetCasterLevelParams{
+		ID:		input.ID,
+		UserID:	userID,
+	}) 
 	if err != nil { 
 		respondWithError(w, 500, "Error getting effective caster level") 
 		return 
@@ -232,24 +256,34 @@ func (cfg *APIConfig) HandlerGetSpellSlots(w http.ResponseWriter, r *http.Reques
 }
 
 func (cfg *APIConfig) HandlerGetUserCharacters(w http.ResponseWriter, r *http.Request) {
-	token, err := auth.GetBearerToken(r.Header) 
-	if err != nil { 
-		respondWithError(w, 401, "Error retrieving token") 
-		return 
-	} 
-	
-	userID, _, err := auth.ValidateJWT(token, cfg.Secret) 
-	if err != nil { 
-		respondWithError(w, 401, "Error validating token") 
-		return 
+	principal, ok := cfg.authorize(w, r, auth.ScopeCharactersRead)
+	if !ok {
+		return
 	}
+	userID := principal.UserID
 
-	characters, err := cfg.DB.GetUserCharacters(r.Context(), userID)
+	page, err := parsePage(r.URL.Query(), "name")
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	characters, nextCursor, err := cfg.DB.ListUserCharacters(r.Context(), userID, page)
+	if isPageError(err) {
+		respondWithError(w, 400, err.Error())
+		return
+	}
 	if err != nil {
 		respondWithError(w, 500, "Error getting characters")
 		return
 	}
 
+	total, err := cfg.DB.CountUserCharacters(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, 500, "Error counting characters")
+		return
+	}
+
 	returnSlice := []Character{}
 
 	for _, character := range characters {
@@ -261,7 +295,11 @@ func (cfg *APIConfig) HandlerGetUserCharacters(w http.ResponseWriter, r *http.Re
 		returnSlice = append(returnSlice, val)
 	}
 
-	respondWithJSON(w, 200, returnSlice)
+	respondWithJSON(w, 200, ListResponse[Character]{
+		Data:		returnSlice,
+		NextCursor:	nextCursor,
+		Total:		total,
+	})
 	return
 }
 
@@ -272,28 +310,30 @@ func (cfg *APIConfig) HandlerCharacterSpells(w http.ResponseWriter, r *http.Requ
 		Name		string		`json:"name"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header) 
-	if err != nil { 
-		respondWithError(w, 401, "Error retrieving token") 
-		return 
-	} 
-	
-	_, _, err = auth.ValidateJWT(token, cfg.Secret) 
-	if err != nil { 
-		respondWithError(w, 401, "Error validating token") 
-		return 
-	} 
+	principal, ok := cfg.authorize(w, r, auth.ScopeCharactersWrite)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 	
 	decoder := json.NewDecoder(r.Body)
     input := Input{}
 
-    err = decoder.Decode(&input)
+    err := decoder.Decode(&input)
     if err != nil {
         respondWithError(w, 500, "Error decoding input")
         return
     }
+
+	if _, ok := cfg.loadOwnedCharacter(w, r, userID, input.ID); !ok {
+		return
+	}
 	
 	spellID, err := cfg.DB.GetSpellID(r.Context(), input.Index)
+	if err == sql.ErrNoRows {
+		respondWithError(w, 404, "Spell not found")
+		return
+	}
 	if err != nil {
 		respondWithError(w, 500, "Error getting spell ID")
 		return
@@ -302,6 +342,7 @@ func (cfg *APIConfig) HandlerCharacterSpells(w http.ResponseWriter, r *http.Requ
 	_, err = cfg.DB.AddCharacterSpell(r.Context(), database.AddCharacterSpellParams{
 		SpellID:		spellID,
 		CharID:			input.ID,
+		UserID:			userID,
 	})
 	if err != nil {
 		respondWithError(w, 500, "Error adding spell")
@@ -318,47 +359,28 @@ func (cfg *APIConfig) HandlerGetCharacterSpells(w http.ResponseWriter, r *http.R
 		Name		string		`json:"name"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header) 
-	if err != nil { 
-		respondWithError(w, 401, "Error retrieving token") 
-		return 
-	} 
-	
-	_, _, err = auth.ValidateJWT(token, cfg.Secret) 
-	if err != nil { 
-		respondWithError(w, 401, "Error validating token") 
-		return 
-	} 
+	principal, ok := cfg.authorize(w, r, auth.ScopeCharactersRead)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 	
 	decoder := json.NewDecoder(r.Body)
     input := Input{}
 
-    err = decoder.Decode(&input)
+    err := decoder.Decode(&input)
     if err != nil {
         respondWithError(w, 500, "Error decoding input")
         return
     }
 
-	charSpells, err := cfg.DB.GetCharacterSpells(r.Context(), input.ID)
-	if err != nil {
-		respondWithError(w, 500, "Error getting spells")
+	if _, ok := cfg.loadOwnedCharacter(w, r, userID, input.ID); !ok {
 		return
 	}
 
-	returnSlice := []SpellNameUrl{}
-
-	for _, spell := range charSpells {
-		val := SpellNameUrl{
-			Index:		spell.Index,
-			Name:		spell.Name,
-			Level:		spell.Level.Int32,
-			Url:		spell.Url,
-		}
-		returnSlice = append(returnSlice, val)
-	}
-
-	respondWithJSON(w, 200, returnSlice)
-	return
+	respondWithSpellPage(cfg, w, r, database.SpellFilter{
+		CharacterID:	uuid.NullUUID{UUID: input.ID, Valid: true},
+	}, spellNameUrl)
 }
 
 func (cfg *APIConfig) HandlerRemoveCharacterSpell(w http.ResponseWriter, r *http.Request) {
@@ -367,28 +389,30 @@ func (cfg *APIConfig) HandlerRemoveCharacterSpell(w http.ResponseWriter, r *http
 		Index 	string		`json:"index"`
 	}
 
-	token, err := auth.GetBearerToken(r.Header) 
-	if err != nil { 
-		respondWithError(w, 401, "Error retrieving token") 
-		return 
-	} 
-	
-	_, _, err = auth.ValidateJWT(token, cfg.Secret) 
-	if err != nil { 
-		respondWithError(w, 401, "Error validating token") 
-		return 
-	} 
+	principal, ok := cfg.authorize(w, r, auth.ScopeCharactersWrite)
+	if !ok {
+		return
+	}
+	userID := principal.UserID
 	
 	decoder := json.NewDecoder(r.Body)
     input := Input{}
 
-    err = decoder.Decode(&input)
+    err := decoder.Decode(&input)
     if err != nil {
         respondWithError(w, 500, "Error decoding input")
         return
     }
 
+	if _, ok := cfg.loadOwnedCharacter(w, r, userID, input.ID); !ok {
+		return
+	}
+
 	spellID, err := cfg.DB.GetSpellID(r.Context(), input.Index)
+	if err == sql.ErrNoRows {
+		respondWithError(w, 404, "Spell not found")
+		return
+	}
 	if err != nil {
 		respondWithError(w, 500, "Error getting spell ID")
 		return
@@ -397,6 +421,7 @@ func (cfg *APIConfig) HandlerRemoveCharacterSpell(w http.ResponseWriter, r *http
 	err = cfg.DB.RemoveCharacterSpell(r.Context(), database.RemoveCharacterSpellParams{
 		SpellID:	spellID,
 		CharID:		input.ID,
+		UserID:		userID,
 	})
 	if err != nil {
 		respondWithError(w, 500, "Error removing spell from character")
@@ -0,0 +1,93 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"time"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/database"
+	"github.com/kblasti/spellbook/internal/mail"
+)
+
+const verificationExpiration = 24 * time.Hour
+
+func (cfg *APIConfig) sendVerificationEmail(ctx context.Context, userID uuid.UUID, email string) error {
+	token, err := auth.MakeEmailVerificationToken(userID, email, cfg.Secret, verificationExpiration)
+	if err != nil {
+		return err
+	}
+
+	link := cfg.AppURL + "/verify-email?token=" + url.QueryEscape(token)
+	return cfg.Mailer.Send(ctx, mail.Message{
+		To:			email,
+		Subject:	"Verify your Spellbook email address",
+		Body:		fmt.Sprintf("Please confirm this is your email address by opening this link within the next 24 hours:\n%s\n\nIf you didn't create a Spellbook account, you can ignore this email.", link),
+	})
+}
+
+// HandlerResendVerificationEmail sends the current user a new verification
+// link, for when the last one expired or never arrived.
+func (cfg *APIConfig) HandlerResendVerificationEmail(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	dbUser, err := cfg.DB.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Error retrieving user")
+		return
+	}
+
+	if dbUser.EmailVerifiedAt.Valid {
+		respondWithError(w, 409, "Email is already verified")
+		return
+	}
+
+	err = cfg.sendVerificationEmail(r.Context(), dbUser.ID, dbUser.Email)
+	if err != nil {
+		respondWithError(w, 500, "Error sending verification email")
+		return
+	}
+
+	respondWithMessage(w, 202, "Verification email sent")
+	return
+}
+
+func (cfg *APIConfig) HandlerVerifyEmail(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Token	string	`json:"token"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	input := Input{}
+
+	err := decoder.Decode(&input)
+	if err != nil {
+		respondWithError(w, 400, "Error decoding input")
+		return
+	}
+
+	userID, email, err := auth.ValidateEmailVerificationToken(input.Token, cfg.Secret)
+	if err != nil {
+		respondWithError(w, 400, "Invalid or expired verification token")
+		return
+	}
+
+	verified, err := cfg.DB.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+		ID:		userID,
+		Email:	email,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error verifying email")
+		return
+	}
+	if verified == 0 {
+		respondWithError(w, 400, "Invalid or expired verification token")
+		return
+	}
+
+	respondWithMessage(w, 200, "Email verified")
+	return
+}
@@ -0,0 +1,231 @@
+package api
+
+import (
+	"crypto/subtle"
+	"database/sql"
+	"log"
+	"net/http"
+	"time"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/database"
+	"github.com/kblasti/spellbook/internal/oidc"
+)
+
+// oidcStateExpirationTime is how long a user has to finish logging in at the
+// identity provider.
+const oidcStateExpirationTime = 10 * time.Minute
+
+// oidcStateCookie holds the login state in the browser that started the
+// login, so a callback can't be completed in someone else's browser.
+const oidcStateCookie = "spellbook_oidc_state"
+
+// setOIDCStateCookie binds state to the browser, or clears the binding when
+// state is empty.
+func (cfg *APIConfig) setOIDCStateCookie(w http.ResponseWriter, r *http.Request, state string) {
+	maxAge := int(oidcStateExpirationTime.Seconds())
+	if state == "" {
+		maxAge = -1
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:		oidcStateCookie,
+		Value:		state,
+		Path:		"/api/oidc",
+		MaxAge:		maxAge,
+		HttpOnly:	true,
+		Secure:		r.TLS != nil || (cfg.TrustProxyHeaders && r.Header.Get("X-Forwarded-Proto") == "https"),
+		SameSite:	http.SameSiteLaxMode,
+	})
+}
+
+func (cfg *APIConfig) HandlerOIDCLogin(w http.ResponseWriter, r *http.Request) {
+	type loginURLResponse struct {
+		AuthorizationURL	string	`json:"authorization_url"`
+	}
+
+	if cfg.OIDC == nil {
+		respondWithError(w, 404, "OIDC login is not configured")
+		return
+	}
+
+	authRequest, err := oidc.NewAuthRequest()
+	if err != nil {
+		respondWithError(w, 500, "Error starting login")
+		return
+	}
+
+	err = cfg.DB.DeleteExpiredOIDCLoginStates(r.Context())
+	if err != nil {
+		log.Printf("deleting expired oidc login states: %v", err)
+	}
+
+	err = cfg.DB.CreateOIDCLoginState(r.Context(), database.CreateOIDCLoginStateParams{
+		StateHash:		auth.HashToken(authRequest.State),
+		Nonce:			authRequest.Nonce,
+		CodeVerifier:	authRequest.CodeVerifier,
+		ExpiresAt:		time.Now().UTC().Add(oidcStateExpirationTime),
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error starting login")
+		return
+	}
+
+	cfg.setOIDCStateCookie(w, r, authRequest.State)
+	respondWithJSON(w, 200, loginURLResponse{
+		AuthorizationURL:	cfg.OIDC.AuthCodeURL(authRequest),
+	})
+	return
+}
+
+func (cfg *APIConfig) HandlerOIDCCallback(w http.ResponseWriter, r *http.Request) {
+	if cfg.OIDC == nil {
+		respondWithError(w, 404, "OIDC login is not configured")
+		return
+	}
+
+	query := r.URL.Query()
+
+	if providerErr := query.Get("error"); providerErr != "" {
+		respondWithError(w, 401, "Identity provider returned "+providerErr)
+		return
+	}
+
+	state := query.Get("state")
+	code := query.Get("code")
+	if state == "" || code == "" {
+		respondWithError(w, 400, "Missing state or code")
+		return
+	}
+
+	// The state has to come back to the browser that started the login,
+	// otherwise an attacker could log the victim into the attacker's account.
+	cookie, err := r.Cookie(oidcStateCookie)
+	if err != nil || subtle.ConstantTimeCompare([]byte(cookie.Value), []byte(state)) != 1 {
+		respondWithError(w, 400, "Login was started in a different browser")
+		return
+	}
+	cfg.setOIDCStateCookie(w, r, "")
+
+	// The state is single use, so a replayed callback fails here.
+	loginState, err := cfg.DB.ConsumeOIDCLoginState(r.Context(), auth.HashToken(state))
+	if err == sql.ErrNoRows {
+		respondWithError(w, 400, "Invalid or expired login state")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Something went wrong")
+		return
+	}
+
+	claims, err := cfg.OIDC.Exchange(r.Context(), code, loginState.Nonce, loginState.CodeVerifier)
+	if err != nil {
+		log.Printf("oidc code exchange: %v", err)
+		respondWithError(w, 401, "Error verifying identity")
+		return
+	}
+
+	dbUser, ok := cfg.userForIdentity(w, r, claims)
+	if !ok {
+		return
+	}
+
+	cfg.completeLogin(w, r, dbUser)
+	return
+}
+
+// userForIdentity returns the user linked to the provider identity in claims.
+// Unknown identities are linked to an existing account only if that account
+// has verified the same email address, or get a new account if there isn't
+// one. An unverified account could have been registered by anyone, who would
+// keep access through its password once the identity was linked. It reports
+// whether the handler should continue.
+func (cfg *APIConfig) userForIdentity(w http.ResponseWriter, r *http.Request, claims oidc.Claims) (database.User, bool) {
+	identity, err := cfg.DB.GetUserIdentity(r.Context(), database.GetUserIdentityParams{
+		Issuer:		cfg.OIDC.Issuer(),
+		Subject:	claims.Subject,
+	})
+	if err == nil {
+		err = cfg.DB.TouchUserIdentity(r.Context(), database.TouchUserIdentityParams{
+			ID:		identity.ID,
+			Email:	nullString(claims.Email),
+		})
+		if err != nil {
+			log.Printf("updating identity last login: %v", err)
+		}
+
+		dbUser, err := cfg.DB.GetUserByID(r.Context(), identity.UserID)
+		if err != nil {
+			respondWithError(w, 500, "Error retrieving user")
+			return dbUser, false
+		}
+		return dbUser, true
+	}
+	if err != sql.ErrNoRows {
+		respondWithError(w, 500, "Something went wrong")
+		return database.User{}, false
+	}
+
+	// Linking by email is only safe when the provider vouches for it.
+	if claims.Email == "" || !claims.EmailVerified {
+		respondWithError(w, 403, "Identity provider did not supply a verified email address")
+		return database.User{}, false
+	}
+
+	dbUser, err := cfg.DB.UserLogin(r.Context(), claims.Email)
+	if err == nil && !dbUser.EmailVerifiedAt.Valid {
+		respondWithError(w, 409, "An account with this email address exists but hasn't been verified. Log in with your password and verify your email before signing in with this provider")
+		return database.User{}, false
+	}
+	if err == sql.ErrNoRows {
+		dbUser, err = cfg.createIdentityUser(r, claims.Email)
+		if err == nil {
+			_, err = cfg.DB.VerifyUserEmail(r.Context(), database.VerifyUserEmailParams{
+				ID:		dbUser.ID,
+				Email:	dbUser.Email,
+			})
+		}
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error creating user")
+		return dbUser, false
+	}
+
+	_, err = cfg.DB.CreateUserIdentity(r.Context(), database.CreateUserIdentityParams{
+		UserID:		dbUser.ID,
+		Issuer:		cfg.OIDC.Issuer(),
+		Subject:	claims.Subject,
+		Email:		nullString(claims.Email),
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error linking identity")
+		return dbUser, false
+	}
+
+	return dbUser, true
+}
+
+// createIdentityUser creates an account for a new provider identity. It gets
+// a random password, which the user can replace through a password reset if
+// they later want to log in without the provider.
+func (cfg *APIConfig) createIdentityUser(r *http.Request, email string) (database.User, error) {
+	password, err := auth.MakeRefreshToken()
+	if err != nil {
+		return database.User{}, err
+	}
+
+	hashed, err := auth.HashPassword(password)
+	if err != nil {
+		return database.User{}, err
+	}
+
+	created, err := cfg.DB.CreateUser(r.Context(), database.CreateUserParams{
+		Email:			email,
+		HashedPassword:	hashed,
+		Role:			"user",
+	})
+	if err != nil {
+		return database.User{}, err
+	}
+
+	return cfg.DB.GetUserByID(r.Context(), created.ID)
+}
@@ -0,0 +1,53 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"github.com/kblasti/spellbook/internal/oidc"
+)
+
+func TestOIDCCallbackRequiresStateCookie(t *testing.T) {
+	cfg := &APIConfig{OIDC: &oidc.Provider{}}
+
+	cases := map[string]*http.Cookie{
+		"no cookie":		nil,
+		"other state":		{Name: oidcStateCookie, Value: "someone-elses-state"},
+		"empty cookie":		{Name: oidcStateCookie, Value: ""},
+	}
+	for name, cookie := range cases {
+		r := httptest.NewRequest("GET", "/api/oidc/callback?state=abc&code=xyz", nil)
+		if cookie != nil {
+			r.AddCookie(cookie)
+		}
+		w := httptest.NewRecorder()
+
+		cfg.HandlerOIDCCallback(w, r)
+
+		if w.Code != 400 {
+			t.Errorf("%s: status = %d, want 400", name, w.Code)
+		}
+	}
+}
+
+func TestSetOIDCStateCookie(t *testing.T) {
+	cfg := &APIConfig{}
+	r := httptest.NewRequest("GET", "/api/oidc/login", nil)
+
+	w := httptest.NewRecorder()
+	cfg.setOIDCStateCookie(w, r, "abc")
+	cookies := w.Result().Cookies()
+	if len(cookies) != 1 {
+		t.Fatalf("got %d cookies, want 1", len(cookies))
+	}
+	c := cookies[0]
+	if c.Value != "abc" || !c.HttpOnly || c.SameSite != http.SameSiteLaxMode || c.MaxAge <= 0 {
+		t.Errorf("state cookie = %+v", c)
+	}
+
+	w = httptest.NewRecorder()
+	cfg.setOIDCStateCookie(w, r, "")
+	if c := w.Result().Cookies()[0]; c.MaxAge >= 0 {
+		t.Errorf("clearing cookie has MaxAge %d", c.MaxAge)
+	}
+}
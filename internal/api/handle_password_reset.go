@@ -0,0 +1,173 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"time"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/database"
+	"github.com/kblasti/spellbook/internal/mail"
+)
+
+func (cfg *APIConfig) HandlerForgotPassword(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Email	string	`json:"email"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	input := Input{}
+
+	err := decoder.Decode(&input)
+	if err != nil {
+		respondWithError(w, 400, "Error decoding input")
+		return
+	}
+
+	// The response is the same whether or not the account exists so this
+	// endpoint can't be used to discover registered email addresses. The
+	// lookup and the email happen after responding, so how long they take
+	// doesn't give it away either.
+	go func(email string) {
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundMailTimeout)
+		defer cancel()
+
+		dbUser, err := cfg.DB.UserLogin(ctx, email)
+		if err == sql.ErrNoRows {
+			return
+		}
+		if err != nil {
+			log.Printf("looking up password reset user: %v", err)
+			return
+		}
+
+		err = cfg.sendPasswordResetEmail(ctx, dbUser, "Someone asked to reset the password for your Spellbook account.", "If this wasn't you, you can ignore this email.")
+		if err != nil {
+			log.Printf("saving password reset token: %v", err)
+		}
+	}(input.Email)
+
+	respondWithMessage(w, 202, "If an account with that email exists, a reset link has been sent")
+	return
+}
+
+// backgroundMailTimeout bounds work done after the response has been sent.
+const backgroundMailTimeout = 30 * time.Second
+
+// sendMailInBackground delivers msg without holding up the request, logging
+// any failure.
+func (cfg *APIConfig) sendMailInBackground(msg mail.Message) {
+	go func() {
+		ctx, cancel := context.WithTimeout(context.Background(), backgroundMailTimeout)
+		defer cancel()
+
+		if err := cfg.Mailer.Send(ctx, msg); err != nil {
+			log.Printf("sending %q email: %v", msg.Subject, err)
+		}
+	}()
+}
+
+// sendPasswordResetEmail replaces any outstanding reset tokens for dbUser
+// with a new one and emails it in the background. Only failing to save the
+// token is returned; mail delivery errors are logged.
+func (cfg *APIConfig) sendPasswordResetEmail(ctx context.Context, dbUser database.User, intro, outro string) error {
+	token, err := auth.MakeRefreshToken()
+	if err != nil {
+		return err
+	}
+
+	err = cfg.DB.InvalidatePasswordResetTokens(ctx, dbUser.ID)
+	if err != nil {
+		return err
+	}
+
+	_, err = cfg.DB.CreatePasswordResetToken(ctx, database.CreatePasswordResetTokenParams{
+		TokenHash:	auth.HashToken(token),
+		UserID:		dbUser.ID,
+	})
+	if err != nil {
+		return err
+	}
+
+	link := cfg.AppURL + "/reset-password?token=" + url.QueryEscape(token)
+	cfg.sendMailInBackground(mail.Message{
+		To:			dbUser.Email,
+		Subject:	"Reset your Spellbook password",
+		Body:		fmt.Sprintf("%s\n\nTo choose a new password, open this link within the next hour:\n%s\n\n%s", intro, link, outro),
+	})
+	return nil
+}
+
+func (cfg *APIConfig) HandlerResetPassword(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Token		string	`json:"token"`
+		Password	string	`json:"password"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	input := Input{}
+
+	err := decoder.Decode(&input)
+	if err != nil {
+		respondWithError(w, 400, "Error decoding input")
+		return
+	}
+
+	if len(input.Password) < 6 {
+		respondWithError(w, 400, "Password must be at least 6 characters")
+		return
+	}
+
+	hashed, err := auth.HashPassword(input.Password)
+	if err != nil {
+		respondWithError(w, 500, "Error hashing password")
+		return
+	}
+
+	// Using the token, changing the password and signing out every session
+	// happen together so a failure can't leave the token spent.
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		userID, err := q.ConsumePasswordResetToken(r.Context(), auth.HashToken(input.Token))
+		if err != nil {
+			return err
+		}
+
+		err = q.UpdateUserPassword(r.Context(), database.UpdateUserPasswordParams{
+			HashedPassword:	hashed,
+			ID:				userID,
+		})
+		if err != nil {
+			return err
+		}
+
+		if err := q.InvalidatePasswordResetTokens(r.Context(), userID); err != nil {
+			return err
+		}
+		if err := q.RevokeUserRefreshTokens(r.Context(), uuid.NullUUID{UUID: userID, Valid: true}); err != nil {
+			return err
+		}
+
+		return cfg.recordAudit(r, q, uuid.Nil, auditEvent{
+			Action:		auditUserPassword,
+			TargetType:	"user",
+			TargetID:	userID.String(),
+			Details:	map[string]string{"method": "reset_token"},
+		})
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, 400, "Invalid or expired reset token")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error updating password")
+		return
+	}
+
+	respondWithMessage(w, 200, "Password updated")
+	return
+}
@@ -0,0 +1,46 @@
+package api
+
+import (
+	"context"
+	"testing"
+	"time"
+	"github.com/kblasti/spellbook/internal/mail"
+)
+
+type blockingMailer struct {
+	release	chan struct{}
+	sent	chan error
+}
+
+func (m *blockingMailer) Send(ctx context.Context, msg mail.Message) error {
+	<-m.release
+	m.sent <- ctx.Err()
+	return nil
+}
+
+func TestSendMailInBackground(t *testing.T) {
+	mailer := &blockingMailer{release: make(chan struct{}), sent: make(chan error, 1)}
+	cfg := &APIConfig{Mailer: mailer}
+
+	done := make(chan struct{})
+	go func() {
+		cfg.sendMailInBackground(mail.Message{To: "someone@example.com", Subject: "Hello"})
+		close(done)
+	}()
+
+	select {
+	case <-done:
+	case <-time.After(time.Second):
+		t.Fatal("sendMailInBackground waited for the mailer")
+	}
+
+	close(mailer.release)
+	select {
+	case err := <-mailer.sent:
+		if err != nil {
+			t.Errorf("mail was sent with a finished context: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("mail was never sent")
+	}
+}
@@ -0,0 +1,86 @@
+package api
+
+import (
+	"net/http"
+	"time"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+// Session is one login of a user. Rotating the refresh token keeps the
+// session, so its ID is the refresh token family rather than the token.
+type Session struct {
+	ID			uuid.UUID		`json:"id"`
+	UserAgent	string			`json:"user_agent"`
+	IPAddress	string			`json:"ip_address"`
+	CreatedAt	time.Time		`json:"created_at"`
+	LastUsedAt	time.Time		`json:"last_used_at"`
+	ExpiresAt	time.Time		`json:"expires_at"`
+}
+
+func (cfg *APIConfig) HandlerGetSessions(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	sessions, err := cfg.DB.ListUserSessions(r.Context(), uuid.NullUUID{UUID: principal.UserID, Valid: true})
+	if err != nil {
+		respondWithError(w, 500, "Error getting sessions")
+		return
+	}
+
+	returnSlice := []Session{}
+
+	for _, session := range sessions {
+		val := Session{
+			ID:			session.FamilyID,
+			UserAgent:	session.UserAgent.String,
+			IPAddress:	session.IpAddress.String,
+			CreatedAt:	session.CreatedAt,
+			LastUsedAt:	session.LastUsedAt,
+			ExpiresAt:	session.ExpiresAt,
+		}
+		returnSlice = append(returnSlice, val)
+	}
+
+	respondWithJSON(w, 200, returnSlice)
+	return
+}
+
+func (cfg *APIConfig) HandlerRevokeSession(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	sessionID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid session ID")
+		return
+	}
+
+	revoked, err := cfg.DB.RevokeUserSession(r.Context(), database.RevokeUserSessionParams{
+		FamilyID:	sessionID,
+		UserID:		uuid.NullUUID{UUID: principal.UserID, Valid: true},
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error revoking session")
+		return
+	}
+	if revoked == 0 {
+		respondWithError(w, 404, "Session not found")
+		return
+	}
+
+	respondWithJSON(w, 204, nil)
+	return
+}
+
+func (cfg *APIConfig) HandlerRevokeAllSessions(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	err := cfg.DB.RevokeUserRefreshTokens(r.Context(), uuid.NullUUID{UUID: principal.UserID, Valid: true})
+	if err != nil {
+		respondWithError(w, 500, "Error revoking sessions")
+		return
+	}
+
+	respondWithJSON(w, 204, nil)
+	return
+}
@@ -0,0 +1,510 @@
+package api
+
+import (
+	"bytes"
+	"net/http"
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"io"
+	"mime"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/database"
+	"github.com/sqlc-dev/pqtype"
+)
+
+// spellIndexPattern matches lowercase hyphenated slugs such as "fire-bolt".
+var spellIndexPattern = regexp.MustCompile(`^[a-z0-9]+(-[a-z0-9]+)*$`)
+
+// spellSchools are the schools of magic a spell may belong to.
+var spellSchools = map[string]bool{
+	"abjuration":		true,
+	"conjuration":		true,
+	"divination":		true,
+	"enchantment":		true,
+	"evocation":		true,
+	"illusion":			true,
+	"necromancy":		true,
+	"transmutation":	true,
+}
+
+// spellComponents are the components a spell may require.
+var spellComponents = map[string]bool{
+	"V":	true,
+	"S":	true,
+	"M":	true,
+}
+
+// validateSpell checks the fields of a new or edited spell, returning the
+// problem with each invalid field keyed by its JSON name. The result is empty
+// when the spell is valid.
+func validateSpell(spell Spell) map[string]string {
+	errs := map[string]string{}
+
+	if !spellIndexPattern.MatchString(spell.Index) {
+		errs["index"] = "Must be a lowercase slug such as fire-bolt"
+	}
+	if strings.TrimSpace(spell.Name) == "" {
+		errs["name"] = "Is required"
+	}
+	if spell.Level < 0 || spell.Level > 9 {
+		errs["level"] = "Must be between 0 and 9"
+	}
+
+	var school struct {
+		Index	string	`json:"index"`
+		Name	string	`json:"name"`
+	}
+	if err := json.Unmarshal(spell.School, &school); err != nil || school.Index == "" {
+		errs["school"] = "Must be an object with an index"
+	} else if !spellSchools[school.Index] {
+		errs["school"] = "Unknown school " + school.Index
+	}
+
+	seen := map[string]bool{}
+	for _, component := range spell.Components {
+		if !spellComponents[component] {
+			errs["components"] = "May only contain V, S and M"
+			break
+		}
+		if seen[component] {
+			errs["components"] = "May not repeat " + component
+			break
+		}
+		seen[component] = true
+	}
+	if seen["M"] && strings.TrimSpace(spell.Material) == "" {
+		errs["material"] = "Is required when components include M"
+	}
+	if !seen["M"] && spell.Material != "" {
+		errs["material"] = "Must be empty unless components include M"
+	}
+
+	if msg := validateSpellDamage(spell.Damage); msg != "" {
+		errs["damage"] = msg
+	}
+
+	return errs
+}
+
+// validateSpellDamage checks the shape of a spell's damage, which is either
+// absent or an object with an optional damage type and a table of damage
+// keyed by slot or character level.
+func validateSpellDamage(data json.RawMessage) string {
+	if len(data) == 0 || string(data) == "null" {
+		return ""
+	}
+
+	var damage struct {
+		DamageType				json.RawMessage		`json:"damage_type"`
+		DamageAtSlotLevel		map[string]string	`json:"damage_at_slot_level"`
+		DamageAtCharacterLevel	map[string]string	`json:"damage_at_character_level"`
+	}
+	if err := json.Unmarshal(data, &damage); err != nil {
+		return "Must be an object with damage_type and a damage_at_slot_level or damage_at_character_level table of strings"
+	}
+
+	if len(damage.DamageType) > 0 {
+		var damageType struct {
+			Index	string	`json:"index"`
+		}
+		if err := json.Unmarshal(damage.DamageType, &damageType); err != nil || damageType.Index == "" {
+			return "damage_type must be an object with an index"
+		}
+	}
+
+	for _, table := range []map[string]string{damage.DamageAtSlotLevel, damage.DamageAtCharacterLevel} {
+		for level := range table {
+			if n, err := strconv.Atoi(level); err != nil || n < 0 || n > 20 {
+				return "Damage tables must be keyed by level"
+			}
+		}
+	}
+
+	return ""
+}
+
+// spellFromRow converts a spell read back from the database.
+func spellFromRow(spell database.GetSpellRow) Spell {
+	return Spell{
+		Index:			spell.Index,
+		Name:			spell.Name,
+		Range:			spell.Range.String,
+		Material:		spell.Material.String,
+		Ritual:			spell.Ritual.Bool,
+		Duration:		spell.Duration.String,
+		Concentration:	spell.Concentration.Bool,
+		CastingTime:	spell.CastingTime.String,
+		Level:			spell.Level.Int32,
+		AttackType:		spell.AttackType.String,
+		School:			spell.School.RawMessage,
+		Desc:			spell.Desc,
+		HigherLevel:	spell.HigherLevel,
+		Components:		spell.Components,
+		Damage:			spell.Damage.RawMessage,
+	}
+}
+
+// spellCreateParams converts a validated spell into the columns to insert.
+func spellCreateParams(spell Spell) database.CreateSpellParams {
+	return database.CreateSpellParams{
+		Index:			spell.Index,
+		Name:			spell.Name,
+		Range:			sql.NullString{String: spell.Range, Valid: true},
+		Material:		sql.NullString{String: spell.Material, Valid: true},
+		Ritual:			sql.NullBool{Bool: spell.Ritual, Valid: true},
+		Duration:		sql.NullString{String: spell.Duration, Valid: true},
+		Concentration:	sql.NullBool{Bool: spell.Concentration, Valid: true},
+		CastingTime:	sql.NullString{String: spell.CastingTime, Valid: true},
+		Level:			sql.NullInt32{Int32: spell.Level, Valid: true},
+		AttackType:		sql.NullString{String: spell.AttackType, Valid: true},
+		School:			pqtype.NullRawMessage{RawMessage: spell.School, Valid: true},
+		Desc:			spell.Desc,
+		HigherLevel:	spell.HigherLevel,
+		Components:		spell.Components,
+		Damage:			pqtype.NullRawMessage{RawMessage: spell.Damage, Valid: len(spell.Damage) > 0},
+		Url:			"/api/spells/" + spell.Index,
+	}
+}
+
+// spellUpdateParams converts a validated spell into the columns to update.
+func spellUpdateParams(spell Spell) database.UpdateSpellParams {
+	return database.UpdateSpellParams{
+		Name:			spell.Name,
+		Range:			sql.NullString{String: spell.Range, Valid: true},
+		Material:		sql.NullString{String: spell.Material, Valid: true},
+		Ritual:			sql.NullBool{Bool: spell.Ritual, Valid: true},
+		Duration:		sql.NullString{String: spell.Duration, Valid: true},
+		Concentration:	sql.NullBool{Bool: spell.Concentration, Valid: true},
+		CastingTime:	sql.NullString{String: spell.CastingTime, Valid: true},
+		Level:			sql.NullInt32{Int32: spell.Level, Valid: true},
+		AttackType:		sql.NullString{String: spell.AttackType, Valid: true},
+		School:			pqtype.NullRawMessage{RawMessage: spell.School, Valid: true},
+		Desc:			spell.Desc,
+		HigherLevel:	spell.HigherLevel,
+		Components:		spell.Components,
+		Damage:			pqtype.NullRawMessage{RawMessage: spell.Damage, Valid: len(spell.Damage) > 0},
+		Index:			spell.Index,
+	}
+}
+
+func (cfg *APIConfig) HandlerCreateSpell(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	decoder := json.NewDecoder(r.Body)
+	input := Spell{}
+
+	err := decoder.Decode(&input)
+	if err != nil {
+		respondWithError(w, 400, "Error decoding input")
+		return
+	}
+
+	if errs := validateSpell(input); len(errs) > 0 {
+		respondWithFieldErrors(w, errs)
+		return
+	}
+
+	// The unique index on spells, not a lookup beforehand, decides whether
+	// the index is taken, so two concurrent creates can't both succeed.
+	var val Spell
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		if err := q.LockSpellIndex(r.Context(), input.Index); err != nil {
+			return err
+		}
+		if _, err := q.CreateSpell(r.Context(), spellCreateParams(input)); err != nil {
+			return err
+		}
+		current, err := q.GetSpell(r.Context(), input.Index)
+		if err != nil {
+			return err
+		}
+		val = spellFromRow(current)
+		return cfg.recordSpellChange(r, q, principal.UserID, spellRevisionCreate, nil, &val, nil)
+	})
+	if isUniqueViolation(err) {
+		respondWithError(w, 409, "A spell with that index already exists")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error creating spell")
+		return
+	}
+
+	respondWithJSON(w, 201, val)
+	return
+}
+
+// HandlerDeleteSpell removes a spell. The schema's ON DELETE CASCADE
+// foreign keys remove it from class and subclass lists and any character
+// spellbooks it appears in.
+func (cfg *APIConfig) HandlerDeleteSpell(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	index := r.PathValue("index")
+
+	err := cfg.inTx(r.Context(), func(q *database.Queries) error {
+		if err := q.LockSpellIndex(r.Context(), index); err != nil {
+			return err
+		}
+		current, err := q.GetSpell(r.Context(), index)
+		if err != nil {
+			return err
+		}
+		if _, err := q.DeleteSpell(r.Context(), index); err != nil {
+			return err
+		}
+		before := spellFromRow(current)
+		return cfg.recordSpellChange(r, q, principal.UserID, spellRevisionDelete, &before, nil, nil)
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, 404, "Spell not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error deleting spell")
+		return
+	}
+
+	respondWithMessage(w, 200, "Spell deleted")
+	return
+}
+
+// Reasons applySpellPatch rejects a patch.
+var (
+	errInvalidPatch	= errors.New("invalid patch")
+	errPatchInvalid	= errors.New("patched spell is invalid")
+)
+
+// spellRequiredFields can't be removed with a null in a patch.
+var spellRequiredFields = map[string]bool{
+	"name":		true,
+	"level":	true,
+	"school":	true,
+}
+
+// applySpellPatch merges patch into the current spell and validates the
+// result. The update it returns only touches the columns named in the patch:
+// a null stores NULL, and every other column is written back exactly as it
+// was read, NULLs included. Field problems are returned as errs, with
+// errPatchInvalid.
+func applySpellPatch(current database.GetSpellRow, patch []byte) (Spell, database.UpdateSpellParams, map[string]string, error) {
+	var patchFields map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &patchFields); err != nil || patchFields == nil {
+		return Spell{}, database.UpdateSpellParams{}, nil, errInvalidPatch
+	}
+
+	index := current.Index
+	currentJSON, err := json.Marshal(spellFromRow(current))
+	if err != nil {
+		return Spell{}, database.UpdateSpellParams{}, nil, err
+	}
+
+	errs := map[string]string{}
+
+	var known map[string]json.RawMessage
+	json.Unmarshal(currentJSON, &known)
+	for field, value := range patchFields {
+		if _, ok := known[field]; !ok {
+			errs[field] = "Unknown field"
+		} else if spellRequiredFields[field] && isJSONNull(value) {
+			errs[field] = "Can't be removed"
+		}
+	}
+	if value, ok := patchFields["index"]; ok {
+		var newIndex string
+		if json.Unmarshal(value, &newIndex) != nil || newIndex != index {
+			errs["index"] = "Can't be changed"
+		}
+	}
+
+	merged, err := mergePatch(currentJSON, patch)
+	if err != nil {
+		return Spell{}, database.UpdateSpellParams{}, nil, errInvalidPatch
+	}
+
+	// json.Unmarshal only reports the first type mismatch, so each patched
+	// field is decoded on its own to find them all.
+	var mergedFields map[string]json.RawMessage
+	if err := json.Unmarshal(merged, &mergedFields); err != nil {
+		return Spell{}, database.UpdateSpellParams{}, nil, errInvalidPatch
+	}
+	for field := range patchFields {
+		value, ok := mergedFields[field]
+		if _, reported := errs[field]; reported || !ok {
+			continue
+		}
+		fieldJSON, err := json.Marshal(map[string]json.RawMessage{field: value})
+		if err != nil {
+			return Spell{}, database.UpdateSpellParams{}, nil, err
+		}
+		var typeErr *json.UnmarshalTypeError
+		if err := json.Unmarshal(fieldJSON, &Spell{}); errors.As(err, &typeErr) {
+			errs[field] = "Must be a " + typeErr.Type.String()
+		}
+	}
+
+	// Fields with a type error are left at their zero value, which the
+	// validation below ignores in favour of the type error.
+	input := Spell{}
+	if err := json.Unmarshal(merged, &input); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if !errors.As(err, &typeErr) {
+			return Spell{}, database.UpdateSpellParams{}, nil, errInvalidPatch
+		}
+	}
+	input.Index = index
+
+	for field, msg := range validateSpell(input) {
+		if _, reported := errs[field]; !reported {
+			errs[field] = msg
+		}
+	}
+	if len(errs) > 0 {
+		return input, database.UpdateSpellParams{}, errs, errPatchInvalid
+	}
+
+	params := database.UpdateSpellParams{
+		Name:			current.Name,
+		Range:			current.Range,
+		Material:		current.Material,
+		Ritual:			current.Ritual,
+		Duration:		current.Duration,
+		Concentration:	current.Concentration,
+		CastingTime:	current.CastingTime,
+		Level:			current.Level,
+		AttackType:		current.AttackType,
+		School:			current.School,
+		Desc:			current.Desc,
+		HigherLevel:	current.HigherLevel,
+		Components:		current.Components,
+		Damage:			current.Damage,
+		Index:			index,
+	}
+	for field, value := range patchFields {
+		set := !isJSONNull(value)
+		switch field {
+		case "name":
+			params.Name = input.Name
+		case "range":
+			params.Range = sql.NullString{String: input.Range, Valid: set}
+		case "material":
+			params.Material = sql.NullString{String: input.Material, Valid: set}
+		case "ritual":
+			params.Ritual = sql.NullBool{Bool: input.Ritual, Valid: set}
+		case "duration":
+			params.Duration = sql.NullString{String: input.Duration, Valid: set}
+		case "concentration":
+			params.Concentration = sql.NullBool{Bool: input.Concentration, Valid: set}
+		case "casting_time":
+			params.CastingTime = sql.NullString{String: input.CastingTime, Valid: set}
+		case "level":
+			params.Level = sql.NullInt32{Int32: input.Level, Valid: set}
+		case "attack_type":
+			params.AttackType = sql.NullString{String: input.AttackType, Valid: set}
+		case "school":
+			params.School = pqtype.NullRawMessage{RawMessage: input.School, Valid: set}
+		case "desc":
+			params.Desc = input.Desc
+		case "higher_level":
+			params.HigherLevel = input.HigherLevel
+		case "components":
+			params.Components = input.Components
+		case "damage":
+			params.Damage = pqtype.NullRawMessage{RawMessage: input.Damage, Valid: set}
+		}
+	}
+
+	return input, params, nil, nil
+}
+
+func isJSONNull(value json.RawMessage) bool {
+	return string(bytes.TrimSpace(value)) == "null"
+}
+
+// HandlerPatchSpell applies a JSON Merge Patch to a spell. Fields missing
+// from the patch keep their current value and null clears them, except for
+// the name, level and school, which every spell needs. Every invalid field
+// is reported at once with a 422.
+func (cfg *APIConfig) HandlerPatchSpell(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	index := r.PathValue("index")
+
+	if contentType := r.Header.Get("Content-Type"); contentType != "" {
+		mediaType, _, err := mime.ParseMediaType(contentType)
+		if err != nil || (mediaType != "application/merge-patch+json" && mediaType != "application/json") {
+			respondWithError(w, 415, "Patch must be application/merge-patch+json")
+			return
+		}
+	}
+
+	patch, err := io.ReadAll(r.Body)
+	if err != nil {
+		respondWithError(w, 400, "Error reading patch")
+		return
+	}
+
+	var patchFields map[string]json.RawMessage
+	if err := json.Unmarshal(patch, &patchFields); err != nil || patchFields == nil {
+		respondWithError(w, 400, "Patch must be a JSON object")
+		return
+	}
+
+	fields := make([]string, 0, len(patchFields))
+	for field := range patchFields {
+		fields = append(fields, field)
+	}
+	sort.Strings(fields)
+
+	// The spell is read with a row lock so concurrent patches apply one
+	// after the other instead of overwriting each other.
+	var val Spell
+	var fieldErrs map[string]string
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		if err := q.LockSpellIndex(r.Context(), index); err != nil {
+			return err
+		}
+		current, err := q.GetSpellForUpdate(r.Context(), index)
+		if err != nil {
+			return err
+		}
+		before := spellFromRow(database.GetSpellRow(current))
+
+		_, params, errs, err := applySpellPatch(database.GetSpellRow(current), patch)
+		if err != nil {
+			fieldErrs = errs
+			return err
+		}
+
+		spell, err := q.UpdateSpell(r.Context(), params)
+		if err != nil {
+			return err
+		}
+		val = spellFromRow(database.GetSpellRow(spell))
+		return cfg.recordSpellChange(r, q, principal.UserID, spellRevisionUpdate, &before, &val, map[string][]string{
+			"fields":	fields,
+		})
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, 404, "Spell not found")
+		return
+	}
+	if errors.Is(err, errPatchInvalid) {
+		respondWithFieldErrors(w, fieldErrs)
+		return
+	}
+	if errors.Is(err, errInvalidPatch) {
+		respondWithError(w, 400, "Error applying patch")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error updating spell")
+		return
+	}
+
+	respondWithJSON(w, 200, val)
+	return
+}
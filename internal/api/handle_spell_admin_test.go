@@ -0,0 +1,234 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"github.com/kblasti/spellbook/internal/database"
+	"github.com/lib/pq"
+	"github.com/sqlc-dev/pqtype"
+)
+
+func TestValidateSpell(t *testing.T) {
+	valid := Spell{
+		Index:		"fire-bolt",
+		Name:		"Fire Bolt",
+		Level:		0,
+		School:		json.RawMessage(`{"index": "evocation", "name": "Evocation"}`),
+		Components:	[]string{"V", "S"},
+		Damage:		json.RawMessage(`{"damage_type": {"index": "fire"}, "damage_at_character_level": {"1": "1d10", "5": "2d10"}}`),
+	}
+
+	tests := []struct {
+		name	string
+		modify	func(*Spell)
+		field	string
+	}{
+		{"valid", func(s *Spell) {}, ""},
+		{"ninth level", func(s *Spell) { s.Level = 9 }, ""},
+		{"no damage", func(s *Spell) { s.Damage = nil }, ""},
+		{"material component", func(s *Spell) { s.Components = []string{"V", "M"}; s.Material = "A bit of bat fur" }, ""},
+		{"empty index", func(s *Spell) { s.Index = "" }, "index"},
+		{"uppercase index", func(s *Spell) { s.Index = "Fire-Bolt" }, "index"},
+		{"spaces in index", func(s *Spell) { s.Index = "fire bolt" }, "index"},
+		{"trailing hyphen", func(s *Spell) { s.Index = "fire-bolt-" }, "index"},
+		{"missing name", func(s *Spell) { s.Name = " " }, "name"},
+		{"negative level", func(s *Spell) { s.Level = -1 }, "level"},
+		{"level too high", func(s *Spell) { s.Level = 10 }, "level"},
+		{"unknown school", func(s *Spell) { s.School = json.RawMessage(`{"index": "chronurgy"}`) }, "school"},
+		{"school as string", func(s *Spell) { s.School = json.RawMessage(`"evocation"`) }, "school"},
+		{"missing school", func(s *Spell) { s.School = nil }, "school"},
+		{"unknown component", func(s *Spell) { s.Components = []string{"V", "X"} }, "components"},
+		{"repeated component", func(s *Spell) { s.Components = []string{"V", "V"} }, "components"},
+		{"material missing", func(s *Spell) { s.Components = []string{"M"} }, "material"},
+		{"material without component", func(s *Spell) { s.Material = "A pinch of salt" }, "material"},
+		{"damage as string", func(s *Spell) { s.Damage = json.RawMessage(`"1d10"`) }, "damage"},
+		{"damage type without index", func(s *Spell) { s.Damage = json.RawMessage(`{"damage_type": {}}`) }, "damage"},
+		{"damage table of numbers", func(s *Spell) { s.Damage = json.RawMessage(`{"damage_at_slot_level": {"1": 6}}`) }, "damage"},
+		{"damage table not keyed by level", func(s *Spell) { s.Damage = json.RawMessage(`{"damage_at_slot_level": {"first": "1d6"}}`) }, "damage"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			spell := valid
+			tt.modify(&spell)
+			errs := validateSpell(spell)
+			if tt.field == "" {
+				if len(errs) > 0 {
+					t.Errorf("validateSpell() = %v, want no errors", errs)
+				}
+				return
+			}
+			if _, ok := errs[tt.field]; !ok || len(errs) != 1 {
+				t.Errorf("validateSpell() = %v, want an error for %s only", errs, tt.field)
+			}
+		})
+	}
+}
+
+func TestValidateSpellReportsEveryField(t *testing.T) {
+	errs := validateSpell(Spell{Index: "Bad Index", Level: 12, Components: []string{"M"}})
+	for _, field := range []string{"index", "name", "level", "school", "material"} {
+		if _, ok := errs[field]; !ok {
+			t.Errorf("missing error for %s in %v", field, errs)
+		}
+	}
+}
+
+func TestPatchSpellRejectsBadRequests(t *testing.T) {
+	cfg := &APIConfig{}
+
+	tests := []struct {
+		name		string
+		contentType	string
+		body		string
+		want		int
+	}{
+		{"wrong content type", "text/plain", `{"name": "Fire Bolt"}`, http.StatusUnsupportedMediaType},
+		{"array patch", "application/merge-patch+json", `["name"]`, http.StatusBadRequest},
+		{"null patch", "application/merge-patch+json", `null`, http.StatusBadRequest},
+		{"invalid json", "application/json", `{"name":`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("PATCH", "/api/spells/fire-bolt", strings.NewReader(tt.body))
+			req.Header.Set("Content-Type", tt.contentType)
+			req.SetPathValue("index", "fire-bolt")
+			rec := httptest.NewRecorder()
+
+			cfg.HandlerPatchSpell(rec, req)
+
+			if rec.Code != tt.want {
+				t.Errorf("status = %d, want %d", rec.Code, tt.want)
+			}
+		})
+	}
+}
+
+func TestIsUniqueViolation(t *testing.T) {
+	tests := []struct {
+		name	string
+		err		error
+		want	bool
+	}{
+		{"unique violation", &pq.Error{Code: "23505"}, true},
+		{"wrapped", fmt.Errorf("creating spell: %w", &pq.Error{Code: "23505"}), true},
+		{"foreign key violation", &pq.Error{Code: "23503"}, false},
+		{"other error", sql.ErrNoRows, false},
+		{"no error", nil, false},
+	}
+
+	for _, tt := range tests {
+		if got := isUniqueViolation(tt.err); got != tt.want {
+			t.Errorf("%s: isUniqueViolation() = %v, want %v", tt.name, got, tt.want)
+		}
+	}
+}
+
+func TestApplySpellPatch(t *testing.T) {
+	// Range and ritual are NULL in the database, as imported data can be.
+	current := database.GetSpellRow{
+		Index:			"fire-bolt",
+		Name:			"Fire Bolt",
+		Duration:		sql.NullString{String: "Instantaneous", Valid: true},
+		Level:			sql.NullInt32{Int32: 0, Valid: true},
+		AttackType:		sql.NullString{String: "ranged", Valid: true},
+		School:			pqtype.NullRawMessage{RawMessage: json.RawMessage(`{"index": "evocation", "name": "Evocation"}`), Valid: true},
+		Components:		[]string{"V", "S"},
+		Damage:			pqtype.NullRawMessage{RawMessage: json.RawMessage(`{"damage_type": {"index": "fire"}}`), Valid: true},
+	}
+
+	t.Run("untouched columns keep their NULLs", func(t *testing.T) {
+		_, params, errs, err := applySpellPatch(current, []byte(`{"name": "Firebolt"}`))
+		if err != nil {
+			t.Fatal(err, errs)
+		}
+		if params.Name != "Firebolt" {
+			t.Errorf("name = %q", params.Name)
+		}
+		if params.Range.Valid || params.Ritual.Valid || params.Material.Valid {
+			t.Errorf("NULL columns were filled in: %+v", params)
+		}
+		if params.Duration != current.Duration || params.AttackType != current.AttackType {
+			t.Errorf("untouched columns changed: %+v", params)
+		}
+	})
+
+	t.Run("null clears optional fields", func(t *testing.T) {
+		_, params, errs, err := applySpellPatch(current, []byte(`{"attack_type": null, "damage": null}`))
+		if err != nil {
+			t.Fatal(err, errs)
+		}
+		if params.AttackType.Valid || params.Damage.Valid {
+			t.Errorf("attack_type and damage should be NULL: %+v", params)
+		}
+	})
+
+	t.Run("values are set", func(t *testing.T) {
+		_, params, errs, err := applySpellPatch(current, []byte(`{"range": "120 feet", "ritual": false, "level": 1}`))
+		if err != nil {
+			t.Fatal(err, errs)
+		}
+		if params.Range != (sql.NullString{String: "120 feet", Valid: true}) {
+			t.Errorf("range = %+v", params.Range)
+		}
+		if params.Ritual != (sql.NullBool{Bool: false, Valid: true}) {
+			t.Errorf("ritual = %+v", params.Ritual)
+		}
+		if params.Level != (sql.NullInt32{Int32: 1, Valid: true}) {
+			t.Errorf("level = %+v", params.Level)
+		}
+	})
+
+	t.Run("required fields can't be removed", func(t *testing.T) {
+		_, _, errs, err := applySpellPatch(current, []byte(`{"level": null, "name": null, "school": null}`))
+		if !errors.Is(err, errPatchInvalid) {
+			t.Fatalf("err = %v, want errPatchInvalid", err)
+		}
+		for _, field := range []string{"level", "name", "school"} {
+			if _, ok := errs[field]; !ok {
+				t.Errorf("missing error for %s in %v", field, errs)
+			}
+		}
+	})
+
+	t.Run("invalid values", func(t *testing.T) {
+		_, _, errs, err := applySpellPatch(current, []byte(`{"components": ["V", "M"], "level": "three", "colour": "red"}`))
+		if !errors.Is(err, errPatchInvalid) {
+			t.Fatalf("err = %v, want errPatchInvalid", err)
+		}
+		for _, field := range []string{"level", "colour"} {
+			if _, ok := errs[field]; !ok {
+				t.Errorf("missing error for %s in %v", field, errs)
+			}
+		}
+	})
+
+	t.Run("every error is reported", func(t *testing.T) {
+		patch := `{"colour": "red", "level": "three", "ritual": "yes", "components": ["V", "X"], "material": "A feather"}`
+		_, _, errs, err := applySpellPatch(current, []byte(patch))
+		if !errors.Is(err, errPatchInvalid) {
+			t.Fatalf("err = %v, want errPatchInvalid", err)
+		}
+		for _, field := range []string{"colour", "level", "ritual", "components", "material"} {
+			if _, ok := errs[field]; !ok {
+				t.Errorf("missing error for %s in %v", field, errs)
+			}
+		}
+		if !strings.HasPrefix(errs["level"], "Must be a") {
+			t.Errorf("level error = %q, want the type error", errs["level"])
+		}
+	})
+
+	t.Run("not an object", func(t *testing.T) {
+		if _, _, _, err := applySpellPatch(current, []byte(`[1]`)); !errors.Is(err, errInvalidPatch) {
+			t.Errorf("err = %v, want errInvalidPatch", err)
+		}
+	})
+}
@@ -0,0 +1,107 @@
+package api
+
+import (
+	"bytes"
+	"database/sql"
+	"fmt"
+	"net/http"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/database"
+	"github.com/kblasti/spellbook/internal/spellcards"
+)
+
+// spellCard lays out a spell the way the printed cards show it. footer is
+// printed along the bottom edge, such as the character's name.
+func spellCard(spell Spell, footer string) spellcards.Card {
+	card := spellcards.Card{
+		Name:		spell.Name,
+		Subtitle:	spellLevelSchool(spell),
+		Stats:		[]spellcards.Stat{
+			{Label: "Casting Time", Value: spell.CastingTime},
+			{Label: "Range", Value: spell.Range},
+			{Label: "Components", Value: spellComponentsText(spell)},
+			{Label: "Duration", Value: spellDuration(spell)},
+		},
+		Footer:		footer,
+	}
+
+	for _, paragraph := range spell.Desc {
+		card.Body = append(card.Body, spellcards.Paragraph{Text: paragraph})
+	}
+	for i, paragraph := range spell.HigherLevel {
+		p := spellcards.Paragraph{Text: paragraph}
+		if i == 0 {
+			p.Lead = "At Higher Levels."
+		}
+		card.Body = append(card.Body, p)
+	}
+
+	return card
+}
+
+// respondWithSpellCards renders cards and sends them as a PDF. The PDF is
+// built in memory first so a failure can still be reported as an error.
+func respondWithSpellCards(w http.ResponseWriter, filename string, cards []spellcards.Card) {
+	var buf bytes.Buffer
+	if err := spellcards.Render(&buf, cards); err != nil {
+		respondWithError(w, 500, "Error rendering spell cards")
+		return
+	}
+
+	w.Header().Set("Content-Type", "application/pdf")
+	w.Header().Set("Content-Disposition", fmt.Sprintf(`inline; filename="%s"`, filename))
+	w.WriteHeader(200)
+	w.Write(buf.Bytes())
+}
+
+// HandlerGetCharacterSpellCards prints a card for every spell the
+// character knows, in level order.
+func (cfg *APIConfig) HandlerGetCharacterSpellCards(w http.ResponseWriter, r *http.Request) {
+	principal, ok := cfg.authorize(w, r, auth.ScopeCharactersRead)
+	if !ok {
+		return
+	}
+
+	charID, err := uuid.Parse(r.PathValue("id"))
+	if err != nil {
+		respondWithError(w, 400, "Invalid character ID")
+		return
+	}
+
+	character, ok := cfg.loadOwnedCharacter(w, r, principal.UserID, charID)
+	if !ok {
+		return
+	}
+
+	cards := []spellcards.Card{}
+	err = cfg.DB.ExportSpells(r.Context(), database.SpellFilter{
+		CharacterID:	uuid.NullUUID{UUID: charID, Valid: true},
+	}, database.Page{Sort: "level"}, func(spell database.GetSpellRow) error {
+		cards = append(cards, spellCard(spellFromRow(spell), character.Name))
+		return nil
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error getting spells")
+		return
+	}
+
+	respondWithSpellCards(w, "spellcards.pdf", cards)
+	return
+}
+
+// HandlerGetSpellCard prints the card for a single spell.
+func (cfg *APIConfig) HandlerGetSpellCard(w http.ResponseWriter, r *http.Request) {
+	spell, err := cfg.DB.GetSpell(r.Context(), r.PathValue("index"))
+	if err == sql.ErrNoRows {
+		respondWithError(w, 404, "Spell not found")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error getting spell")
+		return
+	}
+
+	respondWithSpellCards(w, spell.Index+".pdf", []spellcards.Card{spellCard(spellFromRow(spell), "")})
+	return
+}
@@ -0,0 +1,31 @@
+package api
+
+import (
+	"testing"
+)
+
+func TestSpellCard(t *testing.T) {
+	card := spellCard(fireball, "Elminster")
+
+	if card.Name != "Fireball" || card.Subtitle != "3rd-level Evocation" || card.Footer != "Elminster" {
+		t.Errorf("card header = %q %q %q", card.Name, card.Subtitle, card.Footer)
+	}
+
+	stats := map[string]string{}
+	for _, stat := range card.Stats {
+		stats[stat.Label] = stat.Value
+	}
+	if stats["Components"] != "V, S, M (A tiny ball of bat guano and sulfur.)" {
+		t.Errorf("components = %q", stats["Components"])
+	}
+	if stats["Casting Time"] != "1 action" || stats["Range"] != "150 feet" || stats["Duration"] != "Instantaneous" {
+		t.Errorf("stats = %v", stats)
+	}
+
+	if len(card.Body) != 3 {
+		t.Fatalf("got %d paragraphs, want the description and higher levels", len(card.Body))
+	}
+	if card.Body[0].Lead != "" || card.Body[2].Lead != "At Higher Levels." {
+		t.Errorf("leads = %q, %q", card.Body[0].Lead, card.Body[2].Lead)
+	}
+}
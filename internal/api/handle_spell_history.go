@@ -0,0 +1,322 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"time"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+// Spell revision actions. Revisions recorded by the migration that added
+// history use "import".
+const (
+	spellRevisionCreate	= "create"
+	spellRevisionUpdate	= "update"
+	spellRevisionDelete	= "delete"
+	spellRevisionRevert	= "revert"
+)
+
+type SpellRevision struct {
+	Revision	int32				`json:"revision"`
+	Action		string				`json:"action"`
+	EditorID	*uuid.UUID			`json:"editor_id"`
+	CreatedAt	time.Time			`json:"created_at"`
+	Snapshot	json.RawMessage		`json:"snapshot,omitempty"`
+}
+
+// SpellFieldChange is one field that differs between two revisions.
+type SpellFieldChange struct {
+	Field		string				`json:"field"`
+	From		json.RawMessage		`json:"from"`
+	To			json.RawMessage		`json:"to"`
+}
+
+// saveSpellRevision appends a full snapshot of spell to its history. It
+// should run in the same transaction as the change it records, after
+// LockSpellIndex, so two changes can't both take the next revision number.
+func saveSpellRevision(ctx context.Context, q *database.Queries, editorID uuid.UUID, action string, spell Spell) error {
+	snapshot, err := json.Marshal(spell)
+	if err != nil {
+		return err
+	}
+
+	_, err = q.CreateSpellRevision(ctx, database.CreateSpellRevisionParams{
+		SpellIndex:	spell.Index,
+		EditorID:	uuid.NullUUID{UUID: editorID, Valid: editorID != uuid.Nil},
+		Action:		action,
+		Snapshot:	snapshot,
+	})
+	return err
+}
+
+// spellAuditActions maps each revision action to the audit action for it.
+var spellAuditActions = map[string]string{
+	spellRevisionCreate:	auditSpellCreate,
+	spellRevisionUpdate:	auditSpellUpdate,
+	spellRevisionDelete:	auditSpellDelete,
+	spellRevisionRevert:	auditSpellRevert,
+}
+
+// recordSpellChange saves the revision for a change to a spell and audits
+// it, using the transaction making the change. before is nil for a new spell
+// and after is nil for a deleted one, whose final text is kept as its last
+// revision so it can be restored.
+func (cfg *APIConfig) recordSpellChange(r *http.Request, q *database.Queries, editorID uuid.UUID, action string, before, after *Spell, details interface{}) error {
+	event := auditEvent{
+		Action:		spellAuditActions[action],
+		TargetType:	"spell",
+		Details:	details,
+	}
+
+	snapshot := after
+	if before != nil {
+		event.Before = before
+		snapshot = before
+	}
+	if after != nil {
+		event.After = after
+		snapshot = after
+	}
+	event.TargetID = snapshot.Index
+
+	if err := saveSpellRevision(r.Context(), q, editorID, action, *snapshot); err != nil {
+		return err
+	}
+	return cfg.recordAudit(r, q, editorID, event)
+}
+
+// diffSpellSnapshots lists the top-level fields that differ between two
+// snapshots, sorted by field name. Fields are compared by value, so key
+// order and formatting don't count as changes.
+func diffSpellSnapshots(from, to json.RawMessage) ([]SpellFieldChange, error) {
+	var fromFields, toFields map[string]json.RawMessage
+	if err := json.Unmarshal(from, &fromFields); err != nil {
+		return nil, err
+	}
+	if err := json.Unmarshal(to, &toFields); err != nil {
+		return nil, err
+	}
+
+	fields := map[string]bool{}
+	for field := range fromFields {
+		fields[field] = true
+	}
+	for field := range toFields {
+		fields[field] = true
+	}
+
+	changes := []SpellFieldChange{}
+	for field := range fields {
+		fromValue, toValue := jsonValue(fromFields[field]), jsonValue(toFields[field])
+
+		var a, b interface{}
+		if err := json.Unmarshal(fromValue, &a); err != nil {
+			return nil, err
+		}
+		if err := json.Unmarshal(toValue, &b); err != nil {
+			return nil, err
+		}
+		if reflect.DeepEqual(a, b) {
+			continue
+		}
+
+		changes = append(changes, SpellFieldChange{
+			Field:	field,
+			From:	fromValue,
+			To:		toValue,
+		})
+	}
+
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Field < changes[j].Field
+	})
+	return changes, nil
+}
+
+// jsonValue treats a missing field as null.
+func jsonValue(value json.RawMessage) json.RawMessage {
+	if len(value) == 0 {
+		return json.RawMessage("null")
+	}
+	return value
+}
+
+func spellRevisionFromDB(rev database.SpellRevision) SpellRevision {
+	val := SpellRevision{
+		Revision:	rev.Revision,
+		Action:		rev.Action,
+		CreatedAt:	rev.CreatedAt,
+		Snapshot:	rev.Snapshot,
+	}
+	if rev.EditorID.Valid {
+		val.EditorID = &rev.EditorID.UUID
+	}
+	return val
+}
+
+// loadSpellRevision resolves revision number value of the spell in the
+// path. It reports whether the handler should continue.
+func (cfg *APIConfig) loadSpellRevision(w http.ResponseWriter, r *http.Request, value string) (database.SpellRevision, bool) {
+	revision, err := strconv.ParseInt(value, 10, 32)
+	if err != nil || revision < 1 {
+		respondWithError(w, 400, "Invalid revision")
+		return database.SpellRevision{}, false
+	}
+
+	rev, err := cfg.DB.GetSpellRevision(r.Context(), database.GetSpellRevisionParams{
+		SpellIndex:	r.PathValue("index"),
+		Revision:	int32(revision),
+	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, 404, "Revision not found")
+		return rev, false
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error getting revision")
+		return rev, false
+	}
+
+	return rev, true
+}
+
+func (cfg *APIConfig) HandlerGetSpellHistory(w http.ResponseWriter, r *http.Request) {
+	revisions, err := cfg.DB.ListSpellRevisions(r.Context(), r.PathValue("index"))
+	if err != nil {
+		respondWithError(w, 500, "Error getting spell history")
+		return
+	}
+	if len(revisions) == 0 {
+		respondWithError(w, 404, "Spell not found")
+		return
+	}
+
+	returnSlice := []SpellRevision{}
+
+	for _, rev := range revisions {
+		val := SpellRevision{
+			Revision:	rev.Revision,
+			Action:		rev.Action,
+			CreatedAt:	rev.CreatedAt,
+		}
+		if rev.EditorID.Valid {
+			val.EditorID = &rev.EditorID.UUID
+		}
+		returnSlice = append(returnSlice, val)
+	}
+
+	respondWithJSON(w, 200, returnSlice)
+	return
+}
+
+func (cfg *APIConfig) HandlerGetSpellRevision(w http.ResponseWriter, r *http.Request) {
+	rev, ok := cfg.loadSpellRevision(w, r, r.PathValue("revision"))
+	if !ok {
+		return
+	}
+
+	respondWithJSON(w, 200, spellRevisionFromDB(rev))
+	return
+}
+
+// HandlerDiffSpellRevisions compares the revisions given by the from and to
+// query parameters, field by field.
+func (cfg *APIConfig) HandlerDiffSpellRevisions(w http.ResponseWriter, r *http.Request) {
+	type diffResponse struct {
+		From		int32					`json:"from"`
+		To			int32					`json:"to"`
+		Changes		[]SpellFieldChange		`json:"changes"`
+	}
+
+	query := r.URL.Query()
+	if query.Get("from") == "" || query.Get("to") == "" {
+		respondWithError(w, 400, "from and to revisions are required")
+		return
+	}
+
+	from, ok := cfg.loadSpellRevision(w, r, query.Get("from"))
+	if !ok {
+		return
+	}
+	to, ok := cfg.loadSpellRevision(w, r, query.Get("to"))
+	if !ok {
+		return
+	}
+
+	changes, err := diffSpellSnapshots(from.Snapshot, to.Snapshot)
+	if err != nil {
+		respondWithError(w, 500, "Error comparing revisions")
+		return
+	}
+
+	respondWithJSON(w, 200, diffResponse{
+		From:		from.Revision,
+		To:			to.Revision,
+		Changes:	changes,
+	})
+	return
+}
+
+// HandlerRevertSpell restores a spell to the text of an earlier revision,
+// recreating it if it has since been deleted. The revert is itself recorded
+// as a new revision, so it can be undone the same way.
+func (cfg *APIConfig) HandlerRevertSpell(w http.ResponseWriter, r *http.Request) {
+	principal, _ := auth.PrincipalFromContext(r.Context())
+	index := r.PathValue("index")
+
+	rev, ok := cfg.loadSpellRevision(w, r, r.PathValue("revision"))
+	if !ok {
+		return
+	}
+
+	var snapshot Spell
+	if err := json.Unmarshal(rev.Snapshot, &snapshot); err != nil {
+		respondWithError(w, 500, "Error reading revision")
+		return
+	}
+	snapshot.Index = index
+
+	var val Spell
+	err := cfg.inTx(r.Context(), func(q *database.Queries) error {
+		if err := q.LockSpellIndex(r.Context(), index); err != nil {
+			return err
+		}
+		var before *Spell
+		current, err := q.GetSpell(r.Context(), index)
+		if err == sql.ErrNoRows {
+			if _, err := q.CreateSpell(r.Context(), spellCreateParams(snapshot)); err != nil {
+				return err
+			}
+		} else if err != nil {
+			return err
+		} else {
+			previous := spellFromRow(current)
+			before = &previous
+			if _, err := q.UpdateSpell(r.Context(), spellUpdateParams(snapshot)); err != nil {
+				return err
+			}
+		}
+
+		current, err = q.GetSpell(r.Context(), index)
+		if err != nil {
+			return err
+		}
+		val = spellFromRow(current)
+		return cfg.recordSpellChange(r, q, principal.UserID, spellRevisionRevert, before, &val, map[string]int32{
+			"revision":	rev.Revision,
+		})
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error reverting spell")
+		return
+	}
+
+	respondWithJSON(w, 200, val)
+	return
+}
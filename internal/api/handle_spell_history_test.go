@@ -0,0 +1,54 @@
+package api
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+func TestDiffSpellSnapshots(t *testing.T) {
+	from := json.RawMessage(`{"name": "Fire Bolt", "level": 0, "desc": ["Hurl a mote of fire."], "school": {"index": "evocation", "name": "Evocation"}, "damage": null}`)
+	to := json.RawMessage(`{"school": {"name": "Evocation", "index": "evocation"}, "name": "Fire Bolt", "level": 1, "desc": ["Hurl a mote of fire.", "It ignites objects."], "material": "A bit of tinder"}`)
+
+	changes, err := diffSpellSnapshots(from, to)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	want := []struct {
+		field	string
+		from	string
+		to		string
+	}{
+		{"desc", `["Hurl a mote of fire."]`, `["Hurl a mote of fire.", "It ignites objects."]`},
+		{"level", `0`, `1`},
+		{"material", `null`, `"A bit of tinder"`},
+	}
+
+	if len(changes) != len(want) {
+		t.Fatalf("got %d changes, want %d: %+v", len(changes), len(want), changes)
+	}
+	for i, w := range want {
+		c := changes[i]
+		if c.Field != w.field || string(c.From) != w.from || string(c.To) != w.to {
+			t.Errorf("change %d = {%s %s %s}, want {%s %s %s}", i, c.Field, c.From, c.To, w.field, w.from, w.to)
+		}
+	}
+}
+
+func TestDiffSpellSnapshotsIdentical(t *testing.T) {
+	snapshot := json.RawMessage(`{"name": "Shield", "level": 1}`)
+
+	changes, err := diffSpellSnapshots(snapshot, snapshot)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 0 {
+		t.Errorf("got changes %+v for identical snapshots", changes)
+	}
+}
+
+func TestDiffSpellSnapshotsInvalid(t *testing.T) {
+	if _, err := diffSpellSnapshots(json.RawMessage(`[]`), json.RawMessage(`{}`)); err == nil {
+		t.Error("diffSpellSnapshots accepted a snapshot that isn't an object")
+	}
+}
@@ -1,16 +1,109 @@
 package api
 
 import (
+	"context"
+	"errors"
+	"github.com/kblasti/spellbook/internal/database"
 	"github.com/kblasti/spellbook/internal/auth"
+	"database/sql"
+	"github.com/google/uuid"
 	"net/http"
 	"time"
 )
 
 const expirationTime = time.Duration(3600) * time.Second
 
+const mfaExpirationTime = 5 * time.Minute
+
+// Reasons rotateRefreshToken refuses a refresh token.
+var (
+    errRefreshInvalid   = errors.New("invalid refresh token")
+    errRefreshReused    = errors.New("refresh token reuse detected")
+    errAccountDisabled  = errors.New("account disabled")
+)
+
+// refreshStore is the part of the database rotating a refresh token uses.
+type refreshStore interface {
+    GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error)
+    MarkRefreshTokenUsed(ctx context.Context, token string) (int64, error)
+    GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error)
+    CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error)
+}
+
+// refreshRotation is the outcome of rotating a refresh token. FamilyID is
+// set whenever the presented token was found, including when it was reused.
+type refreshRotation struct {
+    Token           string
+    RefreshToken    string
+    FamilyID        uuid.UUID
+}
+
+// rotateRefreshToken spends token and issues a new access token and refresh
+// token in its family. q should be a transaction, so that if anything fails
+// the old token is left unspent and the client can simply retry.
+func (cfg *APIConfig) rotateRefreshToken(r *http.Request, q refreshStore, token string) (refreshRotation, error) {
+    stored, err := q.GetRefreshToken(r.Context(), token)
+    if err == sql.ErrNoRows {
+        return refreshRotation{}, errRefreshInvalid
+    }
+    if err != nil {
+        return refreshRotation{}, err
+    }
+    rotation := refreshRotation{FamilyID: stored.FamilyID}
+
+    if stored.UsedAt.Valid {
+        return rotation, errRefreshReused
+    }
+    if stored.RevokedAt.Valid || !time.Now().Before(stored.ExpiresAt) {
+        return rotation, errRefreshInvalid
+    }
+
+    // Marking the token used is conditional on it still being unused, so if
+    // two requests race with the same token only one of them rotates it.
+    marked, err := q.MarkRefreshTokenUsed(r.Context(), token)
+    if err != nil {
+        return rotation, err
+    }
+    if marked == 0 {
+        return rotation, errRefreshReused
+    }
+
+    user, err := q.GetUserByID(r.Context(), stored.UserID.UUID)
+    if err != nil {
+        return rotation, err
+    }
+    if user.DisabledAt.Valid {
+        return rotation, errAccountDisabled
+    }
+
+    rotation.Token, err = cfg.Keys.MakeJWT(user.ID, user.Role, expirationTime)
+    if err != nil {
+        return rotation, err
+    }
+
+    rotation.RefreshToken, err = auth.MakeRefreshToken()
+    if err != nil {
+        return rotation, err
+    }
+
+    _, err = q.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
+        Token: rotation.RefreshToken,
+        UserID: stored.UserID,
+        FamilyID: stored.FamilyID,
+        UserAgent: nullString(r.UserAgent()),
+        IpAddress: nullString(cfg.clientIP(r)),
+    })
+    if err != nil {
+        return rotation, err
+    }
+
+    return rotation, nil
+}
+
 func (cfg *APIConfig) HandlerRefresh(w http.ResponseWriter, r *http.Request) {
     type tokenResponse struct {
         Token string `json:"token"`
+        RefreshToken string `json:"refresh_token"`
     }
     
     token, err := auth.GetBearerToken(r.Header)
@@ -19,26 +112,52 @@ func (cfg *APIConfig) HandlerRefresh(w http.ResponseWriter, r *http.Request) {
         return
     }
 
-    user, err := cfg.DB.GetUserFromRefreshToken(r.Context(), token)
-    if err != nil {
-        respondWithError(w, 401, "Error finding user")
+    var rotation refreshRotation
+    err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+        var err error
+        rotation, err = cfg.rotateRefreshToken(r, q, token)
+        return err
+    })
+    if errors.Is(err, errRefreshReused) {
+        // The rotation rolled back, so the family is revoked on its own.
+        cfg.revokeTokenFamily(w, r, rotation.FamilyID)
+        return
+    }
+    if errors.Is(err, errRefreshInvalid) {
+        respondWithError(w, 401, "Invalid refresh token")
+        return
+    }
+    if errors.Is(err, errAccountDisabled) {
+        respondWithError(w, 403, "Account disabled")
         return
     }
-
-    jwtToken, err := auth.MakeJWT(user.ID, user.Role, cfg.Secret, expirationTime)
     if err != nil {
-        respondWithError(w, 500, "Error making token")
+        respondWithError(w, 500, "Error rotating refresh token")
         return
     }
 
     response := tokenResponse {
-        Token: jwtToken,
+        Token: rotation.Token,
+        RefreshToken: rotation.RefreshToken,
     }
 
     respondWithJSON(w, 200, response)
     return
 }
 
+// revokeTokenFamily handles a refresh token being presented after it was
+// already rotated. Either the client or an attacker holds a stolen copy, so
+// every token descended from the same login is revoked.
+func (cfg *APIConfig) revokeTokenFamily(w http.ResponseWriter, r *http.Request, familyID uuid.UUID) {
+    err := cfg.DB.RevokeRefreshTokenFamily(r.Context(), familyID)
+    if err != nil {
+        respondWithError(w, 500, "Error revoking refresh tokens")
+        return
+    }
+
+    respondWithError(w, 401, "Refresh token reuse detected")
+}
+
 func (cfg *APIConfig) HandlerRevoke(w http.ResponseWriter, r *http.Request) {
     token, err := auth.GetBearerToken(r.Header)
     if err != nil {
@@ -54,4 +173,9 @@ func (cfg *APIConfig) HandlerRevoke(w http.ResponseWriter, r *http.Request) {
 
     respondWithJSON(w, 204, nil)
     return
-}
\ No newline at end of file
+}
+// HandlerJWKS publishes the public keys access tokens can be verified with.
+func (cfg *APIConfig) HandlerJWKS(w http.ResponseWriter, r *http.Request) {
+    w.Header().Set("Cache-Control", "public, max-age=300")
+    respondWithJSON(w, 200, cfg.Keys.JWKS())
+}
@@ -0,0 +1,211 @@
+package api
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+// fakeRefreshStore keeps refresh tokens in memory, marking them used
+// atomically the way the conditional UPDATE does.
+type fakeRefreshStore struct {
+	mu			sync.Mutex
+	tokens		map[string]database.RefreshToken
+	users		map[uuid.UUID]database.User
+	createErr	error
+}
+
+func newFakeRefreshStore(user database.User) *fakeRefreshStore {
+	return &fakeRefreshStore{
+		tokens:	map[string]database.RefreshToken{},
+		users:	map[uuid.UUID]database.User{user.ID: user},
+	}
+}
+
+func (s *fakeRefreshStore) add(token string, userID uuid.UUID, familyID uuid.UUID) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.tokens[token] = database.RefreshToken{
+		Token:		token,
+		UserID:		uuid.NullUUID{UUID: userID, Valid: true},
+		FamilyID:	familyID,
+		ExpiresAt:	time.Now().Add(time.Hour),
+	}
+}
+
+func (s *fakeRefreshStore) GetRefreshToken(ctx context.Context, token string) (database.RefreshToken, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.tokens[token]
+	if !ok {
+		return stored, sql.ErrNoRows
+	}
+	return stored, nil
+}
+
+func (s *fakeRefreshStore) MarkRefreshTokenUsed(ctx context.Context, token string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	stored, ok := s.tokens[token]
+	if !ok || stored.UsedAt.Valid || stored.RevokedAt.Valid {
+		return 0, nil
+	}
+	stored.UsedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	s.tokens[token] = stored
+	return 1, nil
+}
+
+func (s *fakeRefreshStore) GetUserByID(ctx context.Context, id uuid.UUID) (database.User, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	user, ok := s.users[id]
+	if !ok {
+		return user, sql.ErrNoRows
+	}
+	return user, nil
+}
+
+func (s *fakeRefreshStore) CreateRefreshToken(ctx context.Context, arg database.CreateRefreshTokenParams) (database.RefreshToken, error) {
+	if s.createErr != nil {
+		return database.RefreshToken{}, s.createErr
+	}
+	s.add(arg.Token, arg.UserID.UUID, arg.FamilyID)
+	return s.GetRefreshToken(ctx, arg.Token)
+}
+
+func newRefreshTest() (*APIConfig, *fakeRefreshStore, database.User, uuid.UUID) {
+	cfg := &APIConfig{Keys: auth.NewHMACKeySet("a-test-secret-that-is-long-enough")}
+	user := database.User{ID: uuid.New(), Role: "user"}
+	store := newFakeRefreshStore(user)
+	family := uuid.New()
+	store.add("first", user.ID, family)
+	return cfg, store, user, family
+}
+
+func TestRotateRefreshToken(t *testing.T) {
+	cfg, store, user, family := newRefreshTest()
+	r := httptest.NewRequest("POST", "/api/refresh", nil)
+
+	rotation, err := cfg.rotateRefreshToken(r, store, "first")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if rotation.RefreshToken == "" || rotation.RefreshToken == "first" {
+		t.Errorf("expected a new refresh token, got %q", rotation.RefreshToken)
+	}
+	if principal, err := cfg.Keys.ParseAccessToken(rotation.Token); err != nil || principal.UserID != user.ID {
+		t.Errorf("access token = %v, %v", principal, err)
+	}
+
+	next := store.tokens[rotation.RefreshToken]
+	if next.FamilyID != family {
+		t.Error("new refresh token isn't in the same family")
+	}
+	if !store.tokens["first"].UsedAt.Valid {
+		t.Error("old refresh token wasn't marked used")
+	}
+
+	// The new token rotates in turn.
+	if _, err := cfg.rotateRefreshToken(r, store, rotation.RefreshToken); err != nil {
+		t.Errorf("rotating the new token: %v", err)
+	}
+}
+
+func TestRotateRefreshTokenReuse(t *testing.T) {
+	cfg, store, _, family := newRefreshTest()
+	r := httptest.NewRequest("POST", "/api/refresh", nil)
+
+	if _, err := cfg.rotateRefreshToken(r, store, "first"); err != nil {
+		t.Fatal(err)
+	}
+
+	rotation, err := cfg.rotateRefreshToken(r, store, "first")
+	if !errors.Is(err, errRefreshReused) {
+		t.Fatalf("reusing a token: err = %v, want errRefreshReused", err)
+	}
+	if rotation.FamilyID != family {
+		t.Error("reuse didn't report the family to revoke")
+	}
+}
+
+func TestRotateRefreshTokenRace(t *testing.T) {
+	cfg, store, _, _ := newRefreshTest()
+
+	const requests = 8
+	errs := make(chan error, requests)
+	var wg sync.WaitGroup
+	for i := 0; i < requests; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			_, err := cfg.rotateRefreshToken(httptest.NewRequest("POST", "/api/refresh", nil), store, "first")
+			errs <- err
+		}()
+	}
+	wg.Wait()
+	close(errs)
+
+	rotated := 0
+	for err := range errs {
+		switch {
+		case err == nil:
+			rotated++
+		case !errors.Is(err, errRefreshReused):
+			t.Errorf("unexpected error: %v", err)
+		}
+	}
+	if rotated != 1 {
+		t.Errorf("%d requests rotated the same token, want 1", rotated)
+	}
+}
+
+func TestRotateRefreshTokenRejects(t *testing.T) {
+	cfg, store, user, family := newRefreshTest()
+	r := httptest.NewRequest("POST", "/api/refresh", nil)
+
+	if _, err := cfg.rotateRefreshToken(r, store, "unknown"); !errors.Is(err, errRefreshInvalid) {
+		t.Errorf("unknown token: err = %v", err)
+	}
+
+	store.add("expired", user.ID, family)
+	expired := store.tokens["expired"]
+	expired.ExpiresAt = time.Now().Add(-time.Minute)
+	store.tokens["expired"] = expired
+	if _, err := cfg.rotateRefreshToken(r, store, "expired"); !errors.Is(err, errRefreshInvalid) {
+		t.Errorf("expired token: err = %v", err)
+	}
+
+	store.add("revoked", user.ID, family)
+	revoked := store.tokens["revoked"]
+	revoked.RevokedAt = sql.NullTime{Time: time.Now(), Valid: true}
+	store.tokens["revoked"] = revoked
+	if _, err := cfg.rotateRefreshToken(r, store, "revoked"); !errors.Is(err, errRefreshInvalid) {
+		t.Errorf("revoked token: err = %v", err)
+	}
+
+	disabled := store.users[user.ID]
+	disabled.DisabledAt = sql.NullTime{Time: time.Now(), Valid: true}
+	store.users[user.ID] = disabled
+	if _, err := cfg.rotateRefreshToken(r, store, "first"); !errors.Is(err, errAccountDisabled) {
+		t.Errorf("disabled account: err = %v", err)
+	}
+}
+
+// A failure after the token is marked used has to be returned, so the
+// transaction rolls the mark back instead of spending the token.
+func TestRotateRefreshTokenReportsLateFailure(t *testing.T) {
+	cfg, store, _, _ := newRefreshTest()
+	store.createErr = errors.New("connection lost")
+
+	_, err := cfg.rotateRefreshToken(httptest.NewRequest("POST", "/api/refresh", nil), store, "first")
+	if err == nil || errors.Is(err, errRefreshReused) || errors.Is(err, errRefreshInvalid) {
+		t.Errorf("err = %v, want the insert failure", err)
+	}
+}
@@ -0,0 +1,356 @@
+package api
+
+import (
+	"database/sql"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+const (
+	totpIssuer        = "Spellbook"
+	recoveryCodeCount = 10
+)
+
+var errTOTPConfirmed = errors.New("two-factor authentication is already enabled")
+
+func (cfg *APIConfig) HandlerEnrollTOTP(w http.ResponseWriter, r *http.Request) {
+	type enrollResponse struct {
+		Secret		string		`json:"secret"`
+		OTPAuthURI	string		`json:"otpauth_uri"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	existing, err := cfg.DB.GetUserTOTP(r.Context(), principal.UserID)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, 500, "Error getting two-factor settings")
+		return
+	}
+	if err == nil && existing.ConfirmedAt.Valid {
+		respondWithError(w, 409, "Two-factor authentication is already enabled")
+		return
+	}
+
+	dbUser, err := cfg.DB.GetUserByID(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Error retrieving user")
+		return
+	}
+
+	secret, err := auth.GenerateTOTPSecret()
+	if err != nil {
+		respondWithError(w, 500, "Error generating secret")
+		return
+	}
+
+	// The upsert only replaces a secret that hasn't been confirmed, so a
+	// concurrent enrollment can't overwrite one that was just confirmed.
+	saved, err := cfg.DB.UpsertUserTOTP(r.Context(), database.UpsertUserTOTPParams{
+		UserID:	principal.UserID,
+		Secret:	secret,
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error saving two-factor settings")
+		return
+	}
+	if saved == 0 {
+		respondWithError(w, 409, "Two-factor authentication is already enabled")
+		return
+	}
+
+	respondWithJSON(w, 200, enrollResponse{
+		Secret:		secret,
+		OTPAuthURI:	auth.TOTPURI(secret, dbUser.Email, totpIssuer),
+	})
+	return
+}
+
+func (cfg *APIConfig) HandlerConfirmTOTP(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Code	string	`json:"code"`
+	}
+
+	type confirmResponse struct {
+		RecoveryCodes	[]string	`json:"recovery_codes"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	decoder := json.NewDecoder(r.Body)
+	input := Input{}
+
+	err := decoder.Decode(&input)
+	if err != nil {
+		respondWithError(w, 400, "Error decoding input")
+		return
+	}
+
+	totp, err := cfg.DB.GetUserTOTP(r.Context(), principal.UserID)
+	if err == sql.ErrNoRows {
+		respondWithError(w, 400, "Two-factor enrollment has not been started")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error getting two-factor settings")
+		return
+	}
+	if totp.ConfirmedAt.Valid {
+		respondWithError(w, 409, "Two-factor authentication is already enabled")
+		return
+	}
+
+	step, ok := auth.ValidateTOTP(totp.Secret, input.Code, time.Now())
+	if !ok {
+		respondWithError(w, 400, "Invalid code")
+		return
+	}
+
+	codes, err := auth.GenerateRecoveryCodes(recoveryCodeCount)
+	if err != nil {
+		respondWithError(w, 500, "Error generating recovery codes")
+		return
+	}
+
+	hashes := make([]string, 0, len(codes))
+	for _, code := range codes {
+		hashed, err := auth.HashPassword(code)
+		if err != nil {
+			respondWithError(w, 500, "Error hashing recovery code")
+			return
+		}
+		hashes = append(hashes, hashed)
+	}
+
+	// Confirming first locks the user_totp row, so of two concurrent
+	// confirmations only one gets to store its recovery codes.
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		confirmed, err := q.ConfirmUserTOTP(r.Context(), database.ConfirmUserTOTPParams{
+			UserID:			principal.UserID,
+			LastUsedStep:	step,
+		})
+		if err != nil {
+			return err
+		}
+		if confirmed == 0 {
+			return errTOTPConfirmed
+		}
+
+		if err := q.DeleteRecoveryCodes(r.Context(), principal.UserID); err != nil {
+			return err
+		}
+		for _, hashed := range hashes {
+			err := q.CreateRecoveryCode(r.Context(), database.CreateRecoveryCodeParams{
+				UserID:		principal.UserID,
+				CodeHash:	hashed,
+			})
+			if err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if errors.Is(err, errTOTPConfirmed) {
+		respondWithError(w, 409, "Two-factor authentication is already enabled")
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error saving two-factor settings")
+		return
+	}
+
+	respondWithJSON(w, 200, confirmResponse{RecoveryCodes: codes})
+	return
+}
+
+// HandlerDisableTOTP turns two-factor authentication off. Besides the
+// password it takes a current TOTP code or a recovery code, so a stolen
+// password and session aren't enough to remove the second factor.
+func (cfg *APIConfig) HandlerDisableTOTP(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		Password		string	`json:"password"`
+		Code			string	`json:"code"`
+		RecoveryCode	string	`json:"recovery_code"`
+	}
+
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
+	decoder := json.NewDecoder(r.Body)
+	input := Input{}
+
+	err := decoder.Decode(&input)
+	if err != nil {
+		respondWithError(w, 400, "Error decoding input")
+		return
+	}
+
+	dbUser, err := cfg.DB.GetHashedPassword(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Unable to retrieve user data")
+		return
+	}
+
+	verified, err := auth.CheckPasswordHash(input.Password, dbUser.HashedPassword)
+	if err != nil {
+		respondWithError(w, 500, "Error verifying password")
+		return
+	}
+	if !verified {
+		respondWithError(w, 401, "Incorrect password")
+		return
+	}
+
+	totp, err := cfg.DB.GetUserTOTP(r.Context(), principal.UserID)
+	if err != nil && err != sql.ErrNoRows {
+		respondWithError(w, 500, "Error getting two-factor settings")
+		return
+	}
+	// An enrollment that was never confirmed can be cancelled with the
+	// password alone.
+	if err == nil && totp.ConfirmedAt.Valid {
+		var ok bool
+		if input.RecoveryCode != "" {
+			ok, err = cfg.useRecoveryCode(r, principal.UserID, input.RecoveryCode)
+		} else {
+			ok, err = cfg.useTOTPCode(r, totp, input.Code)
+		}
+		if err != nil {
+			respondWithError(w, 500, "Error checking code")
+			return
+		}
+		if !ok {
+			respondWithError(w, 401, "Invalid code")
+			return
+		}
+	}
+
+	err = cfg.DB.DeleteUserTOTP(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Error disabling two-factor authentication")
+		return
+	}
+
+	err = cfg.DB.DeleteRecoveryCodes(r.Context(), principal.UserID)
+	if err != nil {
+		respondWithError(w, 500, "Error deleting recovery codes")
+		return
+	}
+
+	respondWithJSON(w, 204, nil)
+	return
+}
+
+// HandlerLoginMFA completes a login started by HandlerLogin for a user with
+// two-factor authentication enabled, using either a TOTP code or one of the
+// user's recovery codes.
+func (cfg *APIConfig) HandlerLoginMFA(w http.ResponseWriter, r *http.Request) {
+	type Input struct {
+		MFAToken		string	`json:"mfa_token"`
+		Code			string	`json:"code"`
+		RecoveryCode	string	`json:"recovery_code"`
+	}
+
+	decoder := json.NewDecoder(r.Body)
+	input := Input{}
+
+	err := decoder.Decode(&input)
+	if err != nil {
+		respondWithError(w, 400, "Error decoding input")
+		return
+	}
+
+	userID, err := auth.ValidateMFAToken(input.MFAToken, cfg.Secret)
+	if err != nil {
+		respondWithError(w, 401, "Invalid or expired MFA token")
+		return
+	}
+
+	dbUser, err := cfg.DB.GetUserByID(r.Context(), userID)
+	if err != nil {
+		respondWithError(w, 401, "Invalid or expired MFA token")
+		return
+	}
+
+	if !cfg.checkLoginThrottle(w, r, dbUser.Email) {
+		return
+	}
+
+	if dbUser.DisabledAt.Valid {
+		respondWithError(w, 403, "Account disabled")
+		return
+	}
+
+	totp, err := cfg.DB.GetUserTOTP(r.Context(), userID)
+	if err != nil || !totp.ConfirmedAt.Valid {
+		respondWithError(w, 401, "Invalid or expired MFA token")
+		return
+	}
+
+	var ok bool
+	if input.RecoveryCode != "" {
+		ok, err = cfg.useRecoveryCode(r, userID, input.RecoveryCode)
+	} else {
+		ok, err = cfg.useTOTPCode(r, totp, input.Code)
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error checking code")
+		return
+	}
+	if !ok {
+		cfg.recordLoginFailure(r, dbUser.Email)
+		respondWithError(w, 401, "Invalid code")
+		return
+	}
+
+	cfg.respondWithLogin(w, r, dbUser)
+	return
+}
+
+// useTOTPCode checks code and records its time step, so the same code can't
+// be replayed within its validity window.
+func (cfg *APIConfig) useTOTPCode(r *http.Request, totp database.UserTotp, code string) (bool, error) {
+	step, ok := auth.ValidateTOTP(totp.Secret, code, time.Now())
+	if !ok {
+		return false, nil
+	}
+
+	updated, err := cfg.DB.UpdateTOTPLastStep(r.Context(), database.UpdateTOTPLastStepParams{
+		UserID:			totp.UserID,
+		LastUsedStep:	step,
+	})
+	if err != nil {
+		return false, err
+	}
+
+	return updated == 1, nil
+}
+
+func (cfg *APIConfig) useRecoveryCode(r *http.Request, userID uuid.UUID, code string) (bool, error) {
+	codes, err := cfg.DB.GetUnusedRecoveryCodes(r.Context(), userID)
+	if err != nil {
+		return false, err
+	}
+
+	code = auth.NormalizeRecoveryCode(code)
+	for _, stored := range codes {
+		match, err := auth.CheckPasswordHash(code, stored.CodeHash)
+		if err != nil {
+			return false, err
+		}
+		if !match {
+			continue
+		}
+
+		used, err := cfg.DB.UseRecoveryCode(r.Context(), stored.ID)
+		if err != nil {
+			return false, err
+		}
+		return used == 1, nil
+	}
+
+	return false, nil
+}
@@ -8,8 +8,7 @@ import (
 	"github.com/google/uuid"
 	"time"
 	"net/http"
-	"strings"
-	"context"
+	"log"
 )
 
 type User struct {
@@ -18,6 +17,26 @@ type User struct {
 	UpdatedAt 	time.Time 	`json:"updated_at"`
 	Email     	string    	`json:"email"`
 	Role		string		`json:"role"`
+	EmailVerified	bool	`json:"email_verified"`
+	Disabled	bool		`json:"disabled"`
+}
+
+func userFromDB(dbUser database.User) User {
+	return User{
+		ID:				dbUser.ID,
+		CreatedAt:		dbUser.CreatedAt,
+		UpdatedAt:		dbUser.UpdatedAt,
+		Email:			dbUser.Email,
+		Role:			dbUser.Role,
+		EmailVerified:	dbUser.EmailVerifiedAt.Valid,
+		Disabled:		dbUser.DisabledAt.Valid,
+	}
+}
+
+type loginResponse struct {
+    User
+    Token string `json:"token"`
+    RefreshToken string `json:"refresh_token"`
 }
 
 func (cfg *APIConfig) HandlerCreateUser(w http.ResponseWriter, r *http.Request) {
@@ -68,6 +87,11 @@ func (cfg *APIConfig) HandlerCreateUser(w http.ResponseWriter, r *http.Request)
         return
     }
 
+    err = cfg.sendVerificationEmail(r.Context(), dbUser.ID, dbUser.Email)
+    if err != nil {
+        log.Printf("sending verification email: %v", err)
+    }
+
     appUser := User{
         ID:        dbUser.ID,
         CreatedAt: dbUser.CreatedAt,
@@ -102,10 +126,25 @@ func (cfg *APIConfig) HandlerCreateAdminUser(w http.ResponseWriter, r *http.Requ
         return
     }
 
-    dbUser, err := cfg.DB.CreateUser(r.Context(), database.CreateUserParams{
-        Email:          input.Email,
-        HashedPassword: hashed,
-		Role:			role,
+    principal, _ := auth.PrincipalFromContext(r.Context())
+
+    var dbUser database.CreateUserRow
+    err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+        var err error
+        dbUser, err = q.CreateUser(r.Context(), database.CreateUserParams{
+            Email:          input.Email,
+            HashedPassword: hashed,
+            Role:           role,
+        })
+        if err != nil {
+            return err
+        }
+        return cfg.recordAudit(r, q, principal.UserID, auditEvent{
+            Action:     auditUserCreateAdmin,
+            TargetType: "user",
+            TargetID:   dbUser.ID.String(),
+            After:      map[string]string{"email": dbUser.Email, "role": dbUser.Role},
+        })
     })
     if err != nil {
         respondWithError(w, 500, "Error creating user")
@@ -130,12 +169,6 @@ func (cfg *APIConfig) HandlerLogin(w http.ResponseWriter, r *http.Request) {
         Password string `json:"password"`
     }
 
-    type loginResponse struct {
-        User
-        Token string `json:"token"`
-        RefreshToken string `json:"refresh_token"`
-    }
-
     decoder := json.NewDecoder(r.Body)
     input := Input{}
 
@@ -145,9 +178,14 @@ func (cfg *APIConfig) HandlerLogin(w http.ResponseWriter, r *http.Request) {
         return
     }
 
+    if !cfg.checkLoginThrottle(w, r, input.Email) {
+        return
+    }
+
     dbUser, err := cfg.DB.UserLogin(r.Context(), input.Email)
     if err != nil {
         if err == sql.ErrNoRows {
+            cfg.recordLoginFailure(r, input.Email)
             respondWithError(w, 401, "Incorrect email or password")
             return
         } else {
@@ -163,11 +201,56 @@ func (cfg *APIConfig) HandlerLogin(w http.ResponseWriter, r *http.Request) {
     }
 
     if verified == false {
+        cfg.recordLoginFailure(r, input.Email)
         respondWithError(w, 401, "Incorrect email or password")
         return
     }
 
-    token, err := auth.MakeJWT(dbUser.ID, dbUser.Role, cfg.Secret, expirationTime)
+    cfg.completeLogin(w, r, dbUser)
+    return
+}
+
+// completeLogin finishes a login once the user's first factor has been
+// checked, either by issuing tokens or by asking for a TOTP code.
+func (cfg *APIConfig) completeLogin(w http.ResponseWriter, r *http.Request, dbUser database.User) {
+    type mfaResponse struct {
+        MFARequired bool `json:"mfa_required"`
+        MFAToken string `json:"mfa_token"`
+    }
+
+    if dbUser.DisabledAt.Valid {
+        respondWithError(w, 403, "Account disabled")
+        return
+    }
+
+    totp, err := cfg.DB.GetUserTOTP(r.Context(), dbUser.ID)
+    if err != nil && err != sql.ErrNoRows {
+        respondWithError(w, 500, "Something went wrong")
+        return
+    }
+
+    if err == nil && totp.ConfirmedAt.Valid {
+        mfaToken, err := auth.MakeMFAToken(dbUser.ID, cfg.Secret, mfaExpirationTime)
+        if err != nil {
+            respondWithError(w, 500, "Error making token")
+            return
+        }
+
+        respondWithJSON(w, 200, mfaResponse{
+            MFARequired: true,
+            MFAToken: mfaToken,
+        })
+        return
+    }
+
+    cfg.respondWithLogin(w, r, dbUser)
+    return
+}
+
+// respondWithLogin issues a new access token and refresh token family for a
+// user who has fully authenticated.
+func (cfg *APIConfig) respondWithLogin(w http.ResponseWriter, r *http.Request, dbUser database.User) {
+    token, err := cfg.Keys.MakeJWT(dbUser.ID, dbUser.Role, expirationTime)
     if err != nil {
         respondWithError(w, 500, "Error making token")
         return
@@ -187,18 +270,24 @@ func (cfg *APIConfig) HandlerLogin(w http.ResponseWriter, r *http.Request) {
     _, err = cfg.DB.CreateRefreshToken(r.Context(), database.CreateRefreshTokenParams{
         Token: refreshToken,
         UserID: dbUserID,
+        FamilyID: uuid.New(),
+        UserAgent: nullString(r.UserAgent()),
+        IpAddress: nullString(cfg.clientIP(r)),
     })
     if err != nil {
         respondWithError(w, 500, "Error saving refresh token")
         return
     }
 
+    cfg.clearLoginFailures(r, dbUser.Email)
+
     appUser := User{
         ID:         dbUser.ID,
         CreatedAt:  dbUser.CreatedAt,
         UpdatedAt:  dbUser.UpdatedAt,
         Email:      dbUser.Email,
 		Role:		dbUser.Role,
+        EmailVerified: dbUser.EmailVerifiedAt.Valid,
     }
 
     login := loginResponse{
@@ -222,11 +311,12 @@ func (cfg *APIConfig) HandlerDeleteUser(w http.ResponseWriter, r *http.Request)
         return
     }
 
-    userID, _, err := auth.ValidateJWT(token, cfg.Secret)
+    principal, err := cfg.Keys.ParseAccessToken(token)
     if err != nil {
         respondWithError(w, 401, "Error validating token")
         return
     }
+    userID := principal.UserID
 
 	decoder := json.NewDecoder(r.Body)
     input := Input{}
@@ -276,11 +366,12 @@ func (cfg *APIConfig) HandlerUpdateUser(w http.ResponseWriter, r *http.Request)
         return
     }
 
-    userID, _, err := auth.ValidateJWT(token, cfg.Secret)
+    principal, err := cfg.Keys.ParseAccessToken(token)
     if err != nil {
         respondWithError(w, 401, "Error validating token")
         return
     }
+    userID := principal.UserID
 
     decoder := json.NewDecoder(r.Body)
     params := parameters{}
@@ -333,58 +424,59 @@ func (cfg *APIConfig) HandlerUpdateUser(w http.ResponseWriter, r *http.Request)
         passwordToSave = hashedPassword
     }
 
-    dbUser, err := cfg.DB.UpdateUser(r.Context(), database.UpdateUserParams{
-        Email:          emailToSave,
-        HashedPassword: passwordToSave,
-        Role:           "user",
-        ID:             userID,
+    var dbUser database.UpdateUserRow
+    err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+        var err error
+        dbUser, err = q.UpdateUser(r.Context(), database.UpdateUserParams{
+            Email:          emailToSave,
+            HashedPassword: passwordToSave,
+            ID:             userID,
+        })
+        if err != nil {
+            return err
+        }
+
+        if dbUser.Email != currentUser.Email {
+            err = cfg.recordAudit(r, q, userID, auditEvent{
+                Action:     auditUserEmail,
+                TargetType: "user",
+                TargetID:   userID.String(),
+                Before:     map[string]string{"email": currentUser.Email},
+                After:      map[string]string{"email": dbUser.Email},
+            })
+            if err != nil {
+                return err
+            }
+        }
+        if hashedPassword != "" {
+            return cfg.recordAudit(r, q, userID, auditEvent{
+                Action:     auditUserPassword,
+                TargetType: "user",
+                TargetID:   userID.String(),
+            })
+        }
+        return nil
     })
     if err != nil {
         respondWithError(w, 500, "Error updating user")
         return
     }
 
+    if dbUser.Email != currentUser.Email {
+        err = cfg.sendVerificationEmail(r.Context(), dbUser.ID, dbUser.Email)
+        if err != nil {
+            log.Printf("sending verification email: %v", err)
+        }
+    }
+
     response := User{
         ID:        dbUser.ID,
         CreatedAt: dbUser.CreatedAt,
         UpdatedAt: dbUser.UpdatedAt,
         Email:     dbUser.Email,
+        Role:      dbUser.Role,
+        EmailVerified: dbUser.EmailVerifiedAt.Valid,
     }
 
     respondWithJSON(w, 200, response)
 }
-
-func (cfg *APIConfig) AuthMiddleware(next http.Handler) http.Handler { 
-	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { 
-		authHeader := r.Header.Get("Authorization") 
-		if authHeader == "" { 
-			http.Error(w, "missing authorization header", http.StatusUnauthorized) 
-			return 
-		} 
-		
-		tokenStr := strings.TrimPrefix(authHeader, "Bearer ") 
-		if tokenStr == authHeader { 
-			http.Error(w, "invalid authorization header format", http.StatusUnauthorized) 
-			return 
-		} 
-		
-		userID, _, err := auth.ValidateJWT(tokenStr, cfg.Secret) 
-		if err != nil { 
-			http.Error(w, "invalid token", http.StatusUnauthorized) 
-			return 
-		} 
-		
-		ctx := context.WithValue(r.Context(), "userID", userID) 
-		next.ServeHTTP(w, r.WithContext(ctx)) 
-		}) 
-	}
-func (cfg *APIConfig) AdminOnly(next http.Handler) http.Handler {
-    return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
-        claims, ok := r.Context().Value("claims").(*auth.Claims)
-        if !ok || claims.Role != "admin" {
-            http.Error(w, "forbidden", http.StatusForbidden)
-            return
-        }
-        next.ServeHTTP(w, r)
-    })
-}
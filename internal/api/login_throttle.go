@@ -0,0 +1,160 @@
+package api
+
+import (
+	"database/sql"
+	"log"
+	"math"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+// loginPolicy decides how long logins are blocked after repeated failures.
+// After FreeAttempts failures each further failure blocks the next attempt
+// for BaseDelay, doubling every time up to MaxDelay. Reaching
+// LockoutThreshold locks logins for LockoutDuration and is audited.
+// Failures older than ResetAfter are forgotten.
+type loginPolicy struct {
+	FreeAttempts		int
+	BaseDelay			time.Duration
+	MaxDelay			time.Duration
+	LockoutThreshold	int
+	LockoutDuration		time.Duration
+	ResetAfter			time.Duration
+}
+
+// accountLoginPolicy applies per email address, whether or not an account
+// exists for it, so throttling doesn't reveal which addresses are registered.
+var accountLoginPolicy = loginPolicy{
+	FreeAttempts:		3,
+	BaseDelay:			time.Second,
+	MaxDelay:			5 * time.Minute,
+	LockoutThreshold:	10,
+	LockoutDuration:	15 * time.Minute,
+	ResetAfter:			time.Hour,
+}
+
+// ipLoginPolicy is looser than the account policy since many users can share
+// an address behind NAT, but still stops one client spraying many accounts.
+var ipLoginPolicy = loginPolicy{
+	FreeAttempts:		20,
+	BaseDelay:			time.Second,
+	MaxDelay:			time.Minute,
+	LockoutThreshold:	100,
+	LockoutDuration:	15 * time.Minute,
+	ResetAfter:			time.Hour,
+}
+
+// blockDuration returns how long to block logins after the given number of
+// consecutive failures.
+func (p loginPolicy) blockDuration(failures int) time.Duration {
+	if failures >= p.LockoutThreshold {
+		return p.LockoutDuration
+	}
+	if failures < p.FreeAttempts {
+		return 0
+	}
+
+	shift := failures - p.FreeAttempts
+	if shift > 30 {
+		return p.MaxDelay
+	}
+	delay := p.BaseDelay << shift
+	if delay > p.MaxDelay || delay <= 0 {
+		return p.MaxDelay
+	}
+	return delay
+}
+
+func accountThrottleKey(email string) string {
+	return "account:" + strings.ToLower(strings.TrimSpace(email))
+}
+
+func ipThrottleKey(ip string) string {
+	return "ip:" + ip
+}
+
+// checkLoginThrottle responds with 429 if logins for email or from the
+// client's address are currently blocked. It reports whether the handler
+// should continue.
+func (cfg *APIConfig) checkLoginThrottle(w http.ResponseWriter, r *http.Request, email string) bool {
+	lockedUntil, err := cfg.DB.GetLoginLockedUntil(r.Context(), []string{
+		accountThrottleKey(email),
+		ipThrottleKey(cfg.clientIP(r)),
+	})
+	if err != nil {
+		respondWithError(w, 500, "Something went wrong")
+		return false
+	}
+
+	wait := time.Until(lockedUntil.Time)
+	if !lockedUntil.Valid || wait <= 0 {
+		return true
+	}
+
+	w.Header().Set("Retry-After", strconv.Itoa(int(math.Ceil(wait.Seconds()))))
+	respondWithError(w, 429, "Too many failed login attempts, try again later")
+	return false
+}
+
+// recordLoginFailure counts a failed login against email and the client's
+// address and blocks further attempts according to their policies.
+func (cfg *APIConfig) recordLoginFailure(r *http.Request, email string) {
+	cfg.throttleLogin(r, accountThrottleKey(email), accountLoginPolicy)
+	cfg.throttleLogin(r, ipThrottleKey(cfg.clientIP(r)), ipLoginPolicy)
+}
+
+func (cfg *APIConfig) throttleLogin(r *http.Request, key string, policy loginPolicy) {
+	now := time.Now().UTC()
+
+	failures, err := cfg.DB.RecordLoginFailure(r.Context(), database.RecordLoginFailureParams{
+		Key:			key,
+		LastFailureAt:	now,
+		ResetBefore:	now.Add(-policy.ResetAfter),
+	})
+	if err != nil {
+		log.Printf("recording login failure: %v", err)
+		return
+	}
+
+	block := policy.blockDuration(int(failures))
+	if block == 0 {
+		return
+	}
+
+	lockedUntil := now.Add(block)
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		err := q.SetLoginLockedUntil(r.Context(), database.SetLoginLockedUntilParams{
+			Key:			key,
+			LockedUntil:	sql.NullTime{Time: lockedUntil, Valid: true},
+		})
+		if err != nil || int(failures) != policy.LockoutThreshold {
+			return err
+		}
+		return cfg.recordAudit(r, q, uuid.Nil, auditEvent{
+			Action:		auditLoginLockout,
+			TargetType:	"login",
+			TargetID:	key,
+			Details:	map[string]interface{}{
+				"failures":		failures,
+				"locked_until":	lockedUntil,
+			},
+		})
+	})
+	if err != nil {
+		log.Printf("locking login: %v", err)
+	}
+}
+
+// clearLoginFailures forgets the failed logins for email after a successful
+// login. The address's count is left to expire so one valid account can't be
+// used to reset it.
+func (cfg *APIConfig) clearLoginFailures(r *http.Request, email string) {
+	_, err := cfg.DB.ClearLoginThrottle(r.Context(), accountThrottleKey(email))
+	if err != nil {
+		log.Printf("clearing login failures: %v", err)
+	}
+}
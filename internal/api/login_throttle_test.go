@@ -0,0 +1,60 @@
+package api
+
+import (
+	"testing"
+	"time"
+)
+
+func TestLoginPolicyBlockDuration(t *testing.T) {
+	policy := loginPolicy{
+		FreeAttempts:     3,
+		BaseDelay:        time.Second,
+		MaxDelay:         time.Minute,
+		LockoutThreshold: 10,
+		LockoutDuration:  15 * time.Minute,
+	}
+
+	tests := map[int]time.Duration{
+		0:    0,
+		2:    0,
+		3:    time.Second,
+		4:    2 * time.Second,
+		5:    4 * time.Second,
+		8:    32 * time.Second,
+		9:    time.Minute,
+		10:   15 * time.Minute,
+		50:   15 * time.Minute,
+		1000: 15 * time.Minute,
+	}
+
+	for failures, want := range tests {
+		if got := policy.blockDuration(failures); got != want {
+			t.Errorf("%d failures: expected %v, got %v", failures, want, got)
+		}
+	}
+}
+
+func TestLoginPolicyBackoffIsCapped(t *testing.T) {
+	policy := loginPolicy{
+		FreeAttempts:     1,
+		BaseDelay:        time.Second,
+		MaxDelay:         5 * time.Minute,
+		LockoutThreshold: 1 << 20,
+		LockoutDuration:  time.Hour,
+	}
+
+	for failures := 0; failures < 200; failures++ {
+		if got := policy.blockDuration(failures); got < 0 || got > policy.MaxDelay {
+			t.Fatalf("%d failures: delay %v outside [0, %v]", failures, got, policy.MaxDelay)
+		}
+	}
+}
+
+func TestThrottleKeysNormaliseEmail(t *testing.T) {
+	if accountThrottleKey(" Wizard@Example.com ") != accountThrottleKey("wizard@example.com") {
+		t.Fatalf("expected account keys to ignore case and surrounding space")
+	}
+	if accountThrottleKey("1.2.3.4") == ipThrottleKey("1.2.3.4") {
+		t.Fatalf("expected account and address keys not to collide")
+	}
+}
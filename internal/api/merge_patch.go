@@ -0,0 +1,47 @@
+package api
+
+import (
+	"encoding/json"
+)
+
+// mergePatch applies a JSON Merge Patch (RFC 7396) to target. Members of the
+// patch replace those of the target, null members remove them, and objects
+// are merged recursively. Any patch that isn't an object replaces the target
+// outright.
+func mergePatch(target, patch json.RawMessage) (json.RawMessage, error) {
+	var patchValue interface{}
+	if err := json.Unmarshal(patch, &patchValue); err != nil {
+		return nil, err
+	}
+
+	var targetValue interface{}
+	if len(target) > 0 {
+		if err := json.Unmarshal(target, &targetValue); err != nil {
+			return nil, err
+		}
+	}
+
+	return json.Marshal(mergeValue(targetValue, patchValue))
+}
+
+func mergeValue(target, patch interface{}) interface{} {
+	patchObject, ok := patch.(map[string]interface{})
+	if !ok {
+		return patch
+	}
+
+	targetObject, ok := target.(map[string]interface{})
+	if !ok {
+		targetObject = map[string]interface{}{}
+	}
+
+	for key, value := range patchObject {
+		if value == nil {
+			delete(targetObject, key)
+			continue
+		}
+		targetObject[key] = mergeValue(targetObject[key], value)
+	}
+
+	return targetObject
+}
@@ -0,0 +1,148 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"log"
+	"net/http"
+	"time"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+var errInvalidAPIKey = errors.New("invalid api key")
+
+// authenticate resolves the principal for the request's bearer token, which
+// is either an access JWT or a personal API key.
+func (cfg *APIConfig) authenticate(r *http.Request) (auth.Principal, error) {
+	// The rate limiter may already have authenticated the request.
+	if principal, ok := auth.PrincipalFromContext(r.Context()); ok {
+		return principal, nil
+	}
+
+	token, err := auth.GetBearerToken(r.Header)
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	if !auth.IsAPIKey(token) {
+		return cfg.Keys.ParseAccessToken(token)
+	}
+
+	key, err := cfg.DB.GetAPIKeyByHash(r.Context(), auth.HashToken(token))
+	if err == sql.ErrNoRows {
+		return auth.Principal{}, errInvalidAPIKey
+	}
+	if err != nil {
+		return auth.Principal{}, err
+	}
+
+	if key.RevokedAt.Valid || key.DisabledAt.Valid || (key.ExpiresAt.Valid && !time.Now().Before(key.ExpiresAt.Time)) {
+		return auth.Principal{}, errInvalidAPIKey
+	}
+
+	err = cfg.DB.TouchAPIKey(r.Context(), key.ID)
+	if err != nil {
+		log.Printf("updating api key last used: %v", err)
+	}
+
+	return auth.Principal{
+		UserID:		key.UserID,
+		Role:		key.Role,
+		APIKeyID:	key.ID,
+		Scopes:		key.Scopes,
+	}, nil
+}
+
+// authorize authenticates a handler that isn't wrapped in AuthMiddleware and
+// checks the caller holds scope. It reports whether the handler should
+// continue.
+func (cfg *APIConfig) authorize(w http.ResponseWriter, r *http.Request, scope string) (auth.Principal, bool) {
+	principal, err := cfg.authenticate(r)
+	if err != nil {
+		respondWithError(w, 401, "Error validating token")
+		return principal, false
+	}
+
+	if !principal.HasScope(scope) {
+		respondWithError(w, 403, "API key is missing the "+scope+" scope")
+		return principal, false
+	}
+
+	return principal, true
+}
+
+// AuthMiddleware validates the bearer token or API key and stores the
+// caller's auth.Principal in the request context.
+func (cfg *APIConfig) AuthMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, err := cfg.authenticate(r)
+		if err != nil {
+			http.Error(w, "invalid token", http.StatusUnauthorized)
+			return
+		}
+
+		ctx := auth.WithPrincipal(r.Context(), principal)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+// RequireRole only lets through requests whose principal holds one of roles.
+// It must be wrapped by AuthMiddleware.
+func (cfg *APIConfig) RequireRole(roles ...string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.PrincipalFromContext(r.Context())
+			if !ok || !principal.HasRole(roles...) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequirePermission only lets through requests whose user's current role
+// grants permission. The role is read from the database rather than the
+// token, so role changes apply immediately. It must be wrapped by
+// AuthMiddleware.
+func (cfg *APIConfig) RequirePermission(permission string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.PrincipalFromContext(r.Context())
+			if !ok {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+
+			allowed, err := cfg.DB.UserHasPermission(r.Context(), database.UserHasPermissionParams{
+				UserID:		principal.UserID,
+				Permission:	permission,
+			})
+			if err != nil {
+				http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+				return
+			}
+			if !allowed {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// RequireScope only lets through requests whose principal holds scope. It
+// must be wrapped by AuthMiddleware.
+func (cfg *APIConfig) RequireScope(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			principal, ok := auth.PrincipalFromContext(r.Context())
+			if !ok || !principal.HasScope(scope) {
+				http.Error(w, "forbidden", http.StatusForbidden)
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
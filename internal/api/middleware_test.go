@@ -0,0 +1,173 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/auth"
+)
+
+func newAdminTestMux(cfg *APIConfig, reached *auth.Principal) *http.ServeMux {
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		principal, _ := auth.PrincipalFromContext(r.Context())
+		*reached = principal
+		w.WriteHeader(http.StatusOK)
+	})
+
+	mux := http.NewServeMux()
+	mux.Handle("POST /api/spells/update/{index}", cfg.AuthMiddleware(cfg.RequireRole("admin")(inner)))
+	mux.Handle("POST /api/admin/users", cfg.AuthMiddleware(cfg.RequireRole("admin")(inner)))
+	return mux
+}
+
+func TestAdminRoutes(t *testing.T) {
+	cfg := &APIConfig{Secret: "test-secret", Keys: auth.NewHMACKeySet("test-secret")}
+	userID := uuid.New()
+
+	adminToken, err := auth.MakeJWT(userID, "admin", cfg.Secret, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+	userToken, err := auth.MakeJWT(userID, "user", cfg.Secret, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		header string
+		want   int
+	}{
+		{"no token", "", http.StatusUnauthorized},
+		{"malformed header", adminToken, http.StatusUnauthorized},
+		{"invalid token", "Bearer not-a-token", http.StatusUnauthorized},
+		{"user role", "Bearer " + userToken, http.StatusForbidden},
+		{"admin role", "Bearer " + adminToken, http.StatusOK},
+	}
+
+	for _, path := range []string{"/api/spells/update/fireball", "/api/admin/users"} {
+		for _, tc := range tests {
+			t.Run(path+" "+tc.name, func(t *testing.T) {
+				var reached auth.Principal
+				mux := newAdminTestMux(cfg, &reached)
+
+				req := httptest.NewRequest(http.MethodPost, path, nil)
+				if tc.header != "" {
+					req.Header.Set("Authorization", tc.header)
+				}
+				rec := httptest.NewRecorder()
+				mux.ServeHTTP(rec, req)
+
+				if rec.Code != tc.want {
+					t.Fatalf("expected status %d, got %d", tc.want, rec.Code)
+				}
+				if tc.want == http.StatusOK && (reached.UserID != userID || reached.Role != "admin") {
+					t.Fatalf("handler saw unexpected principal: %+v", reached)
+				}
+				if tc.want != http.StatusOK && reached.UserID != uuid.Nil {
+					t.Fatalf("handler was reached for a rejected request")
+				}
+			})
+		}
+	}
+}
+
+func TestRequireRoleMultipleRoles(t *testing.T) {
+	cfg := &APIConfig{}
+	handler := cfg.RequireRole("admin", "editor")(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	for role, want := range map[string]int{
+		"editor": http.StatusNoContent,
+		"admin":  http.StatusNoContent,
+		"user":   http.StatusForbidden,
+	} {
+		req := httptest.NewRequest(http.MethodGet, "/", nil)
+		req = req.WithContext(auth.WithPrincipal(req.Context(), auth.Principal{UserID: uuid.New(), Role: role}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+
+		if rec.Code != want {
+			t.Fatalf("role %q: expected status %d, got %d", role, want, rec.Code)
+		}
+	}
+}
+
+func TestRequireScope(t *testing.T) {
+	cfg := &APIConfig{}
+	handler := cfg.RequireScope(auth.ScopeCharactersWrite)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	tests := []struct {
+		name      string
+		principal auth.Principal
+		want      int
+	}{
+		{"session", auth.Principal{UserID: uuid.New(), Role: "user"}, http.StatusNoContent},
+		{"key with scope", auth.Principal{UserID: uuid.New(), APIKeyID: uuid.New(), Scopes: []string{auth.ScopeCharactersWrite}}, http.StatusNoContent},
+		{"key without scope", auth.Principal{UserID: uuid.New(), APIKeyID: uuid.New(), Scopes: []string{auth.ScopeCharactersRead}}, http.StatusForbidden},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			req := httptest.NewRequest(http.MethodGet, "/", nil)
+			req = req.WithContext(auth.WithPrincipal(req.Context(), tc.principal))
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if rec.Code != tc.want {
+				t.Fatalf("expected status %d, got %d", tc.want, rec.Code)
+			}
+		})
+	}
+}
+
+func TestAPIKeyCannotReachAccountScope(t *testing.T) {
+	for _, scope := range auth.APIKeyScopes {
+		if scope == auth.ScopeAccount {
+			t.Fatalf("API keys must not be grantable the %q scope", auth.ScopeAccount)
+		}
+	}
+	if auth.IsAPIKeyScope(auth.ScopeAccount) {
+		t.Fatalf("IsAPIKeyScope accepted %q", auth.ScopeAccount)
+	}
+}
+
+func TestRequirePermissionWithoutPrincipal(t *testing.T) {
+	cfg := &APIConfig{}
+	handler := cfg.RequirePermission(auth.PermissionSpellsEdit)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("handler reached without a principal")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodPost, "/", nil))
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("expected status %d, got %d", http.StatusForbidden, rec.Code)
+	}
+}
+
+func TestCORSPreflightAllowsAuthHeaders(t *testing.T) {
+	handler := EnableCORS(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		t.Fatalf("preflight request reached the handler")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest(http.MethodOptions, "/api/spells", nil))
+
+	allowed := map[string]bool{}
+	for _, header := range strings.Split(rec.Header().Get("Access-Control-Allow-Headers"), ",") {
+		allowed[http.CanonicalHeaderKey(strings.TrimSpace(header))] = true
+	}
+	for _, header := range []string{"Authorization", "X-Api-Key", "Content-Type"} {
+		if !allowed[header] {
+			t.Errorf("Access-Control-Allow-Headers doesn't include %s", header)
+		}
+	}
+}
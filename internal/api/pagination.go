@@ -0,0 +1,95 @@
+package api
+
+import (
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+const (
+	defaultPageLimit = 50
+	maxPageLimit     = 200
+)
+
+// ListResponse is the envelope every paginated list route responds with.
+// NextCursor is empty on the last page.
+type ListResponse[T any] struct {
+	Data			[]T					`json:"data"`
+	NextCursor		string				`json:"next_cursor"`
+	Total			int64				`json:"total"`
+}
+
+// parsePage reads the limit, cursor, sort and order query parameters.
+func parsePage(query url.Values, defaultSort string) (database.Page, error) {
+	page := database.Page{
+		Limit:	defaultPageLimit,
+		Sort:	defaultSort,
+		Cursor:	query.Get("cursor"),
+	}
+
+	if limit := query.Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			return page, errors.New("invalid limit")
+		}
+		page.Limit = int32(min(n, maxPageLimit))
+	}
+
+	if sort := query.Get("sort"); sort != "" {
+		page.Sort = sort
+	}
+
+	switch query.Get("order") {
+	case "", "asc":
+	case "desc":
+		page.Desc = true
+	default:
+		return page, errors.New("invalid order, expected asc or desc")
+	}
+
+	return page, nil
+}
+
+func isPageError(err error) bool {
+	return errors.Is(err, database.ErrInvalidCursor) || errors.Is(err, database.ErrInvalidSort)
+}
+
+// respondWithSpellPage responds with one page of the spells matching filter,
+// converting each row with convert.
+func respondWithSpellPage[T any](cfg *APIConfig, w http.ResponseWriter, r *http.Request, filter database.SpellFilter, convert func(database.FilterSpellsRow) T) {
+	page, err := parsePage(r.URL.Query(), "level")
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+
+	spells, nextCursor, err := cfg.DB.FilterSpells(r.Context(), filter, page)
+	if isPageError(err) {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	if err != nil {
+		respondWithError(w, 500, "Error getting spells")
+		return
+	}
+
+	total, err := cfg.DB.CountSpells(r.Context(), filter)
+	if err != nil {
+		respondWithError(w, 500, "Error counting spells")
+		return
+	}
+
+	returnSlice := []T{}
+
+	for _, spell := range spells {
+		returnSlice = append(returnSlice, convert(spell))
+	}
+
+	respondWithJSON(w, 200, ListResponse[T]{
+		Data:		returnSlice,
+		NextCursor:	nextCursor,
+		Total:		total,
+	})
+}
@@ -0,0 +1,48 @@
+package api
+
+import (
+	"net/url"
+	"testing"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+func TestParsePage(t *testing.T) {
+	tests := []struct {
+		name	string
+		query	string
+		want	database.Page
+		wantErr	bool
+	}{
+		{"defaults", "", database.Page{Limit: defaultPageLimit, Sort: "name"}, false},
+		{"limit", "limit=10", database.Page{Limit: 10, Sort: "name"}, false},
+		{"smallest limit", "limit=1", database.Page{Limit: 1, Sort: "name"}, false},
+		{"largest limit", "limit=200", database.Page{Limit: maxPageLimit, Sort: "name"}, false},
+		{"limit over the maximum", "limit=500", database.Page{Limit: maxPageLimit, Sort: "name"}, false},
+		{"sort, order and cursor", "sort=level&order=desc&cursor=abc", database.Page{Limit: defaultPageLimit, Sort: "level", Desc: true, Cursor: "abc"}, false},
+		{"ascending", "order=asc", database.Page{Limit: defaultPageLimit, Sort: "name"}, false},
+		{"zero limit", "limit=0", database.Page{}, true},
+		{"negative limit", "limit=-1", database.Page{}, true},
+		{"limit not a number", "limit=abc", database.Page{}, true},
+		{"unknown order", "order=up", database.Page{}, true},
+		{"uppercase order", "order=DESC", database.Page{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			got, err := parsePage(query, "name")
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parsePage(%q) = %+v, want an error", tt.query, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parsePage(%q) error: %v", tt.query, err)
+			}
+			if got != tt.want {
+				t.Errorf("parsePage(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
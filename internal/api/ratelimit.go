@@ -0,0 +1,70 @@
+package api
+
+import (
+	"math"
+	"net/http"
+	"strconv"
+	"time"
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/ratelimit"
+)
+
+// RateLimit limits requests per API key, per user for requests with an
+// access token, and per client address for anonymous requests. Every
+// response carries RateLimit-* headers describing the caller's bucket.
+func (cfg *APIConfig) RateLimit(limiter *ratelimit.Limiter) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			key, r := cfg.rateLimitKey(r)
+			decision := limiter.Allow(key)
+
+			header := w.Header()
+			header.Set("RateLimit-Policy", limiter.Policy().String())
+			header.Set("RateLimit-Limit", strconv.Itoa(decision.Limit))
+			header.Set("RateLimit-Remaining", strconv.Itoa(decision.Remaining))
+			header.Set("RateLimit-Reset", ceilSeconds(decision.Reset))
+
+			if !decision.Allowed {
+				header.Set("Retry-After", ceilSeconds(decision.RetryAfter))
+				respondWithError(w, 429, http.StatusText(http.StatusTooManyRequests))
+				return
+			}
+
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// rateLimitKey identifies the caller for rate limiting. Authenticating here
+// costs the same as in the handler, so the principal is stored in the
+// returned request's context for authenticate to reuse. Requests with
+// invalid credentials are limited by address like anonymous ones.
+func (cfg *APIConfig) rateLimitKey(r *http.Request) (string, *http.Request) {
+	principal, ok := auth.PrincipalFromContext(r.Context())
+	if !ok && hasCredentials(r) {
+		var err error
+		principal, err = cfg.authenticate(r)
+		if err == nil {
+			ok = true
+			r = r.WithContext(auth.WithPrincipal(r.Context(), principal))
+		}
+	}
+
+	switch {
+	case ok && principal.APIKeyID != uuid.Nil:
+		return "key:" + principal.APIKeyID.String(), r
+	case ok:
+		return "user:" + principal.UserID.String(), r
+	default:
+		return "ip:" + cfg.clientIP(r), r
+	}
+}
+
+func hasCredentials(r *http.Request) bool {
+	return r.Header.Get("Authorization") != "" || r.Header.Get("X-API-Key") != ""
+}
+
+func ceilSeconds(d time.Duration) string {
+	return strconv.Itoa(int(math.Ceil(d.Seconds())))
+}
@@ -0,0 +1,76 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/kblasti/spellbook/internal/auth"
+	"github.com/kblasti/spellbook/internal/ratelimit"
+)
+
+func TestRateLimitKeysByCaller(t *testing.T) {
+	cfg := &APIConfig{Keys: auth.NewHMACKeySet("test-secret")}
+	limiter := ratelimit.New(ratelimit.Policy{Requests: 1, Window: time.Minute})
+
+	var reached auth.Principal
+	handler := cfg.RateLimit(limiter)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		reached, _ = auth.PrincipalFromContext(r.Context())
+		w.WriteHeader(http.StatusNoContent)
+	}))
+
+	userID := uuid.New()
+	token, err := auth.MakeJWT(userID, "user", "test-secret", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+
+	do := func(remoteAddr, authorization string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(http.MethodGet, "/api/spells", nil)
+		req.RemoteAddr = remoteAddr
+		if authorization != "" {
+			req.Header.Set("Authorization", authorization)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, req)
+		return rec
+	}
+
+	rec := do("10.0.0.1:1234", "Bearer "+token)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("expected the first user request to pass, got %d", rec.Code)
+	}
+	if reached.UserID != userID {
+		t.Fatalf("expected the authenticated principal to be passed on, got %+v", reached)
+	}
+	if rec.Header().Get("RateLimit-Limit") != "1" || rec.Header().Get("RateLimit-Remaining") != "0" || rec.Header().Get("RateLimit-Policy") != "1;w=60" {
+		t.Fatalf("unexpected rate limit headers %v", rec.Header())
+	}
+
+	// The same user from another address shares a bucket.
+	rec = do("10.0.0.2:1234", "Bearer "+token)
+	if rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected the user's second request to be limited, got %d", rec.Code)
+	}
+	if rec.Header().Get("Retry-After") != "60" {
+		t.Fatalf("expected Retry-After 60, got %q", rec.Header().Get("Retry-After"))
+	}
+
+	// Anonymous callers are limited by address, independently of the user.
+	if rec := do("10.0.0.1:1234", ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected an anonymous request to pass, got %d", rec.Code)
+	}
+	if rec := do("10.0.0.1:5678", ""); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected a second anonymous request from the address to be limited, got %d", rec.Code)
+	}
+
+	// Invalid credentials fall back to the address bucket.
+	if rec := do("10.0.0.3:1234", "Bearer not-a-token"); rec.Code != http.StatusNoContent {
+		t.Fatalf("expected a request with a bad token to pass the limiter, got %d", rec.Code)
+	}
+	if rec := do("10.0.0.3:1234", ""); rec.Code != http.StatusTooManyRequests {
+		t.Fatalf("expected a bad token to share the address bucket, got %d", rec.Code)
+	}
+}
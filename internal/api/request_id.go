@@ -0,0 +1,44 @@
+package api
+
+import (
+	"context"
+	"net/http"
+	"github.com/google/uuid"
+)
+
+type requestIDKey struct{}
+
+const requestIDHeader = "X-Request-ID"
+
+// RequestID tags every request with an ID, echoed in the X-Request-ID
+// response header and recorded in the audit log. A well-formed ID sent by
+// the client or a proxy is kept so logs can be correlated across services.
+func RequestID(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := r.Header.Get(requestIDHeader)
+		if !validRequestID(id) {
+			id = uuid.NewString()
+		}
+
+		w.Header().Set(requestIDHeader, id)
+		ctx := context.WithValue(r.Context(), requestIDKey{}, id)
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
+
+func validRequestID(id string) bool {
+	if id == "" || len(id) > 128 {
+		return false
+	}
+	for _, c := range id {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+func requestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey{}).(string)
+	return id
+}
@@ -0,0 +1,47 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRequestID(t *testing.T) {
+	tests := []struct {
+		name	string
+		header	string
+		keep	bool
+	}{
+		{"generated when missing", "", false},
+		{"kept when well formed", "req-7f3a9c", true},
+		{"replaced when it contains spaces", "two words", false},
+		{"replaced when too long", strings.Repeat("a", 129), false},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var seen string
+			handler := RequestID(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				seen = requestIDFromContext(r.Context())
+			}))
+
+			req := httptest.NewRequest("GET", "/api/spells", nil)
+			if tt.header != "" {
+				req.Header.Set(requestIDHeader, tt.header)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, req)
+
+			if seen == "" {
+				t.Fatal("no request ID in context")
+			}
+			if got := rec.Header().Get(requestIDHeader); got != seen {
+				t.Errorf("response header = %q, context = %q", got, seen)
+			}
+			if (seen == tt.header) != tt.keep {
+				t.Errorf("request ID = %q for header %q, keep = %v", seen, tt.header, tt.keep)
+			}
+		})
+	}
+}
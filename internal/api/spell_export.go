@@ -0,0 +1,405 @@
+package api
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+// spellEncoder writes spells in one export format. Nothing is written until
+// the first Encode, and Close finishes the document.
+type spellEncoder interface {
+	Encode(spell Spell) error
+	Close() error
+}
+
+type spellExportFormat struct {
+	ContentType		string
+	Extension		string
+	NewEncoder		func(w io.Writer) spellEncoder
+}
+
+var spellExportFormats = map[string]spellExportFormat{
+	"json":	{"application/json", "json", newJSONSpellEncoder},
+	"csv":	{"text/csv; charset=utf-8", "csv", newCSVSpellEncoder},
+	"md":	{"text/markdown; charset=utf-8", "md", newMarkdownSpellEncoder},
+}
+
+// negotiateExportFormat picks the export format from the format query
+// parameter, falling back to the Accept header and then to JSON. It returns
+// the status to respond with when no format fits.
+func negotiateExportFormat(r *http.Request) (string, int) {
+	if format := r.URL.Query().Get("format"); format != "" {
+		if _, ok := spellExportFormats[format]; !ok {
+			return "", 400
+		}
+		return format, 0
+	}
+
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		return "json", 0
+	}
+
+	type mediaRange struct {
+		mediaType	string
+		q			float64
+	}
+	var ranges []mediaRange
+	for _, part := range strings.Split(accept, ",") {
+		mediaType, params, err := mime.ParseMediaType(strings.TrimSpace(part))
+		if err != nil {
+			continue
+		}
+		q := 1.0
+		if value, ok := params["q"]; ok {
+			q, err = strconv.ParseFloat(value, 64)
+			if err != nil {
+				continue
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, mediaRange{mediaType, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, mr := range ranges {
+		switch mr.mediaType {
+		case "application/json", "application/*", "*/*":
+			return "json", 0
+		case "text/csv":
+			return "csv", 0
+		case "text/markdown":
+			return "md", 0
+		}
+	}
+	return "", 406
+}
+
+// HandlerExportSpells streams every spell matching the list filters, with
+// all of its fields, as JSON, CSV or Markdown.
+func (cfg *APIConfig) HandlerExportSpells(w http.ResponseWriter, r *http.Request) {
+	name, status := negotiateExportFormat(r)
+	if status == 400 {
+		respondWithError(w, 400, "Invalid format, expected json, csv or md")
+		return
+	}
+	if status == 406 {
+		respondWithError(w, 406, "Export is available as application/json, text/csv or text/markdown")
+		return
+	}
+	format := spellExportFormats[name]
+
+	filter, err := parseSpellFilter(r.URL.Query())
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	page, err := parsePage(r.URL.Query(), "level")
+	if err != nil {
+		respondWithError(w, 400, err.Error())
+		return
+	}
+	page.Limit, page.Cursor = 0, ""
+
+	enc := format.NewEncoder(w)
+	started := false
+	start := func() {
+		w.Header().Set("Content-Type", format.ContentType)
+		w.Header().Set("Content-Disposition", fmt.Sprintf(`attachment; filename="spells.%s"`, format.Extension))
+		started = true
+	}
+
+	err = cfg.DB.ExportSpells(r.Context(), filter, page, func(spell database.GetSpellRow) error {
+		if !started {
+			start()
+		}
+		return enc.Encode(spellFromRow(spell))
+	})
+	if err != nil && !started {
+		if isPageError(err) {
+			respondWithError(w, 400, err.Error())
+			return
+		}
+		respondWithError(w, 500, "Error exporting spells")
+		return
+	}
+	if err != nil {
+		// The status has already been sent, so the only way to tell the
+		// client the export is incomplete is to cut the response short.
+		log.Printf("exporting spells: %v", err)
+		panic(http.ErrAbortHandler)
+	}
+
+	if !started {
+		start()
+	}
+	enc.Close()
+	return
+}
+
+// jsonSpellEncoder writes a JSON array, one spell at a time.
+type jsonSpellEncoder struct {
+	w	io.Writer
+	n	int
+}
+
+func newJSONSpellEncoder(w io.Writer) spellEncoder {
+	return &jsonSpellEncoder{w: w}
+}
+
+func (e *jsonSpellEncoder) Encode(spell Spell) error {
+	data, err := json.Marshal(spell)
+	if err != nil {
+		return err
+	}
+
+	sep := ","
+	if e.n == 0 {
+		sep = "["
+	}
+	e.n++
+	_, err = fmt.Fprintf(e.w, "%s\n%s", sep, data)
+	return err
+}
+
+func (e *jsonSpellEncoder) Close() error {
+	if e.n == 0 {
+		_, err := io.WriteString(e.w, "[]\n")
+		return err
+	}
+	_, err := io.WriteString(e.w, "\n]\n")
+	return err
+}
+
+var spellCSVHeader = []string{
+	"index", "name", "level", "school", "casting_time", "range", "components",
+	"material", "duration", "concentration", "ritual", "attack_type", "desc",
+	"higher_level", "damage",
+}
+
+// csvSpellEncoder writes one row per spell. Paragraphs of desc and
+// higher_level are separated by blank lines, and damage is kept as JSON.
+type csvSpellEncoder struct {
+	w		*csv.Writer
+	header	bool
+}
+
+func newCSVSpellEncoder(w io.Writer) spellEncoder {
+	return &csvSpellEncoder{w: csv.NewWriter(w)}
+}
+
+func (e *csvSpellEncoder) writeHeader() error {
+	if e.header {
+		return nil
+	}
+	e.header = true
+	return e.w.Write(spellCSVHeader)
+}
+
+func (e *csvSpellEncoder) Encode(spell Spell) error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+
+	damage := ""
+	if len(spell.Damage) > 0 && string(spell.Damage) != "null" {
+		damage = string(spell.Damage)
+	}
+
+	return e.w.Write([]string{
+		spell.Index,
+		spell.Name,
+		strconv.Itoa(int(spell.Level)),
+		spellSchoolName(spell.School),
+		spell.CastingTime,
+		spell.Range,
+		strings.Join(spell.Components, ", "),
+		spell.Material,
+		spell.Duration,
+		strconv.FormatBool(spell.Concentration),
+		strconv.FormatBool(spell.Ritual),
+		spell.AttackType,
+		strings.Join(spell.Desc, "\n\n"),
+		strings.Join(spell.HigherLevel, "\n\n"),
+		damage,
+	})
+}
+
+func (e *csvSpellEncoder) Close() error {
+	if err := e.writeHeader(); err != nil {
+		return err
+	}
+	e.w.Flush()
+	return e.w.Error()
+}
+
+// markdownSpellEncoder writes each spell as a section in the style of a
+// rulebook entry.
+type markdownSpellEncoder struct {
+	w	io.Writer
+	n	int
+}
+
+func newMarkdownSpellEncoder(w io.Writer) spellEncoder {
+	return &markdownSpellEncoder{w: w}
+}
+
+func (e *markdownSpellEncoder) Encode(spell Spell) error {
+	var b strings.Builder
+	if e.n > 0 {
+		b.WriteString("\n")
+	}
+	e.n++
+
+	fmt.Fprintf(&b, "## %s\n\n*%s*\n\n", spell.Name, spellLevelSchool(spell))
+	fmt.Fprintf(&b, "- **Casting Time:** %s\n", spell.CastingTime)
+	fmt.Fprintf(&b, "- **Range:** %s\n", spell.Range)
+	fmt.Fprintf(&b, "- **Components:** %s\n", spellComponentsText(spell))
+	fmt.Fprintf(&b, "- **Duration:** %s\n", spellDuration(spell))
+	if damage := spellDamageSummary(spell.Damage); damage != "" {
+		fmt.Fprintf(&b, "- **Damage:** %s\n", damage)
+	}
+
+	for _, paragraph := range spell.Desc {
+		fmt.Fprintf(&b, "\n%s\n", paragraph)
+	}
+	for i, paragraph := range spell.HigherLevel {
+		if i == 0 {
+			paragraph = "***At Higher Levels.*** " + paragraph
+		}
+		fmt.Fprintf(&b, "\n%s\n", paragraph)
+	}
+
+	_, err := io.WriteString(e.w, b.String())
+	return err
+}
+
+func (e *markdownSpellEncoder) Close() error {
+	return nil
+}
+
+// spellSchoolName reads the name out of a spell's school reference.
+func spellSchoolName(school json.RawMessage) string {
+	var ref struct {
+		Index	string	`json:"index"`
+		Name	string	`json:"name"`
+	}
+	if json.Unmarshal(school, &ref) != nil {
+		return ""
+	}
+	if ref.Name != "" {
+		return ref.Name
+	}
+	return ref.Index
+}
+
+// spellLevelSchool describes a spell the way the rulebook does, such as
+// "3rd-level Evocation" or "Evocation cantrip", adding "(ritual)" when it
+// can be cast as one.
+func spellLevelSchool(spell Spell) string {
+	school := spellSchoolName(spell.School)
+
+	var desc string
+	if spell.Level == 0 {
+		desc = strings.TrimSpace(school + " cantrip")
+	} else {
+		desc = strings.TrimSpace(ordinal(int(spell.Level)) + "-level " + school)
+	}
+	if spell.Ritual {
+		desc += " (ritual)"
+	}
+	return desc
+}
+
+// spellComponentsText lists the components with the material in brackets, as
+// in "V, S, M (a bit of fur)".
+func spellComponentsText(spell Spell) string {
+	components := strings.Join(spell.Components, ", ")
+	if spell.Material != "" {
+		components += " (" + spell.Material + ")"
+	}
+	return components
+}
+
+// spellDuration notes concentration in the duration when the duration text
+// doesn't already.
+func spellDuration(spell Spell) string {
+	if spell.Concentration && !strings.HasPrefix(strings.ToLower(spell.Duration), "concentration") {
+		return "Concentration, " + spell.Duration
+	}
+	return spell.Duration
+}
+
+func ordinal(n int) string {
+	suffix := "th"
+	switch n % 10 {
+	case 1:
+		suffix = "st"
+	case 2:
+		suffix = "nd"
+	case 3:
+		suffix = "rd"
+	}
+	if n%100 >= 11 && n%100 <= 13 {
+		suffix = "th"
+	}
+	return strconv.Itoa(n) + suffix
+}
+
+// spellDamageSummary renders a damage object as "Fire; slot level 3: 8d6,
+// 4: 9d6", or "" when the spell deals no damage.
+func spellDamageSummary(damage json.RawMessage) string {
+	var d struct {
+		DamageType	struct {
+			Name	string	`json:"name"`
+		}	`json:"damage_type"`
+		AtSlotLevel			map[string]string	`json:"damage_at_slot_level"`
+		AtCharacterLevel	map[string]string	`json:"damage_at_character_level"`
+	}
+	if len(damage) == 0 || json.Unmarshal(damage, &d) != nil {
+		return ""
+	}
+
+	var parts []string
+	if d.DamageType.Name != "" {
+		parts = append(parts, d.DamageType.Name)
+	}
+	if table := damageTable(d.AtSlotLevel); table != "" {
+		parts = append(parts, "slot level "+table)
+	}
+	if table := damageTable(d.AtCharacterLevel); table != "" {
+		parts = append(parts, "character level "+table)
+	}
+	return strings.Join(parts, "; ")
+}
+
+// damageTable lists a level to dice table in level order.
+func damageTable(table map[string]string) string {
+	levels := make([]string, 0, len(table))
+	for level := range table {
+		levels = append(levels, level)
+	}
+	sort.Slice(levels, func(i, j int) bool {
+		a, _ := strconv.Atoi(levels[i])
+		b, _ := strconv.Atoi(levels[j])
+		return a < b
+	})
+
+	entries := make([]string, len(levels))
+	for i, level := range levels {
+		entries[i] = level + ": " + table[level]
+	}
+	return strings.Join(entries, ", ")
+}
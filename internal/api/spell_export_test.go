@@ -0,0 +1,163 @@
+package api
+
+import (
+	"bytes"
+	"encoding/csv"
+	"encoding/json"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var fireball = Spell{
+	Index:			"fireball",
+	Name:			"Fireball",
+	Range:			"150 feet",
+	Material:		"A tiny ball of bat guano and sulfur.",
+	Duration:		"Instantaneous",
+	CastingTime:	"1 action",
+	Level:			3,
+	School:			json.RawMessage(`{"index": "evocation", "name": "Evocation", "url": "/api/magic-schools/evocation"}`),
+	Desc:			[]string{"A bright streak flashes.", "The fire spreads around corners."},
+	HigherLevel:	[]string{"The damage increases by 1d6 for each slot level above 3rd."},
+	Components:		[]string{"V", "S", "M"},
+	Damage:			json.RawMessage(`{"damage_type": {"index": "fire", "name": "Fire"}, "damage_at_slot_level": {"10": "15d6", "3": "8d6", "4": "9d6"}}`),
+}
+
+func TestNegotiateExportFormat(t *testing.T) {
+	cases := []struct {
+		url		string
+		accept	string
+		format	string
+		status	int
+	}{
+		{"/api/spells/export", "", "json", 0},
+		{"/api/spells/export?format=csv", "application/json", "csv", 0},
+		{"/api/spells/export?format=md", "", "md", 0},
+		{"/api/spells/export?format=pdf", "", "", 400},
+		{"/api/spells/export", "text/csv", "csv", 0},
+		{"/api/spells/export", "text/markdown; charset=utf-8", "md", 0},
+		{"/api/spells/export", "text/html, */*;q=0.1", "json", 0},
+		{"/api/spells/export", "application/json;q=0.5, text/markdown", "md", 0},
+		{"/api/spells/export", "text/csv;q=0, text/markdown;q=0.2", "md", 0},
+		{"/api/spells/export", "image/png", "", 406},
+	}
+
+	for _, c := range cases {
+		r := httptest.NewRequest("GET", c.url, nil)
+		if c.accept != "" {
+			r.Header.Set("Accept", c.accept)
+		}
+		format, status := negotiateExportFormat(r)
+		if format != c.format || status != c.status {
+			t.Errorf("%s with Accept %q = %q %d, want %q %d", c.url, c.accept, format, status, c.format, c.status)
+		}
+	}
+}
+
+func TestJSONSpellEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := newJSONSpellEncoder(&buf)
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "[]\n" {
+		t.Errorf("empty export = %q", buf.String())
+	}
+
+	buf.Reset()
+	enc = newJSONSpellEncoder(&buf)
+	enc.Encode(fireball)
+	enc.Encode(Spell{Index: "shield", Name: "Shield", Level: 1})
+	enc.Close()
+
+	var spells []Spell
+	if err := json.Unmarshal(buf.Bytes(), &spells); err != nil {
+		t.Fatalf("export is not valid JSON: %v\n%s", err, buf.String())
+	}
+	if len(spells) != 2 || spells[0].Index != "fireball" || spells[1].Index != "shield" {
+		t.Errorf("got %+v", spells)
+	}
+	if len(spells[0].Desc) != 2 || spells[0].HigherLevel[0] != fireball.HigherLevel[0] {
+		t.Errorf("fields were lost: %+v", spells[0])
+	}
+}
+
+func TestCSVSpellEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := newCSVSpellEncoder(&buf)
+	enc.Encode(fireball)
+	if err := enc.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	records, err := csv.NewReader(&buf).ReadAll()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(records) != 2 {
+		t.Fatalf("got %d records, want a header and one spell", len(records))
+	}
+
+	row := map[string]string{}
+	for i, column := range records[0] {
+		row[column] = records[1][i]
+	}
+	want := map[string]string{
+		"index":		"fireball",
+		"level":		"3",
+		"school":		"Evocation",
+		"components":	"V, S, M",
+		"desc":			"A bright streak flashes.\n\nThe fire spreads around corners.",
+		"damage":		string(fireball.Damage),
+	}
+	for column, value := range want {
+		if row[column] != value {
+			t.Errorf("%s = %q, want %q", column, row[column], value)
+		}
+	}
+}
+
+func TestCSVSpellEncoderEmpty(t *testing.T) {
+	var buf bytes.Buffer
+	newCSVSpellEncoder(&buf).Close()
+	if buf.String() != strings.Join(spellCSVHeader, ",")+"\n" {
+		t.Errorf("empty export = %q", buf.String())
+	}
+}
+
+func TestMarkdownSpellEncoder(t *testing.T) {
+	var buf bytes.Buffer
+	enc := newMarkdownSpellEncoder(&buf)
+	enc.Encode(fireball)
+	enc.Close()
+
+	for _, want := range []string{
+		"## Fireball\n\n*3rd-level Evocation*\n",
+		"- **Components:** V, S, M (A tiny ball of bat guano and sulfur.)\n",
+		"- **Damage:** Fire; slot level 3: 8d6, 4: 9d6, 10: 15d6\n",
+		"\nThe fire spreads around corners.\n",
+		"\n***At Higher Levels.*** The damage increases",
+	} {
+		if !strings.Contains(buf.String(), want) {
+			t.Errorf("missing %q in:\n%s", want, buf.String())
+		}
+	}
+}
+
+func TestSpellLevelSchool(t *testing.T) {
+	cases := []struct {
+		spell	Spell
+		want	string
+	}{
+		{Spell{Level: 0, School: json.RawMessage(`{"name": "Evocation"}`)}, "Evocation cantrip"},
+		{Spell{Level: 1, School: json.RawMessage(`{"name": "Abjuration"}`), Ritual: true}, "1st-level Abjuration (ritual)"},
+		{Spell{Level: 2, School: json.RawMessage(`{"index": "illusion"}`)}, "2nd-level illusion"},
+		{Spell{Level: 9}, "9th-level"},
+	}
+	for _, c := range cases {
+		if got := spellLevelSchool(c.spell); got != c.want {
+			t.Errorf("spellLevelSchool(level %d) = %q, want %q", c.spell.Level, got, c.want)
+		}
+	}
+}
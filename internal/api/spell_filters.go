@@ -0,0 +1,102 @@
+package api
+
+import (
+	"database/sql"
+	"errors"
+	"fmt"
+	"net/url"
+	"strconv"
+	"strings"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+// parseSpellFilter reads the spell list query parameters. Every parameter is
+// optional and they are all ANDed together:
+//
+//	level=3 or level=1-3, class, subclass, school, ritual=true|false,
+//	concentration=true|false, components=V,S,M, attack_type, casting_time
+func parseSpellFilter(query url.Values) (database.SpellFilter, error) {
+	filter := database.SpellFilter{
+		Class:			strings.ToLower(query.Get("class")),
+		Subclass:		strings.ToLower(query.Get("subclass")),
+		School:			query.Get("school"),
+		AttackType:		query.Get("attack_type"),
+		CastingTime:	query.Get("casting_time"),
+	}
+
+	if level := query.Get("level"); level != "" {
+		min, max, err := parseLevelRange(level)
+		if err != nil {
+			return filter, err
+		}
+		filter.MinLevel = sql.NullInt32{Int32: min, Valid: true}
+		filter.MaxLevel = sql.NullInt32{Int32: max, Valid: true}
+	}
+
+	ritual, err := parseOptionalBool(query, "ritual")
+	if err != nil {
+		return filter, err
+	}
+	filter.Ritual = ritual
+
+	concentration, err := parseOptionalBool(query, "concentration")
+	if err != nil {
+		return filter, err
+	}
+	filter.Concentration = concentration
+
+	if components := query.Get("components"); components != "" {
+		for _, c := range strings.Split(components, ",") {
+			c = strings.ToUpper(strings.TrimSpace(c))
+			if c != "V" && c != "S" && c != "M" {
+				return filter, fmt.Errorf("invalid component %q, expected V, S or M", c)
+			}
+			filter.Components = append(filter.Components, c)
+		}
+	}
+
+	return filter, nil
+}
+
+func parseLevelRange(level string) (int32, int32, error) {
+	lo, hi, isRange := strings.Cut(level, "-")
+	if !isRange {
+		hi = lo
+	}
+
+	min, err := parseSpellLevel(lo)
+	if err != nil {
+		return 0, 0, err
+	}
+	max, err := parseSpellLevel(hi)
+	if err != nil {
+		return 0, 0, err
+	}
+	if min > max {
+		return 0, 0, errors.New("invalid level range, minimum is greater than maximum")
+	}
+
+	return min, max, nil
+}
+
+func parseSpellLevel(s string) (int32, error) {
+	i64, err := strconv.ParseInt(strings.TrimSpace(s), 10, 32)
+	if err != nil || i64 < 0 || i64 > 9 {
+		return 0, fmt.Errorf("invalid level %q, expected 0-9", s)
+	}
+	return int32(i64), nil
+}
+
+func parseOptionalBool(query url.Values, key string) (sql.NullBool, error) {
+	val := query.Get(key)
+	if val == "" {
+		return sql.NullBool{}, nil
+	}
+
+	b, err := strconv.ParseBool(val)
+	if err != nil {
+		return sql.NullBool{}, fmt.Errorf("invalid %s value %q, expected true or false", key, val)
+	}
+
+	return sql.NullBool{Bool: b, Valid: true}, nil
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"database/sql"
+	"net/url"
+	"reflect"
+	"testing"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+func TestParseLevelRange(t *testing.T) {
+	tests := []struct {
+		level	string
+		min		int32
+		max		int32
+		wantErr	bool
+	}{
+		{"3", 3, 3, false},
+		{"0", 0, 0, false},
+		{"1-3", 1, 3, false},
+		{"0-9", 0, 9, false},
+		{"4-4", 4, 4, false},
+		{" 2 - 5 ", 2, 5, false},
+		{"5-2", 0, 0, true},
+		{"10", 0, 0, true},
+		{"-3", 0, 0, true},
+		{"3-", 0, 0, true},
+		{"1-10", 0, 0, true},
+		{"1-2-3", 0, 0, true},
+		{"three", 0, 0, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.level, func(t *testing.T) {
+			min, max, err := parseLevelRange(tt.level)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseLevelRange(%q) = %d, %d, want an error", tt.level, min, max)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseLevelRange(%q) error: %v", tt.level, err)
+			}
+			if min != tt.min || max != tt.max {
+				t.Errorf("parseLevelRange(%q) = %d, %d, want %d, %d", tt.level, min, max, tt.min, tt.max)
+			}
+		})
+	}
+}
+
+func TestParseSpellFilter(t *testing.T) {
+	tests := []struct {
+		name	string
+		query	string
+		want	database.SpellFilter
+		wantErr	bool
+	}{
+		{"no filters", "", database.SpellFilter{}, false},
+		{
+			"every filter",
+			"level=1-3&class=Wizard&subclass=Evocation&school=evocation&ritual=false&concentration=true&components=v,%20s&attack_type=ranged&casting_time=1%20action",
+			database.SpellFilter{
+				MinLevel:		sql.NullInt32{Int32: 1, Valid: true},
+				MaxLevel:		sql.NullInt32{Int32: 3, Valid: true},
+				Class:			"wizard",
+				Subclass:		"evocation",
+				School:			"evocation",
+				Ritual:			sql.NullBool{Bool: false, Valid: true},
+				Concentration:	sql.NullBool{Bool: true, Valid: true},
+				Components:		[]string{"V", "S"},
+				AttackType:		"ranged",
+				CastingTime:	"1 action",
+			},
+			false,
+		},
+		{
+			"single level",
+			"level=0",
+			database.SpellFilter{
+				MinLevel:	sql.NullInt32{Int32: 0, Valid: true},
+				MaxLevel:	sql.NullInt32{Int32: 0, Valid: true},
+			},
+			false,
+		},
+		{"reversed level range", "level=5-2", database.SpellFilter{}, true},
+		{"level too high", "level=10", database.SpellFilter{}, true},
+		{"negative level", "level=-3", database.SpellFilter{}, true},
+		{"unknown component", "components=V,X", database.SpellFilter{}, true},
+		{"empty component", "components=V,,S", database.SpellFilter{}, true},
+		{"bad ritual", "ritual=maybe", database.SpellFilter{}, true},
+		{"bad concentration", "concentration=yes", database.SpellFilter{}, true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			query, _ := url.ParseQuery(tt.query)
+			got, err := parseSpellFilter(query)
+			if tt.wantErr {
+				if err == nil {
+					t.Errorf("parseSpellFilter(%q) = %+v, want an error", tt.query, got)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatalf("parseSpellFilter(%q) error: %v", tt.query, err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("parseSpellFilter(%q) = %+v, want %+v", tt.query, got, tt.want)
+			}
+		})
+	}
+}
@@ -4,7 +4,7 @@ import (
 	"net/http"
 	"database/sql"
 	"encoding/json"
-	"strconv"
+	"github.com/kblasti/spellbook/internal/auth"
 	"github.com/kblasti/spellbook/internal/database"
 	_ "github.com/lib/pq"
 	"github.com/sqlc-dev/pqtype"
@@ -79,162 +79,66 @@ func (cfg *APIConfig) HandlerGetSpell(w http.ResponseWriter, r *http.Request) {
 	return
 }
 
-func (cfg *APIConfig) HandlerGetSpellsLevel(w http.ResponseWriter, r *http.Request) {
-	level := r.PathValue("level")
-
-	i64, err := strconv.ParseInt(level, 10, 32)
-	if err != nil {
-		respondWithError(w, 500, err.Error())
-		return
+func spellSearchObject(spell database.FilterSpellsRow) SpellSearchObject {
+	return SpellSearchObject{
+		Index:			spell.Index,
+		Name:			spell.Name,
+		Ritual:			spell.Ritual.Bool,
+		Concentration:	spell.Concentration.Bool,
+		Level:			spell.Level.Int32,
+		Url:			spell.Url,
 	}
+}
 
-	i32 := int32(i64)
-
-	nullLevel := sql.NullInt32{
-		Int32:	i32,
-		Valid:	true,
+func spellNameUrl(spell database.FilterSpellsRow) SpellNameUrl {
+	return SpellNameUrl{
+		Index:		spell.Index,
+		Name:		spell.Name,
+		Level:		spell.Level.Int32,
+		Url:		spell.Url,
 	}
+}
 
-	spells, err := cfg.DB.GetSpellsLevel(r.Context(), nullLevel)
-	if err == sql.ErrNoRows {
-		respondWithError(w, 404, "Spells not found")
-		return
-	}
+func (cfg *APIConfig) HandlerGetSpellsLevel(w http.ResponseWriter, r *http.Request) {
+	level, err := parseSpellLevel(r.PathValue("level"))
 	if err != nil {
-		respondWithError(w, 500, err.Error())
+		respondWithError(w, 400, err.Error())
 		return
 	}
 
-	returnSlice := []SpellNameUrl{}
-
-	for _, spell := range spells {
-		val := SpellNameUrl{
-			Index:		spell.Index,
-			Name:		spell.Name,
-			Level:		spell.Level.Int32,
-			Url:		spell.Url,
-		}
-		returnSlice = append(returnSlice, val)
+	nullLevel := sql.NullInt32{
+		Int32:	level,
+		Valid:	true,
 	}
 
-	respondWithJSON(w, 200, returnSlice)
-	return
+	respondWithSpellPage(cfg, w, r, database.SpellFilter{
+		MinLevel:	nullLevel,
+		MaxLevel:	nullLevel,
+	}, spellNameUrl)
 }
 
 func (cfg *APIConfig) HandlerGetSpellsConcentration(w http.ResponseWriter, r *http.Request) {
-	spells, err := cfg.DB.GetSpellsConcentration(r.Context())
-	if err == sql.ErrNoRows {
-		respondWithError(w, 404, "Spells not found")
-		return
-	}
-	if err != nil {
-		respondWithError(w, 500, err.Error())
-		return
-	}
-
-	returnSlice := []SpellNameUrl{}
-
-	for _, spell := range spells {
-		val := SpellNameUrl{
-			Index:		spell.Index,
-			Name:		spell.Name,
-			Level:		spell.Level.Int32,
-			Url:		spell.Url,
-		}
-		returnSlice = append(returnSlice, val)
-	}
-
-	respondWithJSON(w, 200, returnSlice)
-	return
+	respondWithSpellPage(cfg, w, r, database.SpellFilter{
+		Concentration:	sql.NullBool{Bool: true, Valid: true},
+	}, spellNameUrl)
 }
 
 func (cfg *APIConfig) HandlerGetSpellsRitual(w http.ResponseWriter, r *http.Request) {
-	spells, err := cfg.DB.GetSpellsRitual(r.Context())
-	if err == sql.ErrNoRows {
-		respondWithError(w, 404, "Spells not found")
-		return
-	}
-	if err != nil {
-		respondWithError(w, 500, err.Error())
-		return
-	}
-
-	returnSlice := []SpellNameUrl{}
-
-	for _, spell := range spells {
-		val := SpellNameUrl{
-			Index:		spell.Index,
-			Name:		spell.Name,
-			Level:		spell.Level.Int32,
-			Url:		spell.Url,
-		}
-		returnSlice = append(returnSlice, val)
-	}
-
-	respondWithJSON(w, 200, returnSlice)
-	return
+	respondWithSpellPage(cfg, w, r, database.SpellFilter{
+		Ritual:		sql.NullBool{Bool: true, Valid: true},
+	}, spellNameUrl)
 }
 
 func (cfg *APIConfig) HandlerGetSpellsClass(w http.ResponseWriter, r *http.Request) {
-	class := r.PathValue("class")
-
-	spells, err := cfg.DB.GetSpellsClass(r.Context(), class)
-	if err == sql.ErrNoRows {
-		respondWithError(w, 404, "Spells not found")
-		return
-	}
-	if err != nil {
-		respondWithError(w, 500, err.Error())
-		return
-	}
-
-	returnSlice := []SpellSearchObject{}
-
-	for _, spell := range spells {
-		val := SpellSearchObject{
-			Index:			spell.Index,
-			Name:			spell.Name,
-			Ritual:			spell.Ritual.Bool,
-			Concentration:	spell.Concentration.Bool,
-			Level:			spell.Level.Int32,
-			Url:			spell.Url,
-		}
-		returnSlice = append(returnSlice, val)
-	}
-
-	respondWithJSON(w, 200, returnSlice)
-	return
+	respondWithSpellPage(cfg, w, r, database.SpellFilter{
+		Class:		r.PathValue("class"),
+	}, spellSearchObject)
 }
 
 func (cfg *APIConfig) HandlerGetSpellsSubclass(w http.ResponseWriter, r *http.Request) {
-	subclass := r.PathValue("subclass")
-
-	spells, err := cfg.DB.GetSpellsSubclass(r.Context(), subclass)
-	if err == sql.ErrNoRows {
-		respondWithError(w, 404, "Spells not found")
-		return
-	}
-	if err != nil {
-		respondWithError(w, 500, err.Error())
-		return
-	}
-
-	returnSlice := []SpellSearchObject{}
-
-	for _, spell := range spells {
-		val := SpellSearchObject{
-			Index:			spell.Index,
-			Name:			spell.Name,
-			Ritual:			spell.Ritual.Bool,
-			Concentration:	spell.Concentration.Bool,
-			Level:			spell.Level.Int32,
-			Url:			spell.Url,
-		}
-		returnSlice = append(returnSlice, val)
-	}
-
-	respondWithJSON(w, 200, returnSlice)
-	return
+	respondWithSpellPage(cfg, w, r, database.SpellFilter{
+		Subclass:	r.PathValue("subclass"),
+	}, spellSearchObject)
 }
 
 func (cfg *APIConfig) HandlerUpdateSpell(w http.ResponseWriter, r *http.Request) {
@@ -255,6 +159,8 @@ func (cfg *APIConfig) HandlerUpdateSpell(w http.ResponseWriter, r *http.Request)
 		Damage			json.RawMessage	`json:"damage"`
 	}
 
+	principal, _ := auth.PrincipalFromContext(r.Context())
+
 	decoder := json.NewDecoder(r.Body)
     params := parameters{}
 
@@ -264,70 +170,59 @@ func (cfg *APIConfig) HandlerUpdateSpell(w http.ResponseWriter, r *http.Request)
         return
     }
 
-	spell, err := cfg.DB.UpdateSpell(r.Context(), database.UpdateSpellParams{
-		Name:			params.Name,
-		Range:			sql.NullString{String: params.Range, Valid: true},
-		Material:		sql.NullString{String: params.Material, Valid: true},
-		Ritual:			sql.NullBool{Bool: params.Ritual, Valid: true},
-		Duration:		sql.NullString{String: params.Duration, Valid: true},
-		Concentration:	sql.NullBool{Bool: params.Concentration, Valid: true},
-		CastingTime:	sql.NullString{String: params.CastingTime, Valid: true},
-		Level:			sql.NullInt32{Int32: params.Level, Valid: true},
-		AttackType:		sql.NullString{String: params.AttackType, Valid: true},
-		School:			pqtype.NullRawMessage{RawMessage: params.School, Valid: true},
-		Desc:			params.Desc,
-		HigherLevel:	params.HigherLevel,
-		Components:		params.Components,
-		Damage:			pqtype.NullRawMessage{RawMessage: params.Damage, Valid: true},
+	var val Spell
+	err = cfg.inTx(r.Context(), func(q *database.Queries) error {
+		if err := q.LockSpellIndex(r.Context(), r.PathValue("index")); err != nil {
+			return err
+		}
+		current, err := q.GetSpell(r.Context(), r.PathValue("index"))
+		if err != nil {
+			return err
+		}
+		before := spellFromRow(current)
+
+		spell, err := q.UpdateSpell(r.Context(), database.UpdateSpellParams{
+			Name:			params.Name,
+			Range:			sql.NullString{String: params.Range, Valid: true},
+			Material:		sql.NullString{String: params.Material, Valid: true},
+			Ritual:			sql.NullBool{Bool: params.Ritual, Valid: true},
+			Duration:		sql.NullString{String: params.Duration, Valid: true},
+			Concentration:	sql.NullBool{Bool: params.Concentration, Valid: true},
+			CastingTime:	sql.NullString{String: params.CastingTime, Valid: true},
+			Level:			sql.NullInt32{Int32: params.Level, Valid: true},
+			AttackType:		sql.NullString{String: params.AttackType, Valid: true},
+			School:			pqtype.NullRawMessage{RawMessage: params.School, Valid: true},
+			Desc:			params.Desc,
+			HigherLevel:	params.HigherLevel,
+			Components:		params.Components,
+			Damage:			pqtype.NullRawMessage{RawMessage: params.Damage, Valid: true},
+			Index:			r.PathValue("index"),
+		})
+		if err != nil {
+			return err
+		}
+		val = spellFromRow(database.GetSpellRow(spell))
+		return cfg.recordSpellChange(r, q, principal.UserID, spellRevisionUpdate, &before, &val, nil)
 	})
+	if err == sql.ErrNoRows {
+		respondWithError(w, 404, "Spell not found")
+		return
+	}
 	if err != nil {
 		respondWithError(w, 500, "Error updating spell")
 		return
 	}
-	
-	val := Spell{
-		Index:			spell.Index,
-		Name:			spell.Name,
-		Range:			spell.Range.String,
-		Material:		spell.Material.String,
-		Ritual:			spell.Ritual.Bool,
-		Duration:		spell.Duration.String,
-		Concentration:	spell.Concentration.Bool,
-		CastingTime:	spell.CastingTime.String,
-		Level:			spell.Level.Int32,
-		AttackType:		spell.AttackType.String,
-		School:			spell.School.RawMessage,
-		Desc:			spell.Desc,
-		HigherLevel:	spell.HigherLevel,
-		Components:		spell.Components,
-		Damage:			spell.Damage.RawMessage,
-	}
 
 	respondWithJSON(w, 200, val)
 	return
 }
 
 func (cfg *APIConfig) HandlerGetAllSpells(w http.ResponseWriter, r *http.Request) {
-	spells, err := cfg.DB.GetAllSpells(r.Context())
+	filter, err := parseSpellFilter(r.URL.Query())
 	if err != nil {
-		respondWithError(w, 500, "Error getting spells")
+		respondWithError(w, 400, err.Error())
 		return
 	}
 
-	returnSlice := []SpellSearchObject{}
-
-	for _, spell := range spells {
-		val := SpellSearchObject{
-			Index:			spell.Index,
-			Name:			spell.Name,
-			Ritual:			spell.Ritual.Bool,
-			Concentration:	spell.Concentration.Bool,
-			Level:			spell.Level.Int32,
-			Url:			spell.Url,
-		}
-		returnSlice = append(returnSlice, val)
-	}
-
-	respondWithJSON(w, 200, returnSlice)
-	return
-}
\ No newline at end of file
+	respondWithSpellPage(cfg, w, r, filter, spellSearchObject)
+}
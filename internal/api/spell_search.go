@@ -0,0 +1,100 @@
+package api
+
+import (
+	"net/http"
+	"strconv"
+	"strings"
+	"unicode"
+	"github.com/kblasti/spellbook/internal/database"
+)
+
+const (
+	defaultSearchResults = 25
+	maxSearchResults     = 100
+	// nameSimilarityThreshold is how close a misspelt query has to be to
+	// a word in a spell's name to still match it.
+	nameSimilarityThreshold = "0.4"
+)
+
+// SpellSearchResult is one search match. Snippet is HTML: the spell text is
+// escaped and the matched words are wrapped in <mark> tags.
+type SpellSearchResult struct {
+	SpellSearchObject
+	Score			float64				`json:"score"`
+	Snippet			string				`json:"snippet"`
+}
+
+// buildPrefixQuery turns free text into a tsquery string where every word is
+// matched as a prefix, so "fire bo" becomes "fire:* & bo:*".
+func buildPrefixQuery(q string) string {
+	words := strings.FieldsFunc(q, func(r rune) bool {
+		return !unicode.IsLetter(r) && !unicode.IsDigit(r)
+	})
+
+	terms := make([]string, 0, len(words))
+	for _, word := range words {
+		terms = append(terms, strings.ToLower(word)+":*")
+	}
+
+	return strings.Join(terms, " & ")
+}
+
+func (cfg *APIConfig) HandlerSearchSpells(w http.ResponseWriter, r *http.Request) {
+	raw := strings.TrimSpace(r.URL.Query().Get("q"))
+	tsQuery := buildPrefixQuery(raw)
+	if tsQuery == "" {
+		respondWithError(w, 400, "Missing search query")
+		return
+	}
+
+	maxResults := defaultSearchResults
+	if limit := r.URL.Query().Get("limit"); limit != "" {
+		n, err := strconv.Atoi(limit)
+		if err != nil || n < 1 {
+			respondWithError(w, 400, "Invalid limit")
+			return
+		}
+		maxResults = min(n, maxSearchResults)
+	}
+
+	// The threshold is set for the transaction so the trigram index can
+	// serve the typo-tolerant name match.
+	var spells []database.SearchSpellsRow
+	err := cfg.inTx(r.Context(), func(q *database.Queries) error {
+		if err := q.SetWordSimilarityThreshold(r.Context(), nameSimilarityThreshold); err != nil {
+			return err
+		}
+		var err error
+		spells, err = q.SearchSpells(r.Context(), database.SearchSpellsParams{
+			Query:		tsQuery,
+			Raw:		raw,
+			MaxResults:	int32(maxResults),
+		})
+		return err
+	})
+	if err != nil {
+		respondWithError(w, 500, "Error searching spells")
+		return
+	}
+
+	returnSlice := []SpellSearchResult{}
+
+	for _, spell := range spells {
+		val := SpellSearchResult{
+			SpellSearchObject: SpellSearchObject{
+				Index:			spell.Index,
+				Name:			spell.Name,
+				Ritual:			spell.Ritual.Bool,
+				Concentration:	spell.Concentration.Bool,
+				Level:			spell.Level.Int32,
+				Url:			spell.Url,
+			},
+			Score:		spell.Score,
+			Snippet:	spell.Snippet,
+		}
+		returnSlice = append(returnSlice, val)
+	}
+
+	respondWithJSON(w, 200, returnSlice)
+	return
+}
@@ -0,0 +1,56 @@
+package api
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestBuildPrefixQuery(t *testing.T) {
+	tests := []struct {
+		name	string
+		q		string
+		want	string
+	}{
+		{"single word", "fire", "fire:*"},
+		{"partial last word", "fire bo", "fire:* & bo:*"},
+		{"lowercased", "Fire BOLT", "fire:* & bolt:*"},
+		{"extra whitespace", "  magic   missile ", "magic:* & missile:*"},
+		{"punctuation splits words", "melf's acid-arrow", "melf:* & s:* & acid:* & arrow:*"},
+		{"tsquery operators dropped", "fire & !bolt | (ice):*", "fire:* & bolt:* & ice:*"},
+		{"digits kept", "level 3", "level:* & 3:*"},
+		{"non-ascii letters kept", "Tasha's Über", "tasha:* & s:* & über:*"},
+		{"empty", "", ""},
+		{"only punctuation", "&|!():*'", ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := buildPrefixQuery(tt.q); got != tt.want {
+				t.Errorf("buildPrefixQuery(%q) = %q, want %q", tt.q, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestSearchSpellsRejectsBadRequests(t *testing.T) {
+	cfg := &APIConfig{}
+
+	for _, query := range []string{
+		"",
+		"q=%20%20",
+		"q=!%26|",
+		"q=fire&limit=0",
+		"q=fire&limit=abc",
+	} {
+		t.Run(query, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/spells/search?"+query, nil)
+			rec := httptest.NewRecorder()
+			cfg.HandlerSearchSpells(rec, req)
+
+			if rec.Code != http.StatusBadRequest {
+				t.Errorf("status = %d, want %d", rec.Code, http.StatusBadRequest)
+			}
+		})
+	}
+}
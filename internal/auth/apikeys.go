@@ -0,0 +1,56 @@
+package auth
+
+import (
+	"crypto/rand"
+	"encoding/base64"
+	"strings"
+)
+
+// Scopes an API key can be granted. Interactive sessions implicitly hold all
+// of them, plus ScopeAccount, which API keys can never be granted so that a
+// leaked key can't be used to mint more keys or change the account.
+const (
+	ScopeSpellsRead			= "spells:read"
+	ScopeSpellsWrite		= "spells:write"
+	ScopeCharactersRead		= "characters:read"
+	ScopeCharactersWrite	= "characters:write"
+
+	ScopeAccount			= "account"
+)
+
+var APIKeyScopes = []string{
+	ScopeSpellsRead,
+	ScopeSpellsWrite,
+	ScopeCharactersRead,
+	ScopeCharactersWrite,
+}
+
+const apiKeyPrefix = "sbk_"
+
+// MakeAPIKey returns a new personal API key and the short prefix shown to the
+// user to tell their keys apart.
+func MakeAPIKey() (string, string, error) {
+	key := make([]byte, 32)
+	if _, err := rand.Read(key); err != nil {
+		return "", "", err
+	}
+
+	apiKey := apiKeyPrefix + base64.RawURLEncoding.EncodeToString(key)
+	return apiKey, apiKey[:len(apiKeyPrefix)+8], nil
+}
+
+// IsAPIKey reports whether a bearer token is a personal API key rather than
+// a JWT.
+func IsAPIKey(token string) bool {
+	return strings.HasPrefix(token, apiKeyPrefix)
+}
+
+func IsAPIKeyScope(scope string) bool {
+	for _, s := range APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
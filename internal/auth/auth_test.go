@@ -1,6 +1,7 @@
 package auth
 
 import (
+    "context"
     "testing"
     "time"
 
@@ -12,12 +13,12 @@ func TestCorrect(t *testing.T) {
 	secret := "test-secret"
 	expiresIn := time.Hour
 
-	tknString, err := MakeJWT(userID, secret, expiresIn)
+	tknString, err := MakeJWT(userID, "user", secret, expiresIn)
 	if err != nil {
 		t.Fatalf("MakeJWT returned error: %v", err)
 	}
 
-	returnedID, err := ValidateJWT(tknString, secret)
+	returnedID, _, err := ValidateJWT(tknString, secret)
 	if err != nil {
 		t.Fatalf("ValidateJWT returned error: %v", err)
 	}
@@ -32,12 +33,12 @@ func TestExpiredToken(t *testing.T) {
 	secret := "test-secret"
 	expiresIn := -time.Minute
 
-	tknString, err := MakeJWT(userID, secret, expiresIn)
+	tknString, err := MakeJWT(userID, "user", secret, expiresIn)
 	if err != nil {
 		t.Fatalf("MakeJWT returned error: %v", err)
 	}
 
-	returnedID, err := ValidateJWT(tknString, secret)
+	returnedID, _, err := ValidateJWT(tknString, secret)
 	if err == nil {
 		t.Fatalf("ValidateJWT returned no error")
 	}
@@ -52,12 +53,12 @@ func TestWrongSecret(t *testing.T) {
 	secret := "test-secret"
 	expiresIn := time.Hour
 
-	tknString, err := MakeJWT(userID, secret, expiresIn)
+	tknString, err := MakeJWT(userID, "user", secret, expiresIn)
 	if err != nil {
 		t.Fatalf("MakeJWT returned error: %v", err)
 	}
 
-	returnedID, err := ValidateJWT(tknString, "incorrect")
+	returnedID, _, err := ValidateJWT(tknString, "incorrect")
 	if err == nil {
 		t.Fatalf("ValidateJWT returned no error")
 	}
@@ -65,4 +66,33 @@ func TestWrongSecret(t *testing.T) {
 	if returnedID != uuid.Nil {
 		t.Fatalf("ValidateJWT returned a non-nil uuid: %v", returnedID)
 	}
-}
\ No newline at end of file
+}
+
+func TestParseAccessTokenPrincipal(t *testing.T) {
+	userID := uuid.New()
+	secret := "test-secret"
+
+	tknString, err := MakeJWT(userID, "admin", secret, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT returned error: %v", err)
+	}
+
+	principal, err := ParseAccessToken(tknString, secret)
+	if err != nil {
+		t.Fatalf("ParseAccessToken returned error: %v", err)
+	}
+
+	if principal.UserID != userID || principal.Role != "admin" || principal.TokenID == "" {
+		t.Fatalf("unexpected principal: %+v", principal)
+	}
+
+	ctx := WithPrincipal(context.Background(), principal)
+	fromCtx, ok := PrincipalFromContext(ctx)
+	if !ok || fromCtx.UserID != principal.UserID || fromCtx.TokenID != principal.TokenID {
+		t.Fatalf("PrincipalFromContext returned %+v, %v", fromCtx, ok)
+	}
+
+	if _, ok := PrincipalFromContext(context.WithValue(context.Background(), "claims", principal)); ok {
+		t.Fatalf("PrincipalFromContext accepted a string context key")
+	}
+}
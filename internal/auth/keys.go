@@ -0,0 +1,324 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+// minRSAKeyBits is the smallest RSA modulus accepted for signing keys.
+const minRSAKeyBits = 2048
+
+// KeySet holds the keys access tokens are signed and verified with. One key
+// signs new tokens; every key in the set, including retired ones kept for
+// rotation, verifies them. Asymmetric keys are published as a JWKS so other
+// services can verify tokens without a shared secret.
+type KeySet struct {
+	signing *jwtKey
+	keys    map[string]*jwtKey
+}
+
+type jwtKey struct {
+	id      string
+	method  jwt.SigningMethod
+	private interface{}
+	public  interface{}
+}
+
+// NewHMACKeySet returns a KeySet that signs and verifies HS256 tokens with a
+// shared secret and publishes no keys.
+func NewHMACKeySet(secret string) *KeySet {
+	key := &jwtKey{
+		method:  jwt.SigningMethodHS256,
+		private: []byte(secret),
+		public:  []byte(secret),
+	}
+
+	return &KeySet{
+		signing: key,
+		keys:    map[string]*jwtKey{"": key},
+	}
+}
+
+// NewKeySet returns an empty KeySet. Add keys to it, then choose the signing
+// key with SetSigningKey.
+func NewKeySet() *KeySet {
+	return &KeySet{keys: map[string]*jwtKey{}}
+}
+
+// AddKey adds an RSA (RS256) or Ed25519 (EdDSA) private key, which can both
+// sign and verify tokens.
+func (ks *KeySet) AddKey(id string, private crypto.Signer) error {
+	method, err := signingMethodFor(private.Public())
+	if err != nil {
+		return err
+	}
+
+	return ks.add(&jwtKey{id: id, method: method, private: private, public: private.Public()})
+}
+
+// AddVerificationKey adds an RSA or Ed25519 public key that only verifies
+// tokens, such as a retired signing key whose tokens haven't expired yet.
+func (ks *KeySet) AddVerificationKey(id string, public crypto.PublicKey) error {
+	method, err := signingMethodFor(public)
+	if err != nil {
+		return err
+	}
+
+	return ks.add(&jwtKey{id: id, method: method, public: public})
+}
+
+func (ks *KeySet) add(key *jwtKey) error {
+	if key.id == "" {
+		return errors.New("key ID is required")
+	}
+	if _, ok := ks.keys[key.id]; ok {
+		return fmt.Errorf("duplicate key ID %q", key.id)
+	}
+
+	ks.keys[key.id] = key
+	return nil
+}
+
+// SetSigningKey chooses the key new tokens are signed with.
+func (ks *KeySet) SetSigningKey(id string) error {
+	key, ok := ks.keys[id]
+	if !ok {
+		return fmt.Errorf("unknown key ID %q", id)
+	}
+	if key.private == nil {
+		return fmt.Errorf("key %q has no private key", id)
+	}
+
+	ks.signing = key
+	return nil
+}
+
+func signingMethodFor(public crypto.PublicKey) (jwt.SigningMethod, error) {
+	switch pub := public.(type) {
+	case *rsa.PublicKey:
+		if pub.N.BitLen() < minRSAKeyBits {
+			return nil, fmt.Errorf("RSA keys must be at least %d bits", minRSAKeyBits)
+		}
+		return jwt.SigningMethodRS256, nil
+	case ed25519.PublicKey:
+		return jwt.SigningMethodEdDSA, nil
+	default:
+		return nil, fmt.Errorf("unsupported key type %T", public)
+	}
+}
+
+// LoadKeySet reads every *.pem file in dir into a KeySet, using the file name
+// without its extension as the key ID. Files holding a private key can sign;
+// files holding only a public key verify. signingKeyID picks the signing
+// key, and may be empty when dir contains exactly one private key.
+func LoadKeySet(dir, signingKeyID string) (*KeySet, error) {
+	paths, err := filepath.Glob(filepath.Join(dir, "*.pem"))
+	if err != nil {
+		return nil, err
+	}
+	sort.Strings(paths)
+
+	ks := NewKeySet()
+	var privateIDs []string
+
+	for _, path := range paths {
+		id := strings.TrimSuffix(filepath.Base(path), ".pem")
+
+		data, err := os.ReadFile(path)
+		if err != nil {
+			return nil, err
+		}
+
+		block, _ := pem.Decode(data)
+		if block == nil {
+			return nil, fmt.Errorf("%s: no PEM block found", path)
+		}
+
+		switch block.Type {
+		case "PRIVATE KEY", "RSA PRIVATE KEY":
+			var key interface{}
+			if block.Type == "RSA PRIVATE KEY" {
+				key, err = x509.ParsePKCS1PrivateKey(block.Bytes)
+			} else {
+				key, err = x509.ParsePKCS8PrivateKey(block.Bytes)
+			}
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			signer, ok := key.(crypto.Signer)
+			if !ok {
+				return nil, fmt.Errorf("%s: unsupported private key type %T", path, key)
+			}
+			err = ks.AddKey(id, signer)
+			privateIDs = append(privateIDs, id)
+		case "PUBLIC KEY":
+			var key interface{}
+			key, err = x509.ParsePKIXPublicKey(block.Bytes)
+			if err != nil {
+				return nil, fmt.Errorf("%s: %w", path, err)
+			}
+			err = ks.AddVerificationKey(id, key)
+		default:
+			return nil, fmt.Errorf("%s: unsupported PEM block type %q", path, block.Type)
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", path, err)
+		}
+	}
+
+	if signingKeyID == "" {
+		if len(privateIDs) != 1 {
+			return nil, fmt.Errorf("found %d private keys in %s, a signing key ID is required", len(privateIDs), dir)
+		}
+		signingKeyID = privateIDs[0]
+	}
+
+	if err := ks.SetSigningKey(signingKeyID); err != nil {
+		return nil, err
+	}
+
+	return ks, nil
+}
+
+// MakeJWT issues an access token for userID signed with the current signing
+// key.
+func (ks *KeySet) MakeJWT(userID uuid.UUID, role string, expiresIn time.Duration) (string, error) {
+	if ks.signing == nil {
+		return "", errors.New("no signing key configured")
+	}
+
+	now := time.Now().UTC()
+	claims := &Claims{
+		Role:				role,
+		RegisteredClaims:	jwt.RegisteredClaims{
+			Issuer: 	"spellbook-access",
+			IssuedAt: 	jwt.NewNumericDate(now),
+			ExpiresAt: 	jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject: 	userID.String(),
+			ID:			uuid.NewString(),
+		},
+	}
+
+	token := jwt.NewWithClaims(ks.signing.method, claims)
+	if ks.signing.id != "" {
+		token.Header["kid"] = ks.signing.id
+	}
+
+	return token.SignedString(ks.signing.private)
+}
+
+// ParseAccessToken validates an access token against the key named by its
+// kid header and returns the principal it was issued to.
+func (ks *KeySet) ParseAccessToken(tokenString string) (Principal, error) {
+	claims := &Claims{}
+
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		func(token *jwt.Token) (interface{}, error) {
+			kid, _ := token.Header["kid"].(string)
+			key, ok := ks.keys[kid]
+			if !ok {
+				return nil, fmt.Errorf("unknown key ID %q", kid)
+			}
+			// The key, not the token, decides the algorithm so a token
+			// can't downgrade an RSA key to HMAC.
+			if token.Method.Alg() != key.method.Alg() {
+				return nil, fmt.Errorf("unexpected signing method %s", token.Method.Alg())
+			}
+			return key.public, nil
+		},
+	)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	issuer, err := claims.GetIssuer()
+	if err != nil {
+		return Principal{}, err
+	}
+	if issuer != "spellbook-access" {
+		return Principal{}, errors.New("invalid issuer")
+	}
+
+	userIDString, err := claims.GetSubject()
+	if err != nil {
+		return Principal{}, err
+	}
+
+	id, err := uuid.Parse(userIDString)
+	if err != nil {
+		return Principal{}, err
+	}
+
+	return Principal{
+		UserID:		id,
+		Role:		claims.Role,
+		TokenID:	claims.ID,
+	}, nil
+}
+
+// JWK is the public half of an asymmetric key in JSON Web Key format.
+type JWK struct {
+	Kty	string	`json:"kty"`
+	Kid	string	`json:"kid"`
+	Use	string	`json:"use"`
+	Alg	string	`json:"alg"`
+	N	string	`json:"n,omitempty"`
+	E	string	`json:"e,omitempty"`
+	Crv	string	`json:"crv,omitempty"`
+	X	string	`json:"x,omitempty"`
+}
+
+type JWKS struct {
+	Keys	[]JWK	`json:"keys"`
+}
+
+// JWKS returns the public keys of every asymmetric key in the set, ordered by
+// key ID. Shared HMAC secrets are never published.
+func (ks *KeySet) JWKS() JWKS {
+	set := JWKS{Keys: []JWK{}}
+
+	ids := make([]string, 0, len(ks.keys))
+	for id := range ks.keys {
+		ids = append(ids, id)
+	}
+	sort.Strings(ids)
+
+	for _, id := range ids {
+		key := ks.keys[id]
+		jwk := JWK{Kid: key.id, Use: "sig", Alg: key.method.Alg()}
+
+		switch pub := key.public.(type) {
+		case *rsa.PublicKey:
+			jwk.Kty = "RSA"
+			jwk.N = base64.RawURLEncoding.EncodeToString(pub.N.Bytes())
+			jwk.E = base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes())
+		case ed25519.PublicKey:
+			jwk.Kty = "OKP"
+			jwk.Crv = "Ed25519"
+			jwk.X = base64.RawURLEncoding.EncodeToString(pub)
+		default:
+			continue
+		}
+
+		set.Keys = append(set.Keys, jwk)
+	}
+
+	return set
+}
@@ -0,0 +1,251 @@
+package auth
+
+import (
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func newTestRSAKey(t *testing.T) *rsa.PrivateKey {
+	t.Helper()
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+	return key
+}
+
+func newTestEd25519Key(t *testing.T) ed25519.PrivateKey {
+	t.Helper()
+	_, key, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatalf("generating Ed25519 key: %v", err)
+	}
+	return key
+}
+
+func TestKeySetSignsWithKeyID(t *testing.T) {
+	tests := []struct {
+		kid string
+		key crypto.Signer
+		alg string
+	}{
+		{"rsa-1", newTestRSAKey(t), "RS256"},
+		{"ed-1", newTestEd25519Key(t), "EdDSA"},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.alg, func(t *testing.T) {
+			kid := tc.kid
+			ks := NewKeySet()
+			if err := ks.AddKey(kid, tc.key); err != nil {
+				t.Fatalf("AddKey: %v", err)
+			}
+			if err := ks.SetSigningKey(kid); err != nil {
+				t.Fatalf("SetSigningKey: %v", err)
+			}
+
+			userID := uuid.New()
+			token, err := ks.MakeJWT(userID, "admin", time.Hour)
+			if err != nil {
+				t.Fatalf("MakeJWT: %v", err)
+			}
+
+			parsed, _, err := jwt.NewParser().ParseUnverified(token, &Claims{})
+			if err != nil {
+				t.Fatalf("ParseUnverified: %v", err)
+			}
+			if parsed.Header["kid"] != kid || parsed.Method.Alg() != tc.alg {
+				t.Fatalf("expected kid %q and alg %s, got %v and %s", kid, tc.alg, parsed.Header["kid"], parsed.Method.Alg())
+			}
+
+			principal, err := ks.ParseAccessToken(token)
+			if err != nil {
+				t.Fatalf("ParseAccessToken: %v", err)
+			}
+			if principal.UserID != userID || principal.Role != "admin" {
+				t.Fatalf("unexpected principal %+v", principal)
+			}
+		})
+	}
+}
+
+func TestKeySetRotation(t *testing.T) {
+	oldKey := newTestRSAKey(t)
+	newKey := newTestEd25519Key(t)
+	userID := uuid.New()
+
+	before := NewKeySet()
+	before.AddKey("2025-01", oldKey)
+	before.SetSigningKey("2025-01")
+
+	oldToken, err := before.MakeJWT(userID, "user", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+
+	// The old key is retired to verification only while its tokens expire.
+	during := NewKeySet()
+	during.AddVerificationKey("2025-01", oldKey.Public())
+	during.AddKey("2025-02", newKey)
+	if err := during.SetSigningKey("2025-01"); err == nil {
+		t.Fatalf("expected a verification-only key to be rejected as the signing key")
+	}
+	during.SetSigningKey("2025-02")
+
+	if _, err := during.ParseAccessToken(oldToken); err != nil {
+		t.Fatalf("old token rejected during rotation: %v", err)
+	}
+
+	newToken, err := during.MakeJWT(userID, "user", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	if _, err := before.ParseAccessToken(newToken); err == nil {
+		t.Fatalf("expected a token from an unknown key to be rejected")
+	}
+
+	after := NewKeySet()
+	after.AddKey("2025-02", newKey)
+	after.SetSigningKey("2025-02")
+
+	if _, err := after.ParseAccessToken(oldToken); err == nil {
+		t.Fatalf("expected a token signed by a removed key to be rejected")
+	}
+	if _, err := after.ParseAccessToken(newToken); err != nil {
+		t.Fatalf("new token rejected after rotation: %v", err)
+	}
+}
+
+func TestKeySetRejectsAlgorithmConfusion(t *testing.T) {
+	key := newTestRSAKey(t)
+	ks := NewKeySet()
+	ks.AddKey("rsa-1", key)
+	ks.SetSigningKey("rsa-1")
+
+	// An attacker who knows the public key signs an HS256 token with it.
+	publicDER, err := x509.MarshalPKIXPublicKey(key.Public())
+	if err != nil {
+		t.Fatalf("marshalling public key: %v", err)
+	}
+	publicPEM := pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: publicDER})
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, &Claims{
+		Role: "admin",
+		RegisteredClaims: jwt.RegisteredClaims{
+			Issuer:    "spellbook-access",
+			Subject:   uuid.NewString(),
+			ExpiresAt: jwt.NewNumericDate(time.Now().Add(time.Hour)),
+		},
+	})
+	token.Header["kid"] = "rsa-1"
+	forged, err := token.SignedString(publicPEM)
+	if err != nil {
+		t.Fatalf("signing forged token: %v", err)
+	}
+
+	if _, err := ks.ParseAccessToken(forged); err == nil {
+		t.Fatalf("expected an HS256 token to be rejected for an RSA key")
+	}
+}
+
+func TestKeySetRejectsWeakRSAKey(t *testing.T) {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatalf("generating RSA key: %v", err)
+	}
+
+	if err := NewKeySet().AddKey("weak", key); err == nil {
+		t.Fatalf("expected a 1024-bit RSA key to be rejected")
+	}
+}
+
+func TestKeySetJWKS(t *testing.T) {
+	rsaKey := newTestRSAKey(t)
+	edKey := newTestEd25519Key(t)
+
+	ks := NewKeySet()
+	ks.AddKey("b-rsa", rsaKey)
+	ks.AddVerificationKey("a-ed", edKey.Public())
+	ks.SetSigningKey("b-rsa")
+
+	jwks := ks.JWKS()
+	if len(jwks.Keys) != 2 {
+		t.Fatalf("expected 2 keys, got %d", len(jwks.Keys))
+	}
+
+	ed, rsaJWK := jwks.Keys[0], jwks.Keys[1]
+	if ed.Kid != "a-ed" || ed.Kty != "OKP" || ed.Crv != "Ed25519" || ed.Alg != "EdDSA" {
+		t.Fatalf("unexpected Ed25519 JWK %+v", ed)
+	}
+	if x, _ := base64.RawURLEncoding.DecodeString(ed.X); string(x) != string(edKey.Public().(ed25519.PublicKey)) {
+		t.Fatalf("Ed25519 JWK does not hold the public key")
+	}
+
+	if rsaJWK.Kid != "b-rsa" || rsaJWK.Kty != "RSA" || rsaJWK.Alg != "RS256" || rsaJWK.E != "AQAB" {
+		t.Fatalf("unexpected RSA JWK %+v", rsaJWK)
+	}
+	if n, _ := base64.RawURLEncoding.DecodeString(rsaJWK.N); string(n) != string(rsaKey.N.Bytes()) {
+		t.Fatalf("RSA JWK does not hold the modulus")
+	}
+
+	if keys := NewHMACKeySet("secret").JWKS().Keys; len(keys) != 0 {
+		t.Fatalf("expected the HMAC secret not to be published, got %+v", keys)
+	}
+}
+
+func TestLoadKeySet(t *testing.T) {
+	dir := t.TempDir()
+
+	writePEM := func(name, blockType string, der []byte) {
+		t.Helper()
+		data := pem.EncodeToMemory(&pem.Block{Type: blockType, Bytes: der})
+		if err := os.WriteFile(filepath.Join(dir, name), data, 0o600); err != nil {
+			t.Fatalf("writing %s: %v", name, err)
+		}
+	}
+
+	current := newTestEd25519Key(t)
+	currentDER, err := x509.MarshalPKCS8PrivateKey(current)
+	if err != nil {
+		t.Fatalf("marshalling key: %v", err)
+	}
+	writePEM("current.pem", "PRIVATE KEY", currentDER)
+
+	retired := newTestRSAKey(t)
+	retiredDER, err := x509.MarshalPKIXPublicKey(retired.Public())
+	if err != nil {
+		t.Fatalf("marshalling key: %v", err)
+	}
+	writePEM("retired.pem", "PUBLIC KEY", retiredDER)
+
+	ks, err := LoadKeySet(dir, "")
+	if err != nil {
+		t.Fatalf("LoadKeySet: %v", err)
+	}
+
+	token, err := ks.MakeJWT(uuid.New(), "user", time.Hour)
+	if err != nil {
+		t.Fatalf("MakeJWT: %v", err)
+	}
+	parsed, _, _ := jwt.NewParser().ParseUnverified(token, &Claims{})
+	if parsed.Header["kid"] != "current" {
+		t.Fatalf("expected the private key to sign, got kid %v", parsed.Header["kid"])
+	}
+
+	if _, err := LoadKeySet(dir, "retired"); err == nil || !strings.Contains(err.Error(), "no private key") {
+		t.Fatalf("expected a public key to be rejected as the signing key, got %v", err)
+	}
+}
@@ -9,6 +9,7 @@ import (
 	"strings"
 	"net/http"
 	"crypto/rand"
+	"crypto/sha256"
 	"encoding/hex"
 )
 
@@ -35,69 +36,33 @@ func CheckPasswordHash(password, hash string) (bool, error) {
 	return match, nil
 }
 
+// MakeJWT issues an HS256 access token signed with tokenSecret.
 func MakeJWT(userID uuid.UUID, role, tokenSecret string, expiresIn time.Duration) (string, error) {
-	now := time.Now().UTC()
-	claims := &Claims{
-		Role:				role,
-		RegisteredClaims:	jwt.RegisteredClaims{
-			Issuer: 	"spellbook-access",
-			IssuedAt: 	jwt.NewNumericDate(now),
-			ExpiresAt: 	jwt.NewNumericDate(now.Add(expiresIn)),
-			Subject: 	userID.String(),
-		},
-	}
-
-	 token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
-
-	 signingKey := []byte(tokenSecret)
-
-	 signedToken, err := token.SignedString(signingKey)
-	 if err != nil {
-		return "", err
-	 }
-
-	 return signedToken, nil
+	return NewHMACKeySet(tokenSecret).MakeJWT(userID, role, expiresIn)
 }
 
 func ValidateJWT(tokenString, tokenSecret string) (uuid.UUID, string, error) {
-    claims := &Claims{}
-
-    _, err := jwt.ParseWithClaims(
-        tokenString,
-        claims,
-        func(token *jwt.Token) (interface{}, error) {
-            return []byte(tokenSecret), nil
-        },
-    )
+    principal, err := ParseAccessToken(tokenString, tokenSecret)
     if err != nil {
         return uuid.Nil, "", err
     }
 
-    issuer, err := claims.GetIssuer()
-    if err != nil {
-        return uuid.Nil, "", err
-    }
-    if issuer != "spellbook-access" {
-        return uuid.Nil, "", errors.New("invalid issuer")
-    }
-
-    userIDString, err := claims.GetSubject()
-    if err != nil {
-        return uuid.Nil, "", err
-    }
-
-    id, err := uuid.Parse(userIDString)
-    if err != nil {
-        return uuid.Nil, "", err
-    }
+    return principal.UserID, principal.Role, nil
+}
 
-    return id, claims.Role, nil
+// ParseAccessToken validates an HS256 access token and returns the principal
+// it was issued to.
+func ParseAccessToken(tokenString, tokenSecret string) (Principal, error) {
+    return NewHMACKeySet(tokenSecret).ParseAccessToken(tokenString)
 }
 
 func GetBearerToken(headers http.Header) (string, error) {
 	authHeader := headers.Get("Authorization")
 
 	if authHeader == "" {
+		if apiKey := strings.TrimSpace(headers.Get("X-API-Key")); apiKey != "" {
+			return apiKey, nil
+		}
 		return "", errors.New("Authorization header missing")
 	}
 
@@ -130,3 +95,11 @@ func MakeRefreshToken() (string, error) {
 
 	return refreshToken, nil
 }
+
+// HashToken returns the hex SHA-256 digest of a random token such as a
+// password reset token. Unlike passwords these tokens carry 256 bits of
+// entropy, so a fast hash is enough to keep them useless if the table leaks.
+func HashToken(token string) string {
+	sum := sha256.Sum256([]byte(token))
+	return hex.EncodeToString(sum[:])
+}
@@ -0,0 +1,8 @@
+package auth
+
+// Permissions granted to roles through the role_permissions table.
+const (
+	PermissionSpellsEdit		= "spells:edit"
+	PermissionHomebrewReview	= "homebrew:review"
+	PermissionUsersManage		= "users:manage"
+)
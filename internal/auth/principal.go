@@ -0,0 +1,54 @@
+package auth
+
+import (
+	"context"
+	"github.com/google/uuid"
+)
+
+// Principal identifies the caller of an authenticated request. Requests made
+// with a personal API key carry the key's ID and scopes.
+type Principal struct {
+	UserID		uuid.UUID
+	Role		string
+	TokenID		string
+	APIKeyID	uuid.UUID
+	Scopes		[]string
+}
+
+type principalKey struct{}
+
+func WithPrincipal(ctx context.Context, p Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+func PrincipalFromContext(ctx context.Context) (Principal, bool) {
+	p, ok := ctx.Value(principalKey{}).(Principal)
+	return p, ok
+}
+
+// HasRole reports whether the principal holds any of the given roles.
+func (p Principal) HasRole(roles ...string) bool {
+	for _, role := range roles {
+		if p.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+// HasScope reports whether the principal may act with scope. Sessions hold
+// every scope, API keys only the ones they were created with.
+func (p Principal) HasScope(scope string) bool {
+	if p.APIKeyID == uuid.Nil {
+		return true
+	}
+
+	for _, s := range p.Scopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
@@ -0,0 +1,88 @@
+package auth
+
+import (
+	"encoding/base32"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// RFC 6238 appendix B test vectors for the SHA-1 secret "12345678901234567890",
+// truncated to six digits.
+func TestTOTPCodeRFC6238(t *testing.T) {
+	secret := base32.StdEncoding.WithPadding(base32.NoPadding).EncodeToString([]byte("12345678901234567890"))
+
+	vectors := map[int64]string{
+		59:         "287082",
+		1111111109: "081804",
+		1111111111: "050471",
+		1234567890: "005924",
+		2000000000: "279037",
+	}
+
+	for unix, want := range vectors {
+		got, err := totpCode(secret, TOTPStep(time.Unix(unix, 0)))
+		if err != nil {
+			t.Fatalf("totpCode returned error: %v", err)
+		}
+		if got != want {
+			t.Fatalf("at %d expected %s, got %s", unix, want, got)
+		}
+	}
+}
+
+func TestValidateTOTP(t *testing.T) {
+	secret, err := GenerateTOTPSecret()
+	if err != nil {
+		t.Fatalf("GenerateTOTPSecret returned error: %v", err)
+	}
+
+	now := time.Now()
+	code, err := totpCode(secret, TOTPStep(now.Add(-totpPeriod*time.Second)))
+	if err != nil {
+		t.Fatalf("totpCode returned error: %v", err)
+	}
+
+	step, ok := ValidateTOTP(secret, code, now)
+	if !ok {
+		t.Fatalf("ValidateTOTP rejected a code from the previous period")
+	}
+	if step != TOTPStep(now)-1 {
+		t.Fatalf("expected step %d, got %d", TOTPStep(now)-1, step)
+	}
+
+	if _, ok := ValidateTOTP(secret, code, now.Add(5*time.Minute)); ok {
+		t.Fatalf("ValidateTOTP accepted a stale code")
+	}
+}
+
+func TestTOTPURI(t *testing.T) {
+	uri := TOTPURI("ABCDEF", "player@example.com", "Spellbook")
+	if !strings.HasPrefix(uri, "otpauth://totp/Spellbook:player@example.com?") {
+		t.Fatalf("unexpected uri %s", uri)
+	}
+	if !strings.Contains(uri, "secret=ABCDEF") {
+		t.Fatalf("uri is missing the secret: %s", uri)
+	}
+}
+
+func TestMFAToken(t *testing.T) {
+	userID := uuid.New()
+	secret := "test-secret"
+
+	tknString, err := MakeMFAToken(userID, secret, time.Minute)
+	if err != nil {
+		t.Fatalf("MakeMFAToken returned error: %v", err)
+	}
+
+	returnedID, err := ValidateMFAToken(tknString, secret)
+	if err != nil || returnedID != userID {
+		t.Fatalf("ValidateMFAToken returned %v, %v", returnedID, err)
+	}
+
+	if _, _, err := ValidateJWT(tknString, secret); err == nil {
+		t.Fatalf("an MFA challenge token was accepted as an access token")
+	}
+}
@@ -0,0 +1,62 @@
+package auth
+
+import (
+	"errors"
+	"time"
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+const emailVerificationIssuer = "spellbook-email-verification"
+
+type emailClaims struct {
+	Email		string		`json:"email"`
+	jwt.RegisteredClaims
+}
+
+// MakeEmailVerificationToken signs a token proving control of email for
+// userID. The address is part of the token so a link sent to an old address
+// stops working once the email is changed again.
+func MakeEmailVerificationToken(userID uuid.UUID, email, tokenSecret string, expiresIn time.Duration) (string, error) {
+	now := time.Now().UTC()
+	claims := &emailClaims{
+		Email:				email,
+		RegisteredClaims:	jwt.RegisteredClaims{
+			Issuer: 	emailVerificationIssuer,
+			IssuedAt: 	jwt.NewNumericDate(now),
+			ExpiresAt: 	jwt.NewNumericDate(now.Add(expiresIn)),
+			Subject: 	userID.String(),
+		},
+	}
+
+	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claims)
+	return token.SignedString([]byte(tokenSecret))
+}
+
+func ValidateEmailVerificationToken(tokenString, tokenSecret string) (uuid.UUID, string, error) {
+	claims := &emailClaims{}
+
+	_, err := jwt.ParseWithClaims(
+		tokenString,
+		claims,
+		func(token *jwt.Token) (interface{}, error) {
+			return []byte(tokenSecret), nil
+		},
+		jwt.WithValidMethods([]string{jwt.SigningMethodHS256.Alg()}),
+		jwt.WithIssuer(emailVerificationIssuer),
+	)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	id, err := uuid.Parse(claims.Subject)
+	if err != nil {
+		return uuid.Nil, "", err
+	}
+
+	if claims.Email == "" {
+		return uuid.Nil, "", errors.New("token has no email")
+	}
+
+	return id, claims.Email, nil
+}
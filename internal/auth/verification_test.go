@@ -0,0 +1,92 @@
+package auth
+
+import (
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+	"github.com/google/uuid"
+)
+
+func TestEmailVerificationToken(t *testing.T) {
+	userID := uuid.New()
+	secret := "test-secret"
+
+	token, err := MakeEmailVerificationToken(userID, "old@example.com", secret, time.Hour)
+	if err != nil {
+		t.Fatalf("MakeEmailVerificationToken returned error: %v", err)
+	}
+
+	gotID, gotEmail, err := ValidateEmailVerificationToken(token, secret)
+	if err != nil {
+		t.Fatalf("ValidateEmailVerificationToken returned error: %v", err)
+	}
+	if gotID != userID {
+		t.Errorf("user ID = %v, want %v", gotID, userID)
+	}
+	// The address the link was sent to comes back, so once the user has
+	// changed their email it no longer matches the account.
+	if gotEmail != "old@example.com" {
+		t.Errorf("email = %q, want old@example.com", gotEmail)
+	}
+}
+
+func TestEmailVerificationTokenRejected(t *testing.T) {
+	userID := uuid.New()
+	secret := "test-secret"
+
+	sign := func(claims *emailClaims) string {
+		token, err := jwt.NewWithClaims(jwt.SigningMethodHS256, claims).SignedString([]byte(secret))
+		if err != nil {
+			t.Fatal(err)
+		}
+		return token
+	}
+	claims := func(issuer, email string, expiresAt time.Time) *emailClaims {
+		return &emailClaims{
+			Email: email,
+			RegisteredClaims: jwt.RegisteredClaims{
+				Issuer:    issuer,
+				ExpiresAt: jwt.NewNumericDate(expiresAt),
+				Subject:   userID.String(),
+			},
+		}
+	}
+
+	expired, err := MakeEmailVerificationToken(userID, "user@example.com", secret, -time.Minute)
+	if err != nil {
+		t.Fatal(err)
+	}
+	otherSecret, err := MakeEmailVerificationToken(userID, "user@example.com", "other-secret", time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+	accessToken, err := MakeJWT(userID, "user", secret, time.Hour)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"expired", expired},
+		{"wrong secret", otherSecret},
+		{"access token", accessToken},
+		{"wrong issuer", sign(claims("spellbook-password-reset", "user@example.com", time.Now().Add(time.Hour)))},
+		{"no email", sign(claims(emailVerificationIssuer, "", time.Now().Add(time.Hour)))},
+		{"garbage", "not-a-token"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			gotID, gotEmail, err := ValidateEmailVerificationToken(tt.token, secret)
+			if err == nil {
+				t.Fatalf("ValidateEmailVerificationToken accepted the token for %v, %q", gotID, gotEmail)
+			}
+			if gotID != uuid.Nil || gotEmail != "" {
+				t.Errorf("ValidateEmailVerificationToken returned %v, %q with an error", gotID, gotEmail)
+			}
+		})
+	}
+}
@@ -0,0 +1,139 @@
+package database
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// AuditFilter holds the optional filters for ListAuditEntries. Zero values
+// are ignored. Since is inclusive and Until exclusive.
+type AuditFilter struct {
+	ActorID    uuid.NullUUID
+	Action     string
+	TargetType string
+	TargetID   string
+	Since      time.Time
+	Until      time.Time
+}
+
+var auditSorts = map[string][]sortKey{
+	"created_at": {
+		{Expr: `a.created_at`, Cast: "timestamp"},
+		{Expr: `a.id`, Cast: "uuid"},
+	},
+}
+
+func buildAuditFilter(f AuditFilter) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	add := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+
+	if f.ActorID.Valid {
+		add(`a.actor_id = $%d`, f.ActorID.UUID)
+	}
+	if f.Action != "" {
+		add(`a.action = $%d`, f.Action)
+	}
+	if f.TargetType != "" {
+		add(`a.target_type = $%d`, f.TargetType)
+	}
+	if f.TargetID != "" {
+		add(`a.target_id = $%d`, f.TargetID)
+	}
+	if !f.Since.IsZero() {
+		add(`a.created_at >= $%d`, f.Since)
+	}
+	if !f.Until.IsZero() {
+		add(`a.created_at < $%d`, f.Until)
+	}
+	return where, args
+}
+
+// ListAuditEntries returns one page of the audit log entries matching f,
+// along with the cursor for the next page.
+func (q *Queries) ListAuditEntries(ctx context.Context, f AuditFilter, p Page) ([]AuditLog, string, error) {
+	ks, err := newKeyset(auditSorts, p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args := buildAuditFilter(f)
+	if cond := ks.condition(&args); cond != "" {
+		where = append(where, cond)
+	}
+
+	query := `SELECT a.id, a.created_at, a.actor_id, a.action, a.target_type, a.target_id, a.ip_address, a.details, a.request_id, a."before", a."after", ` + ks.columns + `
+FROM audit_log AS a
+`
+	if len(where) > 0 {
+		query += "WHERE " + strings.Join(where, " AND ") + "\n"
+	}
+	query += ks.orderBy()
+	if p.Limit > 0 {
+		args = append(args, p.Limit+1)
+		query += fmt.Sprintf("\nLIMIT $%d", len(args))
+	}
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	var items []AuditLog
+	var keys [][]string
+	for rows.Next() {
+		var i AuditLog
+		var key []string
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.ActorID,
+			&i.Action,
+			&i.TargetType,
+			&i.TargetID,
+			&i.IpAddress,
+			&i.Details,
+			&i.RequestID,
+			&i.Before,
+			&i.After,
+			pq.Array(&key),
+		); err != nil {
+			return nil, "", err
+		}
+		items = append(items, i)
+		keys = append(keys, key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, "", err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	items, next := trimPage(items, keys, p)
+	return items, next, nil
+}
+
+// CountAuditEntries returns the number of audit log entries matching f.
+func (q *Queries) CountAuditEntries(ctx context.Context, f AuditFilter) (int64, error) {
+	where, args := buildAuditFilter(f)
+	query := `SELECT COUNT(*)
+FROM audit_log AS a
+`
+	if len(where) > 0 {
+		query += "WHERE " + strings.Join(where, " AND ")
+	}
+
+	row := q.db.QueryRowContext(ctx, query, args...)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
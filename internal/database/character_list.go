@@ -0,0 +1,82 @@
+package database
+
+import (
+	"context"
+	"fmt"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+var characterSorts = map[string][]sortKey{
+	"name": {
+		{Expr: `c.name`, Cast: "text"},
+		{Expr: `c.id`, Cast: "uuid"},
+	},
+	"updated_at": {
+		{Expr: `c.updated_at`, Cast: "timestamp"},
+		{Expr: `c.id`, Cast: "uuid"},
+	},
+}
+
+// ListUserCharacters returns one page of the characters owned by userID,
+// along with the cursor for the next page.
+func (q *Queries) ListUserCharacters(ctx context.Context, userID uuid.UUID, p Page) ([]GetUserCharactersRow, string, error) {
+	ks, err := newKeyset(characterSorts, p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	args := []interface{}{userID}
+	where := "WHERE c.user_id = $1"
+	if cond := ks.condition(&args); cond != "" {
+		where += " AND " + cond
+	}
+
+	query := `SELECT c.id, c.name, c.class_levels, ` + ks.columns + `
+FROM characters AS c
+` + where + `
+` + ks.orderBy()
+	if p.Limit > 0 {
+		args = append(args, p.Limit+1)
+		query += fmt.Sprintf("\nLIMIT $%d", len(args))
+	}
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	var items []GetUserCharactersRow
+	var keys [][]string
+	for rows.Next() {
+		var i GetUserCharactersRow
+		var key []string
+		if err := rows.Scan(&i.ID, &i.Name, &i.ClassLevels, pq.Array(&key)); err != nil {
+			return nil, "", err
+		}
+		items = append(items, i)
+		keys = append(keys, key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, "", err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	items, next := trimPage(items, keys, p)
+	return items, next, nil
+}
+
+const countUserCharacters = `SELECT COUNT(*)
+FROM characters
+WHERE user_id = $1
+`
+
+func (q *Queries) CountUserCharacters(ctx context.Context, userID uuid.UUID) (int64, error) {
+	row := q.db.QueryRowContext(ctx, countUserCharacters, userID)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
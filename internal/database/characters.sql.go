@@ -15,20 +15,20 @@ import (
 
 const addCharacterSpell = `-- name: AddCharacterSpell :one
 INSERT INTO characters_spells (spell_id, char_id)
-VALUES (
-    $1,
-    $2
-)
+SELECT $1, c.id
+FROM characters AS c
+WHERE c.id = $2 AND c.user_id = $3
 RETURNING spell_id, char_id
 `
 
 type AddCharacterSpellParams struct {
 	SpellID int32
 	CharID  uuid.UUID
+	UserID  uuid.UUID
 }
 
 func (q *Queries) AddCharacterSpell(ctx context.Context, arg AddCharacterSpellParams) (CharactersSpell, error) {
-	row := q.db.QueryRowContext(ctx, addCharacterSpell, arg.SpellID, arg.CharID)
+	row := q.db.QueryRowContext(ctx, addCharacterSpell, arg.SpellID, arg.CharID, arg.UserID)
 	var i CharactersSpell
 	err := row.Scan(&i.SpellID, &i.CharID)
 	return i, err
@@ -66,7 +66,7 @@ func (q *Queries) CreateCharacter(ctx context.Context, arg CreateCharacterParams
 	return i, err
 }
 
-const deleteCharacter = `-- name: DeleteCharacter :exec
+const deleteCharacter = `-- name: DeleteCharacter :execrows
 DELETE FROM characters
 WHERE id = $1 AND user_id = $2
 `
@@ -76,9 +76,12 @@ type DeleteCharacterParams struct {
 	UserID uuid.UUID
 }
 
-func (q *Queries) DeleteCharacter(ctx context.Context, arg DeleteCharacterParams) error {
-	_, err := q.db.ExecContext(ctx, deleteCharacter, arg.ID, arg.UserID)
-	return err
+func (q *Queries) DeleteCharacter(ctx context.Context, arg DeleteCharacterParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteCharacter, arg.ID, arg.UserID)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
 }
 
 const getCasterLevel = `-- name: GetCasterLevel :one
@@ -93,11 +96,16 @@ SELECT
         COALESCE((class_levels->>'ranger')::numeric, 0) * 0.5
     ) AS effective_caster_level 
 FROM characters 
-WHERE id = $1
+WHERE id = $1 AND user_id = $2
 `
 
-func (q *Queries) GetCasterLevel(ctx context.Context, id uuid.UUID) (float64, error) {
-	row := q.db.QueryRowContext(ctx, getCasterLevel, id)
+type GetCasterLevelParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) GetCasterLevel(ctx context.Context, arg GetCasterLevelParams) (float64, error) {
+	row := q.db.QueryRowContext(ctx, getCasterLevel, arg.ID, arg.UserID)
 	var effective_caster_level float64
 	err := row.Scan(&effective_caster_level)
 	return effective_caster_level, err
@@ -108,10 +116,15 @@ SELECT s."index", s.name, s.level, s.url
 FROM spells as s
 JOIN characters_spells AS cs ON cs.spell_id = s.id
 JOIN characters AS c ON c.id = cs.char_id
-WHERE c.id = $1
+WHERE c.id = $1 AND c.user_id = $2
 ORDER BY s.level, s.name
 `
 
+type GetCharacterSpellsParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
 type GetCharacterSpellsRow struct {
 	Index string
 	Name  string
@@ -119,8 +132,8 @@ type GetCharacterSpellsRow struct {
 	Url   string
 }
 
-func (q *Queries) GetCharacterSpells(ctx context.Context, id uuid.UUID) ([]GetCharacterSpellsRow, error) {
-	rows, err := q.db.QueryContext(ctx, getCharacterSpells, id)
+func (q *Queries) GetCharacterSpells(ctx context.Context, arg GetCharacterSpellsParams) ([]GetCharacterSpellsRow, error) {
+	rows, err := q.db.QueryContext(ctx, getCharacterSpells, arg.ID, arg.UserID)
 	if err != nil {
 		return nil, err
 	}
@@ -150,11 +163,16 @@ func (q *Queries) GetCharacterSpells(ctx context.Context, id uuid.UUID) ([]GetCh
 const getClassLevels = `-- name: GetClassLevels :one
 SELECT class_levels
 FROM characters
-WHERE id = $1
+WHERE id = $1 AND user_id = $2
 `
 
-func (q *Queries) GetClassLevels(ctx context.Context, id uuid.UUID) (json.RawMessage, error) {
-	row := q.db.QueryRowContext(ctx, getClassLevels, id)
+type GetClassLevelsParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+func (q *Queries) GetClassLevels(ctx context.Context, arg GetClassLevelsParams) (json.RawMessage, error) {
+	row := q.db.QueryRowContext(ctx, getClassLevels, arg.ID, arg.UserID)
 	var class_levels json.RawMessage
 	err := row.Scan(&class_levels)
 	return class_levels, err
@@ -178,6 +196,30 @@ func (q *Queries) GetSpellSlotsMax(ctx context.Context, arg GetSpellSlotsMaxPara
 	return slots, err
 }
 
+const getUserCharacter = `-- name: GetUserCharacter :one
+SELECT id, name, class_levels
+FROM characters
+WHERE id = $1 AND user_id = $2
+`
+
+type GetUserCharacterParams struct {
+	ID     uuid.UUID
+	UserID uuid.UUID
+}
+
+type GetUserCharacterRow struct {
+	ID          uuid.UUID
+	Name        string
+	ClassLevels json.RawMessage
+}
+
+func (q *Queries) GetUserCharacter(ctx context.Context, arg GetUserCharacterParams) (GetUserCharacterRow, error) {
+	row := q.db.QueryRowContext(ctx, getUserCharacter, arg.ID, arg.UserID)
+	var i GetUserCharacterRow
+	err := row.Scan(&i.ID, &i.Name, &i.ClassLevels)
+	return i, err
+}
+
 const getUserCharacters = `-- name: GetUserCharacters :many
 SELECT id, name, class_levels
 FROM characters
@@ -214,24 +256,27 @@ func (q *Queries) GetUserCharacters(ctx context.Context, userID uuid.UUID) ([]Ge
 }
 
 const removeCharacterSpell = `-- name: RemoveCharacterSpell :exec
-DELETE FROM characters_spells
-WHERE spell_id = $1 AND char_id = $2
+DELETE FROM characters_spells AS cs
+USING characters AS c
+WHERE cs.char_id = c.id
+AND cs.spell_id = $1 AND cs.char_id = $2 AND c.user_id = $3
 `
 
 type RemoveCharacterSpellParams struct {
 	SpellID int32
 	CharID  uuid.UUID
+	UserID  uuid.UUID
 }
 
 func (q *Queries) RemoveCharacterSpell(ctx context.Context, arg RemoveCharacterSpellParams) error {
-	_, err := q.db.ExecContext(ctx, removeCharacterSpell, arg.SpellID, arg.CharID)
+	_, err := q.db.ExecContext(ctx, removeCharacterSpell, arg.SpellID, arg.CharID, arg.UserID)
 	return err
 }
 
 const updateCharacter = `-- name: UpdateCharacter :one
 UPDATE characters
 SET name = $1, class_levels = $2, updated_at = NOW()
-WHERE id = $3
+WHERE id = $3 AND user_id = $4
 RETURNING id, name, class_levels
 `
 
@@ -239,6 +284,7 @@ type UpdateCharacterParams struct {
 	Name        string
 	ClassLevels json.RawMessage
 	ID          uuid.UUID
+	UserID      uuid.UUID
 }
 
 type UpdateCharacterRow struct {
@@ -248,7 +294,12 @@ type UpdateCharacterRow struct {
 }
 
 func (q *Queries) UpdateCharacter(ctx context.Context, arg UpdateCharacterParams) (UpdateCharacterRow, error) {
-	row := q.db.QueryRowContext(ctx, updateCharacter, arg.Name, arg.ClassLevels, arg.ID)
+	row := q.db.QueryRowContext(ctx, updateCharacter,
+		arg.Name,
+		arg.ClassLevels,
+		arg.ID,
+		arg.UserID,
+	)
 	var i UpdateCharacterRow
 	err := row.Scan(&i.ID, &i.Name, &i.ClassLevels)
 	return i, err
@@ -13,6 +13,33 @@ import (
 	"github.com/sqlc-dev/pqtype"
 )
 
+type ApiKey struct {
+	ID         uuid.UUID
+	UserID     uuid.UUID
+	Name       string
+	Prefix     string
+	KeyHash    string
+	Scopes     []string
+	CreatedAt  time.Time
+	LastUsedAt sql.NullTime
+	ExpiresAt  sql.NullTime
+	RevokedAt  sql.NullTime
+}
+
+type AuditLog struct {
+	ID         uuid.UUID
+	CreatedAt  time.Time
+	ActorID    uuid.NullUUID
+	Action     string
+	TargetType string
+	TargetID   string
+	IpAddress  sql.NullString
+	Details    json.RawMessage
+	RequestID  sql.NullString
+	Before     pqtype.NullRawMessage
+	After      pqtype.NullRawMessage
+}
+
 type Character struct {
 	ID          uuid.UUID
 	Name        string
@@ -34,6 +61,42 @@ type Class struct {
 	Url   sql.NullString
 }
 
+type LoginThrottle struct {
+	Key           string
+	Failures      int32
+	LastFailureAt time.Time
+	LockedUntil   sql.NullTime
+}
+
+type OidcLoginState struct {
+	StateHash    string
+	Nonce        string
+	CodeVerifier string
+	CreatedAt    time.Time
+	ExpiresAt    time.Time
+}
+
+type PasswordResetToken struct {
+	TokenHash string
+	UserID    uuid.UUID
+	CreatedAt time.Time
+	ExpiresAt time.Time
+	UsedAt    sql.NullTime
+}
+
+type Permission struct {
+	Name        string
+	Description string
+}
+
+type RecoveryCode struct {
+	ID        uuid.UUID
+	UserID    uuid.UUID
+	CodeHash  string
+	CreatedAt time.Time
+	UsedAt    sql.NullTime
+}
+
 type RefreshToken struct {
 	Token     string
 	CreatedAt time.Time
@@ -41,6 +104,20 @@ type RefreshToken struct {
 	UserID    uuid.NullUUID
 	ExpiresAt time.Time
 	RevokedAt sql.NullTime
+	FamilyID  uuid.UUID
+	UsedAt    sql.NullTime
+	UserAgent sql.NullString
+	IpAddress sql.NullString
+}
+
+type Role struct {
+	Name        string
+	Description string
+}
+
+type RolePermission struct {
+	Role       string
+	Permission string
 }
 
 type Spell struct {
@@ -62,6 +139,7 @@ type Spell struct {
 	Damage        pqtype.NullRawMessage
 	Url           string
 	UpdatedAt     sql.NullTime
+	SearchVector  interface{}
 }
 
 type SpellClass struct {
@@ -69,6 +147,16 @@ type SpellClass struct {
 	ClassID int32
 }
 
+type SpellRevision struct {
+	ID         uuid.UUID
+	SpellIndex string
+	Revision   int32
+	CreatedAt  time.Time
+	EditorID   uuid.NullUUID
+	Action     string
+	Snapshot   json.RawMessage
+}
+
 type SpellSlot struct {
 	CasterType  string
 	CasterLevel int32
@@ -88,10 +176,30 @@ type Subclass struct {
 }
 
 type User struct {
-	ID             uuid.UUID
-	CreatedAt      time.Time
-	UpdatedAt      time.Time
-	Email          string
-	HashedPassword string
-	Role           string
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	HashedPassword  string
+	Role            string
+	EmailVerifiedAt sql.NullTime
+	DisabledAt      sql.NullTime
+}
+
+type UserIdentity struct {
+	ID          uuid.UUID
+	UserID      uuid.UUID
+	Issuer      string
+	Subject     string
+	Email       sql.NullString
+	CreatedAt   time.Time
+	LastLoginAt time.Time
+}
+
+type UserTotp struct {
+	UserID       uuid.UUID
+	Secret       string
+	CreatedAt    time.Time
+	ConfirmedAt  sql.NullTime
+	LastUsedStep sql.NullInt64
 }
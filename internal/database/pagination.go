@@ -0,0 +1,141 @@
+package database
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+var (
+	ErrInvalidCursor = errors.New("invalid cursor")
+	ErrInvalidSort   = errors.New("invalid sort")
+)
+
+// Page describes one page of a keyset-paginated list. Cursor is the opaque
+// value returned as the next cursor of the previous page, or empty for the
+// first page.
+type Page struct {
+	Limit  int32
+	Sort   string
+	Desc   bool
+	Cursor string
+}
+
+// sortKey is one column of a keyset. Cast is the SQL type the cursor value is
+// converted back to when comparing against expr.
+type sortKey struct {
+	Expr string
+	Cast string
+}
+
+type cursor struct {
+	Sort   string   `json:"s"`
+	Desc   bool     `json:"d"`
+	Values []string `json:"v"`
+}
+
+func encodeCursor(p Page, values []string) string {
+	data, _ := json.Marshal(cursor{Sort: p.Sort, Desc: p.Desc, Values: values})
+	return base64.RawURLEncoding.EncodeToString(data)
+}
+
+func decodeCursor(p Page, keys []sortKey) ([]string, error) {
+	data, err := base64.RawURLEncoding.DecodeString(p.Cursor)
+	if err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	var c cursor
+	if err := json.Unmarshal(data, &c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+
+	if c.Sort != p.Sort || c.Desc != p.Desc || len(c.Values) != len(keys) {
+		return nil, ErrInvalidCursor
+	}
+
+	return c.Values, nil
+}
+
+// trimPage cuts a page fetched with LIMIT p.Limit+1 down to p.Limit items.
+// The extra row only shows there is another page, whose cursor is built from
+// the keys of the last item kept. The cursor is empty on the last page.
+func trimPage[T any](items []T, keys [][]string, p Page) ([]T, string) {
+	if p.Limit > 0 && len(items) > int(p.Limit) {
+		return items[:p.Limit], encodeCursor(p, keys[p.Limit-1])
+	}
+	return items, ""
+}
+
+// keyset builds the cursor column list, the keyset WHERE condition and the
+// ORDER BY clause for a Page.
+type keyset struct {
+	keys    []sortKey
+	desc    bool
+	after   []string
+	columns string
+}
+
+func newKeyset(sorts map[string][]sortKey, p Page) (*keyset, error) {
+	keys, ok := sorts[p.Sort]
+	if !ok {
+		return nil, ErrInvalidSort
+	}
+
+	ks := &keyset{keys: keys, desc: p.Desc}
+
+	exprs := make([]string, len(keys))
+	for i, k := range keys {
+		exprs[i] = fmt.Sprintf("(%s)::text", k.Expr)
+	}
+	ks.columns = "ARRAY[" + strings.Join(exprs, ", ") + "]"
+
+	if p.Cursor != "" {
+		after, err := decodeCursor(p, keys)
+		if err != nil {
+			return nil, err
+		}
+		ks.after = after
+	}
+
+	return ks, nil
+}
+
+// condition returns the row comparison restricting results to those after the
+// cursor, appending its arguments to args. It returns "" on the first page.
+func (ks *keyset) condition(args *[]interface{}) string {
+	if ks.after == nil {
+		return ""
+	}
+
+	exprs := make([]string, len(ks.keys))
+	params := make([]string, len(ks.keys))
+	for i, k := range ks.keys {
+		*args = append(*args, ks.after[i])
+		exprs[i] = k.Expr
+		params[i] = fmt.Sprintf("$%d::%s", len(*args), k.Cast)
+	}
+
+	op := ">"
+	if ks.desc {
+		op = "<"
+	}
+
+	return fmt.Sprintf("(%s) %s (%s)", strings.Join(exprs, ", "), op, strings.Join(params, ", "))
+}
+
+func (ks *keyset) orderBy() string {
+	dir := "ASC"
+	if ks.desc {
+		dir = "DESC"
+	}
+
+	exprs := make([]string, len(ks.keys))
+	for i, k := range ks.keys {
+		exprs[i] = k.Expr + " " + dir
+	}
+
+	return "ORDER BY " + strings.Join(exprs, ", ")
+}
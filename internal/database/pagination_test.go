@@ -0,0 +1,136 @@
+package database
+
+import (
+	"encoding/base64"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+var testSorts = map[string][]sortKey{
+	"name": {
+		{Expr: `t.name`, Cast: "text"},
+		{Expr: `t.id`, Cast: "int"},
+	},
+}
+
+func TestCursorRoundTrip(t *testing.T) {
+	for _, desc := range []bool{false, true} {
+		p := Page{Sort: "name", Desc: desc}
+		p.Cursor = encodeCursor(p, []string{"Fire Bolt", "12"})
+
+		ks, err := newKeyset(testSorts, p)
+		if err != nil {
+			t.Fatalf("desc=%v: %v", desc, err)
+		}
+		if want := []string{"Fire Bolt", "12"}; !reflect.DeepEqual(ks.after, want) {
+			t.Errorf("desc=%v: after = %v, want %v", desc, ks.after, want)
+		}
+	}
+}
+
+func TestDecodeCursorRejects(t *testing.T) {
+	page := Page{Sort: "name"}
+	valid := encodeCursor(page, []string{"Fire Bolt", "12"})
+
+	tests := []struct {
+		name string
+		page Page
+	}{
+		{"not base64", Page{Sort: "name", Cursor: "not base64!"}},
+		{"not json", Page{Sort: "name", Cursor: base64.RawURLEncoding.EncodeToString([]byte("nope"))}},
+		{"other sort", Page{Sort: "level", Cursor: valid}},
+		{"other order", Page{Sort: "name", Desc: true, Cursor: valid}},
+		{"too few values", Page{Sort: "name", Cursor: encodeCursor(page, []string{"Fire Bolt"})}},
+		{"too many values", Page{Sort: "name", Cursor: encodeCursor(page, []string{"Fire Bolt", "12", "x"})}},
+	}
+
+	sorts := map[string][]sortKey{"name": testSorts["name"], "level": testSorts["name"]}
+	for _, tt := range tests {
+		if _, err := newKeyset(sorts, tt.page); !errors.Is(err, ErrInvalidCursor) {
+			t.Errorf("%s: err = %v, want ErrInvalidCursor", tt.name, err)
+		}
+	}
+}
+
+func TestNewKeysetUnknownSort(t *testing.T) {
+	for _, sort := range []string{"", "desc", "name; DROP TABLE spells"} {
+		if _, err := newKeyset(testSorts, Page{Sort: sort}); !errors.Is(err, ErrInvalidSort) {
+			t.Errorf("sort %q: err = %v, want ErrInvalidSort", sort, err)
+		}
+	}
+}
+
+func TestKeysetSQL(t *testing.T) {
+	ks, err := newKeyset(testSorts, Page{Sort: "name"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ARRAY[(t.name)::text, (t.id)::text]"; ks.columns != want {
+		t.Errorf("columns = %s, want %s", ks.columns, want)
+	}
+	if want := "ORDER BY t.name ASC, t.id ASC"; ks.orderBy() != want {
+		t.Errorf("orderBy = %s, want %s", ks.orderBy(), want)
+	}
+	args := []interface{}{"existing"}
+	if cond := ks.condition(&args); cond != "" || len(args) != 1 {
+		t.Errorf("first page condition = %q with %d args", cond, len(args))
+	}
+
+	p := Page{Sort: "name", Desc: true}
+	p.Cursor = encodeCursor(p, []string{"Shield", "7"})
+	ks, err = newKeyset(testSorts, p)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if want := "ORDER BY t.name DESC, t.id DESC"; ks.orderBy() != want {
+		t.Errorf("orderBy = %s, want %s", ks.orderBy(), want)
+	}
+	cond := ks.condition(&args)
+	if want := "(t.name, t.id) < ($2::text, $3::int)"; cond != want {
+		t.Errorf("condition = %s, want %s", cond, want)
+	}
+	if want := []interface{}{"existing", "Shield", "7"}; !reflect.DeepEqual(args, want) {
+		t.Errorf("args = %v, want %v", args, want)
+	}
+}
+
+func TestTrimPage(t *testing.T) {
+	items := []string{"a", "b", "c"}
+	keys := [][]string{{"a", "1"}, {"b", "2"}, {"c", "3"}}
+
+	tests := []struct {
+		name  string
+		limit int32
+		want  []string
+		next  []string
+	}{
+		{"no limit", 0, items, nil},
+		{"fewer than limit", 5, items, nil},
+		{"exactly limit", 3, items, nil},
+		{"one more than limit", 2, []string{"a", "b"}, []string{"b", "2"}},
+	}
+
+	for _, tt := range tests {
+		p := Page{Limit: tt.limit, Sort: "name"}
+		got, next := trimPage(items, keys, p)
+		if !reflect.DeepEqual(got, tt.want) {
+			t.Errorf("%s: items = %v, want %v", tt.name, got, tt.want)
+		}
+		if tt.next == nil {
+			if next != "" {
+				t.Errorf("%s: next cursor = %q, want none", tt.name, next)
+			}
+			continue
+		}
+
+		p.Cursor = next
+		ks, err := newKeyset(testSorts, p)
+		if err != nil {
+			t.Fatalf("%s: next cursor doesn't decode: %v", tt.name, err)
+		}
+		if !reflect.DeepEqual(ks.after, tt.next) {
+			t.Errorf("%s: next cursor is after %v, want %v", tt.name, ks.after, tt.next)
+		}
+	}
+}
@@ -135,6 +135,34 @@ func (q *Queries) AddSubclass(ctx context.Context, arg AddSubclassParams) (Subcl
 	return i, err
 }
 
+const createImportRevision = `-- name: CreateImportRevision :exec
+INSERT INTO spell_revisions (id, spell_index, revision, created_at, editor_id, action, snapshot)
+SELECT gen_random_uuid(), s."index", COALESCE((SELECT MAX(revision) FROM spell_revisions WHERE spell_index = s."index"), 0) + 1, NOW(), NULL, 'import', jsonb_build_object(
+    'index', s."index",
+    'name', s.name,
+    'range', COALESCE(s.range, ''),
+    'material', COALESCE(s.material, ''),
+    'ritual', COALESCE(s.ritual, false),
+    'duration', COALESCE(s.duration, ''),
+    'concentration', COALESCE(s.concentration, false),
+    'casting_time', COALESCE(s.casting_time, ''),
+    'level', COALESCE(s."level", 0),
+    'attack_type', COALESCE(s.attack_type, ''),
+    'school', s.school,
+    'desc', to_jsonb(s."desc"),
+    'higher_level', to_jsonb(s.higher_level),
+    'components', to_jsonb(s.components),
+    'damage', s.damage
+)
+FROM spells AS s
+WHERE s."index" = $1
+`
+
+func (q *Queries) CreateImportRevision(ctx context.Context, index string) error {
+	_, err := q.db.ExecContext(ctx, createImportRevision, index)
+	return err
+}
+
 const createSpell = `-- name: CreateSpell :one
 INSERT INTO spells (index, name, range, material, ritual, duration, concentration, casting_time, level, attack_type, school, "desc", higher_level, components, damage, url, updated_at)
 VALUES (
@@ -220,3 +248,172 @@ func (q *Queries) CreateSpell(ctx context.Context, arg CreateSpellParams) (Spell
 	)
 	return i, err
 }
+
+const deleteSpellClasses = `-- name: DeleteSpellClasses :exec
+DELETE FROM spell_classes
+WHERE spell_id = $1
+`
+
+func (q *Queries) DeleteSpellClasses(ctx context.Context, spellID int32) error {
+	_, err := q.db.ExecContext(ctx, deleteSpellClasses, spellID)
+	return err
+}
+
+const deleteSpellSubclasses = `-- name: DeleteSpellSubclasses :exec
+DELETE FROM spell_subclasses
+WHERE spell_id = $1
+`
+
+func (q *Queries) DeleteSpellSubclasses(ctx context.Context, spellID int32) error {
+	_, err := q.db.ExecContext(ctx, deleteSpellSubclasses, spellID)
+	return err
+}
+
+const getClassByIndex = `-- name: GetClassByIndex :one
+SELECT id, index, name, url
+FROM classes
+WHERE "index" = $1
+`
+
+func (q *Queries) GetClassByIndex(ctx context.Context, index string) (Class, error) {
+	row := q.db.QueryRowContext(ctx, getClassByIndex, index)
+	var i Class
+	err := row.Scan(
+		&i.ID,
+		&i.Index,
+		&i.Name,
+		&i.Url,
+	)
+	return i, err
+}
+
+const getSpellClassIndexes = `-- name: GetSpellClassIndexes :many
+SELECT c."index"
+FROM spell_classes AS sc
+JOIN classes AS c ON c.id = sc.class_id
+WHERE sc.spell_id = $1
+ORDER BY c."index"
+`
+
+func (q *Queries) GetSpellClassIndexes(ctx context.Context, spellID int32) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getSpellClassIndexes, spellID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var index string
+		if err := rows.Scan(&index); err != nil {
+			return nil, err
+		}
+		items = append(items, index)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSpellSubclassIndexes = `-- name: GetSpellSubclassIndexes :many
+SELECT sc."index"
+FROM spell_subclasses AS ss
+JOIN subclasses AS sc ON sc.id = ss.subclass_id
+WHERE ss.spell_id = $1
+ORDER BY sc."index"
+`
+
+func (q *Queries) GetSpellSubclassIndexes(ctx context.Context, spellID int32) ([]string, error) {
+	rows, err := q.db.QueryContext(ctx, getSpellSubclassIndexes, spellID)
+	if err != nil {
+		return nil, err
+	}
+	defer rows.Close()
+	var items []string
+	for rows.Next() {
+		var index string
+		if err := rows.Scan(&index); err != nil {
+			return nil, err
+		}
+		items = append(items, index)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, err
+	}
+	return items, nil
+}
+
+const getSubclassByIndex = `-- name: GetSubclassByIndex :one
+SELECT id, index, name, url
+FROM subclasses
+WHERE "index" = $1
+`
+
+func (q *Queries) GetSubclassByIndex(ctx context.Context, index string) (Subclass, error) {
+	row := q.db.QueryRowContext(ctx, getSubclassByIndex, index)
+	var i Subclass
+	err := row.Scan(
+		&i.ID,
+		&i.Index,
+		&i.Name,
+		&i.Url,
+	)
+	return i, err
+}
+
+const updateClass = `-- name: UpdateClass :exec
+UPDATE classes
+SET name = $2, url = $3
+WHERE id = $1
+`
+
+type UpdateClassParams struct {
+	ID   int32
+	Name string
+	Url  sql.NullString
+}
+
+func (q *Queries) UpdateClass(ctx context.Context, arg UpdateClassParams) error {
+	_, err := q.db.ExecContext(ctx, updateClass, arg.ID, arg.Name, arg.Url)
+	return err
+}
+
+const updateSpellSlots = `-- name: UpdateSpellSlots :exec
+UPDATE spell_slots
+SET slots = $3
+WHERE caster_type = $1 AND caster_level = $2
+`
+
+type UpdateSpellSlotsParams struct {
+	CasterType  string
+	CasterLevel int32
+	Slots       json.RawMessage
+}
+
+func (q *Queries) UpdateSpellSlots(ctx context.Context, arg UpdateSpellSlotsParams) error {
+	_, err := q.db.ExecContext(ctx, updateSpellSlots, arg.CasterType, arg.CasterLevel, arg.Slots)
+	return err
+}
+
+const updateSubclass = `-- name: UpdateSubclass :exec
+UPDATE subclasses
+SET name = $2, url = $3
+WHERE id = $1
+`
+
+type UpdateSubclassParams struct {
+	ID   int32
+	Name string
+	Url  sql.NullString
+}
+
+func (q *Queries) UpdateSubclass(ctx context.Context, arg UpdateSubclassParams) error {
+	_, err := q.db.ExecContext(ctx, updateSubclass, arg.ID, arg.Name, arg.Url)
+	return err
+}
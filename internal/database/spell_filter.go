@@ -0,0 +1,250 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/google/uuid"
+	"github.com/lib/pq"
+)
+
+// SpellFilter holds the optional filters for FilterSpells. Zero values are
+// ignored, so an empty SpellFilter matches every spell.
+type SpellFilter struct {
+	MinLevel      sql.NullInt32
+	MaxLevel      sql.NullInt32
+	Class         string
+	Subclass      string
+	School        string
+	Ritual        sql.NullBool
+	Concentration sql.NullBool
+	Components    []string
+	AttackType    string
+	CastingTime   string
+	CharacterID   uuid.NullUUID
+}
+
+type FilterSpellsRow struct {
+	Index         string
+	Name          string
+	Ritual        sql.NullBool
+	Concentration sql.NullBool
+	Level         sql.NullInt32
+	Url           string
+}
+
+var spellSorts = map[string][]sortKey{
+	"name": {
+		{Expr: `s.name`, Cast: "text"},
+		{Expr: `s."index"`, Cast: "text"},
+	},
+	"level": {
+		{Expr: `COALESCE(s."level", 0)`, Cast: "int"},
+		{Expr: `s.name`, Cast: "text"},
+		{Expr: `s."index"`, Cast: "text"},
+	},
+	"school": {
+		{Expr: `COALESCE(s.school->>'index', '')`, Cast: "text"},
+		{Expr: `s.name`, Cast: "text"},
+		{Expr: `s."index"`, Cast: "text"},
+	},
+	"updated_at": {
+		{Expr: `COALESCE(s.updated_at, 'epoch'::timestamp)`, Cast: "timestamp"},
+		{Expr: `s."index"`, Cast: "text"},
+	},
+}
+
+// spellQuery accumulates WHERE clauses and their positional arguments.
+type spellQuery struct {
+	where []string
+	args  []interface{}
+}
+
+func (sq *spellQuery) add(clause string, arg interface{}) {
+	sq.args = append(sq.args, arg)
+	sq.where = append(sq.where, fmt.Sprintf(clause, len(sq.args)))
+}
+
+func (sq *spellQuery) whereClause() string {
+	if len(sq.where) == 0 {
+		return ""
+	}
+	return "WHERE " + strings.Join(sq.where, " AND ")
+}
+
+func buildSpellFilter(f SpellFilter) *spellQuery {
+	sq := &spellQuery{}
+	if f.MinLevel.Valid {
+		sq.add(`s."level" >= $%d`, f.MinLevel.Int32)
+	}
+	if f.MaxLevel.Valid {
+		sq.add(`s."level" <= $%d`, f.MaxLevel.Int32)
+	}
+	if f.Class != "" {
+		sq.add(`EXISTS (
+    SELECT 1 FROM spell_classes AS sc
+    JOIN classes AS c ON c.id = sc.class_id
+    WHERE sc.spell_id = s.id AND c."index" = $%d
+)`, f.Class)
+	}
+	if f.Subclass != "" {
+		sq.add(`EXISTS (
+    SELECT 1 FROM spell_subclasses AS ss
+    JOIN subclasses AS sub ON sub.id = ss.subclass_id
+    WHERE ss.spell_id = s.id AND sub."index" = $%d
+)`, f.Subclass)
+	}
+	if f.School != "" {
+		sq.add(`LOWER(s.school->>'index') = LOWER($%d)`, f.School)
+	}
+	if f.Ritual.Valid {
+		sq.add(`COALESCE(s.ritual, 'f') = $%d`, f.Ritual.Bool)
+	}
+	if f.Concentration.Valid {
+		sq.add(`COALESCE(s.concentration, 'f') = $%d`, f.Concentration.Bool)
+	}
+	if len(f.Components) > 0 {
+		sq.add(`s.components @> $%d`, pq.Array(f.Components))
+	}
+	if f.AttackType != "" {
+		sq.add(`LOWER(s.attack_type) = LOWER($%d)`, f.AttackType)
+	}
+	if f.CastingTime != "" {
+		sq.add(`LOWER(s.casting_time) = LOWER($%d)`, f.CastingTime)
+	}
+	if f.CharacterID.Valid {
+		sq.add(`EXISTS (
+    SELECT 1 FROM characters_spells AS cs
+    WHERE cs.spell_id = s.id AND cs.char_id = $%d
+)`, f.CharacterID.UUID)
+	}
+	return sq
+}
+
+// FilterSpells returns one page of the spells matching all of the filters in
+// f, along with the cursor for the next page. The cursor is empty when there
+// are no more results. A zero p.Limit returns every matching spell.
+func (q *Queries) FilterSpells(ctx context.Context, f SpellFilter, p Page) ([]FilterSpellsRow, string, error) {
+	ks, err := newKeyset(spellSorts, p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	sq := buildSpellFilter(f)
+	if cond := ks.condition(&sq.args); cond != "" {
+		sq.where = append(sq.where, cond)
+	}
+
+	query := `SELECT s."index", s.name, s.ritual, s.concentration, s."level", s.url, ` + ks.columns + `
+FROM spells AS s
+` + sq.whereClause() + `
+` + ks.orderBy()
+	if p.Limit > 0 {
+		sq.args = append(sq.args, p.Limit+1)
+		query += fmt.Sprintf("\nLIMIT $%d", len(sq.args))
+	}
+
+	rows, err := q.db.QueryContext(ctx, query, sq.args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	var items []FilterSpellsRow
+	var keys [][]string
+	for rows.Next() {
+		var i FilterSpellsRow
+		var key []string
+		if err := rows.Scan(
+			&i.Index,
+			&i.Name,
+			&i.Ritual,
+			&i.Concentration,
+			&i.Level,
+			&i.Url,
+			pq.Array(&key),
+		); err != nil {
+			return nil, "", err
+		}
+		items = append(items, i)
+		keys = append(keys, key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, "", err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	items, next := trimPage(items, keys, p)
+	return items, next, nil
+}
+
+// CountSpells returns the number of spells matching all of the filters in f.
+func (q *Queries) CountSpells(ctx context.Context, f SpellFilter) (int64, error) {
+	sq := buildSpellFilter(f)
+	query := `SELECT COUNT(*)
+FROM spells AS s
+` + sq.whereClause()
+
+	row := q.db.QueryRowContext(ctx, query, sq.args...)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
+
+// ExportSpells calls fn with every spell matching f, in the order given by
+// p.Sort and p.Desc, without loading them all into memory first. p.Limit is
+// ignored. Iteration stops at the first error fn returns.
+func (q *Queries) ExportSpells(ctx context.Context, f SpellFilter, p Page, fn func(GetSpellRow) error) error {
+	ks, err := newKeyset(spellSorts, p)
+	if err != nil {
+		return err
+	}
+
+	sq := buildSpellFilter(f)
+	if cond := ks.condition(&sq.args); cond != "" {
+		sq.where = append(sq.where, cond)
+	}
+
+	query := `SELECT s."index", s.name, s.range, s.material, s.ritual, s.duration, s.concentration, s.casting_time, s."level", s.attack_type, s.school, s."desc", s.higher_level, s.components, s.damage
+FROM spells AS s
+` + sq.whereClause() + `
+` + ks.orderBy()
+
+	rows, err := q.db.QueryContext(ctx, query, sq.args...)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+	for rows.Next() {
+		var i GetSpellRow
+		if err := rows.Scan(
+			&i.Index,
+			&i.Name,
+			&i.Range,
+			&i.Material,
+			&i.Ritual,
+			&i.Duration,
+			&i.Concentration,
+			&i.CastingTime,
+			&i.Level,
+			&i.AttackType,
+			&i.School,
+			pq.Array(&i.Desc),
+			pq.Array(&i.HigherLevel),
+			pq.Array(&i.Components),
+			&i.Damage,
+		); err != nil {
+			return err
+		}
+		if err := fn(i); err != nil {
+			return err
+		}
+	}
+	if err := rows.Close(); err != nil {
+		return err
+	}
+	return rows.Err()
+}
@@ -13,48 +13,17 @@ import (
 	"github.com/sqlc-dev/pqtype"
 )
 
-const getAllSpells = `-- name: GetAllSpells :many
-SELECT "index", name, ritual, concentration, level, url
-FROM spells
+const deleteSpell = `-- name: DeleteSpell :execrows
+DELETE FROM spells
+WHERE "index" = $1
 `
 
-type GetAllSpellsRow struct {
-	Index         string
-	Name          string
-	Ritual        sql.NullBool
-	Concentration sql.NullBool
-	Level         sql.NullInt32
-	Url           string
-}
-
-func (q *Queries) GetAllSpells(ctx context.Context) ([]GetAllSpellsRow, error) {
-	rows, err := q.db.QueryContext(ctx, getAllSpells)
+func (q *Queries) DeleteSpell(ctx context.Context, index string) (int64, error) {
+	result, err := q.db.ExecContext(ctx, deleteSpell, index)
 	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []GetAllSpellsRow
-	for rows.Next() {
-		var i GetAllSpellsRow
-		if err := rows.Scan(
-			&i.Index,
-			&i.Name,
-			&i.Ritual,
-			&i.Concentration,
-			&i.Level,
-			&i.Url,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
+		return 0, err
 	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+	return result.RowsAffected()
 }
 
 const getSpell = `-- name: GetSpell :one
@@ -104,238 +73,65 @@ func (q *Queries) GetSpell(ctx context.Context, index string) (GetSpellRow, erro
 	return i, err
 }
 
-const getSpellID = `-- name: GetSpellID :one
-SELECT id
+const getSpellForUpdate = `-- name: GetSpellForUpdate :one
+SELECT "index", name, range, material, ritual, duration, concentration, casting_time, "level", attack_type, school, "desc", higher_level, components, damage
 FROM spells
 WHERE "index" = $1
+FOR UPDATE
 `
 
-func (q *Queries) GetSpellID(ctx context.Context, index string) (int32, error) {
-	row := q.db.QueryRowContext(ctx, getSpellID, index)
-	var id int32
-	err := row.Scan(&id)
-	return id, err
-}
-
-const getSpellsClass = `-- name: GetSpellsClass :many
-SELECT s."index", s.name, s.ritual, s.concentration, s.level, s.url
-FROM spells AS s
-JOIN spell_classes AS sc ON sc.spell_id = s.id
-JOIN classes AS c ON c.id = sc.class_id
-WHERE c."index" = $1
-ORDER BY s.level, s.name
-`
-
-type GetSpellsClassRow struct {
+type GetSpellForUpdateRow struct {
 	Index         string
 	Name          string
+	Range         sql.NullString
+	Material      sql.NullString
 	Ritual        sql.NullBool
+	Duration      sql.NullString
 	Concentration sql.NullBool
+	CastingTime   sql.NullString
 	Level         sql.NullInt32
-	Url           string
-}
-
-func (q *Queries) GetSpellsClass(ctx context.Context, index string) ([]GetSpellsClassRow, error) {
-	rows, err := q.db.QueryContext(ctx, getSpellsClass, index)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []GetSpellsClassRow
-	for rows.Next() {
-		var i GetSpellsClassRow
-		if err := rows.Scan(
-			&i.Index,
-			&i.Name,
-			&i.Ritual,
-			&i.Concentration,
-			&i.Level,
-			&i.Url,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-
-const getSpellsConcentration = `-- name: GetSpellsConcentration :many
-SELECT "index", name, level, url
-FROM spells
-WHERE concentration = 't'
-ORDER BY level, name
-`
-
-type GetSpellsConcentrationRow struct {
-	Index string
-	Name  string
-	Level sql.NullInt32
-	Url   string
-}
-
-func (q *Queries) GetSpellsConcentration(ctx context.Context) ([]GetSpellsConcentrationRow, error) {
-	rows, err := q.db.QueryContext(ctx, getSpellsConcentration)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []GetSpellsConcentrationRow
-	for rows.Next() {
-		var i GetSpellsConcentrationRow
-		if err := rows.Scan(
-			&i.Index,
-			&i.Name,
-			&i.Level,
-			&i.Url,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-
-const getSpellsLevel = `-- name: GetSpellsLevel :many
-SELECT "index", name, level, url
-FROM spells
-WHERE "level" = $1
-`
-
-type GetSpellsLevelRow struct {
-	Index string
-	Name  string
-	Level sql.NullInt32
-	Url   string
+	AttackType    sql.NullString
+	School        pqtype.NullRawMessage
+	Desc          []string
+	HigherLevel   []string
+	Components    []string
+	Damage        pqtype.NullRawMessage
 }
 
-func (q *Queries) GetSpellsLevel(ctx context.Context, level sql.NullInt32) ([]GetSpellsLevelRow, error) {
-	rows, err := q.db.QueryContext(ctx, getSpellsLevel, level)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []GetSpellsLevelRow
-	for rows.Next() {
-		var i GetSpellsLevelRow
-		if err := rows.Scan(
-			&i.Index,
-			&i.Name,
-			&i.Level,
-			&i.Url,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+func (q *Queries) GetSpellForUpdate(ctx context.Context, index string) (GetSpellForUpdateRow, error) {
+	row := q.db.QueryRowContext(ctx, getSpellForUpdate, index)
+	var i GetSpellForUpdateRow
+	err := row.Scan(
+		&i.Index,
+		&i.Name,
+		&i.Range,
+		&i.Material,
+		&i.Ritual,
+		&i.Duration,
+		&i.Concentration,
+		&i.CastingTime,
+		&i.Level,
+		&i.AttackType,
+		&i.School,
+		pq.Array(&i.Desc),
+		pq.Array(&i.HigherLevel),
+		pq.Array(&i.Components),
+		&i.Damage,
+	)
+	return i, err
 }
 
-const getSpellsRitual = `-- name: GetSpellsRitual :many
-SELECT "index", name, level, url
+const getSpellID = `-- name: GetSpellID :one
+SELECT id
 FROM spells
-WHERE ritual = 't'
-ORDER BY level, name
-`
-
-type GetSpellsRitualRow struct {
-	Index string
-	Name  string
-	Level sql.NullInt32
-	Url   string
-}
-
-func (q *Queries) GetSpellsRitual(ctx context.Context) ([]GetSpellsRitualRow, error) {
-	rows, err := q.db.QueryContext(ctx, getSpellsRitual)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []GetSpellsRitualRow
-	for rows.Next() {
-		var i GetSpellsRitualRow
-		if err := rows.Scan(
-			&i.Index,
-			&i.Name,
-			&i.Level,
-			&i.Url,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
-}
-
-const getSpellsSubclass = `-- name: GetSpellsSubclass :many
-SELECT s."index", s.name, s.ritual, s.concentration, s.level, s.url
-FROM spells AS s
-JOIN spell_subclasses AS ss ON ss.spell_id = s.id
-JOIN subclasses AS sc ON sc.id = ss.subclass_id
-WHERE sc."index" = $1
-ORDER BY s.level, s.name
+WHERE "index" = $1
 `
 
-type GetSpellsSubclassRow struct {
-	Index         string
-	Name          string
-	Ritual        sql.NullBool
-	Concentration sql.NullBool
-	Level         sql.NullInt32
-	Url           string
-}
-
-func (q *Queries) GetSpellsSubclass(ctx context.Context, index string) ([]GetSpellsSubclassRow, error) {
-	rows, err := q.db.QueryContext(ctx, getSpellsSubclass, index)
-	if err != nil {
-		return nil, err
-	}
-	defer rows.Close()
-	var items []GetSpellsSubclassRow
-	for rows.Next() {
-		var i GetSpellsSubclassRow
-		if err := rows.Scan(
-			&i.Index,
-			&i.Name,
-			&i.Ritual,
-			&i.Concentration,
-			&i.Level,
-			&i.Url,
-		); err != nil {
-			return nil, err
-		}
-		items = append(items, i)
-	}
-	if err := rows.Close(); err != nil {
-		return nil, err
-	}
-	if err := rows.Err(); err != nil {
-		return nil, err
-	}
-	return items, nil
+func (q *Queries) GetSpellID(ctx context.Context, index string) (int32, error) {
+	row := q.db.QueryRowContext(ctx, getSpellID, index)
+	var id int32
+	err := row.Scan(&id)
+	return id, err
 }
 
 const updateSpell = `-- name: UpdateSpell :one
@@ -0,0 +1,133 @@
+package database
+
+import (
+	"context"
+	"database/sql"
+	"fmt"
+	"strings"
+
+	"github.com/lib/pq"
+)
+
+// UserFilter holds the optional filters for ListUsers. Zero values are
+// ignored.
+type UserFilter struct {
+	// Query matches any part of the email address, case-insensitively.
+	Query    string
+	Role     string
+	Disabled sql.NullBool
+}
+
+var userSorts = map[string][]sortKey{
+	"email": {
+		{Expr: `u.email`, Cast: "text"},
+		{Expr: `u.id`, Cast: "uuid"},
+	},
+	"created_at": {
+		{Expr: `u.created_at`, Cast: "timestamp"},
+		{Expr: `u.id`, Cast: "uuid"},
+	},
+}
+
+func buildUserFilter(f UserFilter) ([]string, []interface{}) {
+	var where []string
+	var args []interface{}
+	add := func(clause string, arg interface{}) {
+		args = append(args, arg)
+		where = append(where, fmt.Sprintf(clause, len(args)))
+	}
+
+	if f.Query != "" {
+		add(`u.email ILIKE '%%' || $%d || '%%'`, escapeLike(f.Query))
+	}
+	if f.Role != "" {
+		add(`u."role" = $%d`, f.Role)
+	}
+	if f.Disabled.Valid {
+		add(`(u.disabled_at IS NOT NULL) = $%d`, f.Disabled.Bool)
+	}
+	return where, args
+}
+
+// escapeLike escapes the LIKE wildcards in s so it matches literally.
+func escapeLike(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `%`, `\%`, `_`, `\_`).Replace(s)
+}
+
+// ListUsers returns one page of the users matching f, along with the cursor
+// for the next page.
+func (q *Queries) ListUsers(ctx context.Context, f UserFilter, p Page) ([]User, string, error) {
+	ks, err := newKeyset(userSorts, p)
+	if err != nil {
+		return nil, "", err
+	}
+
+	where, args := buildUserFilter(f)
+	if cond := ks.condition(&args); cond != "" {
+		where = append(where, cond)
+	}
+
+	query := `SELECT u.id, u.created_at, u.updated_at, u.email, u.hashed_password, u."role", u.email_verified_at, u.disabled_at, ` + ks.columns + `
+FROM users AS u
+`
+	if len(where) > 0 {
+		query += "WHERE " + strings.Join(where, " AND ") + "\n"
+	}
+	query += ks.orderBy()
+	if p.Limit > 0 {
+		args = append(args, p.Limit+1)
+		query += fmt.Sprintf("\nLIMIT $%d", len(args))
+	}
+
+	rows, err := q.db.QueryContext(ctx, query, args...)
+	if err != nil {
+		return nil, "", err
+	}
+	defer rows.Close()
+	var items []User
+	var keys [][]string
+	for rows.Next() {
+		var i User
+		var key []string
+		if err := rows.Scan(
+			&i.ID,
+			&i.CreatedAt,
+			&i.UpdatedAt,
+			&i.Email,
+			&i.HashedPassword,
+			&i.Role,
+			&i.EmailVerifiedAt,
+			&i.DisabledAt,
+			pq.Array(&key),
+		); err != nil {
+			return nil, "", err
+		}
+		items = append(items, i)
+		keys = append(keys, key)
+	}
+	if err := rows.Close(); err != nil {
+		return nil, "", err
+	}
+	if err := rows.Err(); err != nil {
+		return nil, "", err
+	}
+
+	items, next := trimPage(items, keys, p)
+	return items, next, nil
+}
+
+// CountUsers returns the number of users matching f.
+func (q *Queries) CountUsers(ctx context.Context, f UserFilter) (int64, error) {
+	where, args := buildUserFilter(f)
+	query := `SELECT COUNT(*)
+FROM users AS u
+`
+	if len(where) > 0 {
+		query += "WHERE " + strings.Join(where, " AND ")
+	}
+
+	row := q.db.QueryRowContext(ctx, query, args...)
+	var count int64
+	err := row.Scan(&count)
+	return count, err
+}
@@ -7,6 +7,7 @@ package database
 
 import (
 	"context"
+	"database/sql"
 	"time"
 
 	"github.com/google/uuid"
@@ -90,7 +91,7 @@ func (q *Queries) GetHashedPassword(ctx context.Context, id uuid.UUID) (GetHashe
 }
 
 const getUserByID = `-- name: GetUserByID :one
-SELECT id, created_at, updated_at, email, hashed_password, role
+SELECT id, created_at, updated_at, email, hashed_password, role, email_verified_at, disabled_at
 FROM users
 WHERE id = $1
 `
@@ -105,50 +106,95 @@ func (q *Queries) GetUserByID(ctx context.Context, id uuid.UUID) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.DisabledAt,
+	)
+	return i, err
+}
+
+const setUserDisabled = `-- name: SetUserDisabled :one
+UPDATE users
+SET disabled_at = $2, updated_at = NOW()
+WHERE id = $1
+RETURNING id, created_at, updated_at, email, hashed_password, "role", email_verified_at, disabled_at
+`
+
+type SetUserDisabledParams struct {
+	ID         uuid.UUID
+	DisabledAt sql.NullTime
+}
+
+func (q *Queries) SetUserDisabled(ctx context.Context, arg SetUserDisabledParams) (User, error) {
+	row := q.db.QueryRowContext(ctx, setUserDisabled, arg.ID, arg.DisabledAt)
+	var i User
+	err := row.Scan(
+		&i.ID,
+		&i.CreatedAt,
+		&i.UpdatedAt,
+		&i.Email,
+		&i.HashedPassword,
+		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.DisabledAt,
 	)
 	return i, err
 }
 
 const updateUser = `-- name: UpdateUser :one
 UPDATE users
-SET email = $1, hashed_password = $2, updated_at = NOW(), "role" = $3
-WHERE id = $4
-RETURNING id, created_at, updated_at, email
+SET email = $1, hashed_password = $2, updated_at = NOW(),
+    email_verified_at = CASE WHEN email = $1 THEN email_verified_at ELSE NULL END
+WHERE id = $3
+RETURNING id, created_at, updated_at, email, "role", email_verified_at
 `
 
 type UpdateUserParams struct {
 	Email          string
 	HashedPassword string
-	Role           string
 	ID             uuid.UUID
 }
 
 type UpdateUserRow struct {
-	ID        uuid.UUID
-	CreatedAt time.Time
-	UpdatedAt time.Time
-	Email     string
+	ID              uuid.UUID
+	CreatedAt       time.Time
+	UpdatedAt       time.Time
+	Email           string
+	Role            string
+	EmailVerifiedAt sql.NullTime
 }
 
 func (q *Queries) UpdateUser(ctx context.Context, arg UpdateUserParams) (UpdateUserRow, error) {
-	row := q.db.QueryRowContext(ctx, updateUser,
-		arg.Email,
-		arg.HashedPassword,
-		arg.Role,
-		arg.ID,
-	)
+	row := q.db.QueryRowContext(ctx, updateUser, arg.Email, arg.HashedPassword, arg.ID)
 	var i UpdateUserRow
 	err := row.Scan(
 		&i.ID,
 		&i.CreatedAt,
 		&i.UpdatedAt,
 		&i.Email,
+		&i.Role,
+		&i.EmailVerifiedAt,
 	)
 	return i, err
 }
 
+const updateUserPassword = `-- name: UpdateUserPassword :exec
+UPDATE users
+SET hashed_password = $1, updated_at = NOW()
+WHERE id = $2
+`
+
+type UpdateUserPasswordParams struct {
+	HashedPassword string
+	ID             uuid.UUID
+}
+
+func (q *Queries) UpdateUserPassword(ctx context.Context, arg UpdateUserPasswordParams) error {
+	_, err := q.db.ExecContext(ctx, updateUserPassword, arg.HashedPassword, arg.ID)
+	return err
+}
+
 const userLogin = `-- name: UserLogin :one
-SELECT id, created_at, updated_at, email, hashed_password, "role"
+SELECT id, created_at, updated_at, email, hashed_password, "role", email_verified_at, disabled_at
 FROM users
 WHERE email = $1
 `
@@ -163,6 +209,27 @@ func (q *Queries) UserLogin(ctx context.Context, email string) (User, error) {
 		&i.Email,
 		&i.HashedPassword,
 		&i.Role,
+		&i.EmailVerifiedAt,
+		&i.DisabledAt,
 	)
 	return i, err
 }
+
+const verifyUserEmail = `-- name: VerifyUserEmail :execrows
+UPDATE users
+SET email_verified_at = NOW(), updated_at = NOW()
+WHERE id = $1 AND email = $2
+`
+
+type VerifyUserEmailParams struct {
+	ID    uuid.UUID
+	Email string
+}
+
+func (q *Queries) VerifyUserEmail(ctx context.Context, arg VerifyUserEmailParams) (int64, error) {
+	result, err := q.db.ExecContext(ctx, verifyUserEmail, arg.ID, arg.Email)
+	if err != nil {
+		return 0, err
+	}
+	return result.RowsAffected()
+}
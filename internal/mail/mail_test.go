@@ -0,0 +1,41 @@
+package mail
+
+import (
+	"bytes"
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestLogMailer(t *testing.T) {
+	var buf bytes.Buffer
+	m := NewLogMailer(&buf)
+
+	err := m.Send(context.Background(), Message{
+		To:      "player@example.com",
+		Subject: "Reset your password",
+		Body:    "line one\nline two",
+	})
+	if err != nil {
+		t.Fatalf("Send returned error: %v", err)
+	}
+
+	out := buf.String()
+	for _, want := range []string{"To: player@example.com\r\n", "Subject: Reset your password\r\n", "line one\r\nline two"} {
+		if !strings.Contains(out, want) {
+			t.Fatalf("expected output to contain %q, got:\n%s", want, out)
+		}
+	}
+}
+
+func TestHeaderInjection(t *testing.T) {
+	m := NewLogMailer(&bytes.Buffer{})
+
+	err := m.Send(context.Background(), Message{
+		To:      "player@example.com\r\nBcc: everyone@example.com",
+		Subject: "hi",
+	})
+	if err == nil {
+		t.Fatalf("Send accepted a recipient containing a line break")
+	}
+}
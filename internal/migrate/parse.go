@@ -0,0 +1,144 @@
+package migrate
+
+import (
+	"bufio"
+	"fmt"
+	"io/fs"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// Migration is one versioned schema change, read from a goose-style SQL file
+// named like 012_roles_permissions.sql.
+type Migration struct {
+	Version	int64
+	Name	string
+	Up		[]string
+	Down	[]string
+}
+
+// Load reads every .sql migration in the root of fsys, sorted by version.
+func Load(fsys fs.FS) ([]Migration, error) {
+	files, err := fs.Glob(fsys, "*.sql")
+	if err != nil {
+		return nil, err
+	}
+
+	var migrations []Migration
+	seen := map[int64]string{}
+	for _, file := range files {
+		version, name, err := parseFilename(file)
+		if err != nil {
+			return nil, err
+		}
+		if other, ok := seen[version]; ok {
+			return nil, fmt.Errorf("%s and %s have the same version", other, file)
+		}
+		seen[version] = file
+
+		data, err := fs.ReadFile(fsys, file)
+		if err != nil {
+			return nil, err
+		}
+		up, down, err := parse(string(data))
+		if err != nil {
+			return nil, fmt.Errorf("%s: %w", file, err)
+		}
+
+		migrations = append(migrations, Migration{
+			Version:	version,
+			Name:		name,
+			Up:			up,
+			Down:		down,
+		})
+	}
+
+	sort.Slice(migrations, func(i, j int) bool {
+		return migrations[i].Version < migrations[j].Version
+	})
+	return migrations, nil
+}
+
+func parseFilename(file string) (int64, string, error) {
+	base := strings.TrimSuffix(path.Base(file), ".sql")
+	prefix, name, ok := strings.Cut(base, "_")
+	version, err := strconv.ParseInt(prefix, 10, 64)
+	if !ok || err != nil || version < 1 {
+		return 0, "", fmt.Errorf("%s: migration files must be named like 001_name.sql", file)
+	}
+	return version, name, nil
+}
+
+// parse splits a goose-style migration into its up and down statements.
+// Statements end at a line ending in a semicolon, except inside
+// StatementBegin/StatementEnd blocks, which are kept whole so function
+// bodies can contain semicolons.
+func parse(sql string) ([]string, []string, error) {
+	var up, down []string
+	var current *[]string
+	var stmt strings.Builder
+	inBlock := false
+
+	flush := func() {
+		if s := strings.TrimSpace(stmt.String()); s != "" && current != nil {
+			*current = append(*current, s)
+		}
+		stmt.Reset()
+	}
+
+	scanner := bufio.NewScanner(strings.NewReader(sql))
+	for scanner.Scan() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if annotation, ok := strings.CutPrefix(trimmed, "-- +goose "); ok {
+			switch strings.TrimSpace(annotation) {
+			case "Up":
+				flush()
+				current = &up
+			case "Down":
+				flush()
+				current = &down
+			case "StatementBegin":
+				flush()
+				inBlock = true
+			case "StatementEnd":
+				inBlock = false
+				flush()
+			default:
+				return nil, nil, fmt.Errorf("unsupported annotation %q", trimmed)
+			}
+			continue
+		}
+
+		if current == nil {
+			if trimmed != "" && !strings.HasPrefix(trimmed, "--") {
+				return nil, nil, fmt.Errorf("statement before -- +goose Up")
+			}
+			continue
+		}
+		if stmt.Len() == 0 && (trimmed == "" || strings.HasPrefix(trimmed, "--")) {
+			continue
+		}
+
+		stmt.WriteString(line)
+		stmt.WriteString("\n")
+		if !inBlock && strings.HasSuffix(trimmed, ";") {
+			flush()
+		}
+	}
+	if err := scanner.Err(); err != nil {
+		return nil, nil, err
+	}
+	if inBlock {
+		return nil, nil, fmt.Errorf("StatementBegin without StatementEnd")
+	}
+	flush()
+
+	if up == nil {
+		return nil, nil, fmt.Errorf("no -- +goose Up statements")
+	}
+	return up, down, nil
+}
@@ -0,0 +1,118 @@
+package migrate
+
+import (
+	"reflect"
+	"testing"
+	"testing/fstest"
+	"github.com/kblasti/spellbook/sql/schema"
+)
+
+func TestParse(t *testing.T) {
+	sql := `-- +goose Up
+-- a comment before the first statement
+CREATE TABLE things (
+    id INT PRIMARY KEY
+);
+ALTER TABLE things ADD COLUMN name TEXT;
+
+-- +goose StatementBegin
+CREATE FUNCTION noop() RETURNS trigger AS $$
+BEGIN
+    RETURN NEW;
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+-- +goose Down
+DROP FUNCTION noop;
+DROP TABLE things;
+`
+
+	up, down, err := parse(sql)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	wantUp := []string{
+		"CREATE TABLE things (\n    id INT PRIMARY KEY\n);",
+		"ALTER TABLE things ADD COLUMN name TEXT;",
+		"CREATE FUNCTION noop() RETURNS trigger AS $$\nBEGIN\n    RETURN NEW;\nEND;\n$$ LANGUAGE plpgsql;",
+	}
+	wantDown := []string{
+		"DROP FUNCTION noop;",
+		"DROP TABLE things;",
+	}
+	if !reflect.DeepEqual(up, wantUp) {
+		t.Errorf("up = %q, want %q", up, wantUp)
+	}
+	if !reflect.DeepEqual(down, wantDown) {
+		t.Errorf("down = %q, want %q", down, wantDown)
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	cases := map[string]string{
+		"no up":			"-- +goose Down\nDROP TABLE things;\n",
+		"before up":		"DROP TABLE things;\n-- +goose Up\n",
+		"unclosed block":	"-- +goose Up\n-- +goose StatementBegin\nSELECT 1;\n",
+		"unknown":			"-- +goose Up\n-- +goose Envsub\n",
+	}
+	for name, sql := range cases {
+		if _, _, err := parse(sql); err == nil {
+			t.Errorf("%s: expected an error", name)
+		}
+	}
+}
+
+func TestLoad(t *testing.T) {
+	fsys := fstest.MapFS{
+		"010_second.sql":	{Data: []byte("-- +goose Up\nSELECT 2;\n")},
+		"002_first.sql":	{Data: []byte("-- +goose Up\nSELECT 1;\n")},
+		"README.md":		{Data: []byte("not a migration")},
+	}
+
+	migrations, err := Load(fsys)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(migrations) != 2 {
+		t.Fatalf("got %d migrations, want 2", len(migrations))
+	}
+	if migrations[0].Version != 2 || migrations[0].Name != "first" {
+		t.Errorf("first migration = %d %s", migrations[0].Version, migrations[0].Name)
+	}
+	if migrations[1].Version != 10 || migrations[1].Name != "second" {
+		t.Errorf("second migration = %d %s", migrations[1].Version, migrations[1].Name)
+	}
+}
+
+func TestLoadRejectsBadNames(t *testing.T) {
+	for _, fsys := range []fstest.MapFS{
+		{"baseline.sql": {Data: []byte("-- +goose Up\nSELECT 1;\n")}},
+		{
+			"001_a.sql":	{Data: []byte("-- +goose Up\nSELECT 1;\n")},
+			"1_b.sql":		{Data: []byte("-- +goose Up\nSELECT 1;\n")},
+		},
+	} {
+		if _, err := Load(fsys); err == nil {
+			t.Errorf("expected an error loading %v", fsys)
+		}
+	}
+}
+
+// The embedded schema has to parse, be numbered without gaps and be
+// reversible, or a deploy would fail halfway.
+func TestEmbeddedSchema(t *testing.T) {
+	migrations, err := Load(schema.FS)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for i, migration := range migrations {
+		if migration.Version != int64(i+1) {
+			t.Errorf("migration %s has version %d, want %d", migration.Name, migration.Version, i+1)
+		}
+		if len(migration.Down) == 0 {
+			t.Errorf("migration %d %s has no down statements", migration.Version, migration.Name)
+		}
+	}
+}
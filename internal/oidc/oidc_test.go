@@ -0,0 +1,325 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/golang-jwt/jwt/v5"
+)
+
+const (
+	testClientID     = "spellbook"
+	testClientSecret = "s3cret"
+	testRedirectURL  = "https://spellbook.example/api/oidc/callback"
+)
+
+// mockProvider is a minimal OpenID Connect provider that signs ID tokens
+// with an in-memory RSA key and enforces PKCE on the token endpoint.
+type mockProvider struct {
+	t      *testing.T
+	server *httptest.Server
+	key    *rsa.PrivateKey
+	kid    string
+
+	mu    sync.Mutex
+	codes map[string]pendingCode
+	// claims overrides the ID token claims issued for the next code.
+	claims func(jwt.MapClaims)
+}
+
+type pendingCode struct {
+	challenge string
+	nonce     string
+}
+
+func newMockProvider(t *testing.T) *mockProvider {
+	t.Helper()
+
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	m := &mockProvider{t: t, key: key, kid: "test-key", codes: map[string]pendingCode{}}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]string{
+			"issuer":                 m.server.URL,
+			"authorization_endpoint": m.server.URL + "/authorize",
+			"token_endpoint":         m.server.URL + "/token",
+			"jwks_uri":               m.server.URL + "/jwks",
+		})
+	})
+	mux.HandleFunc("GET /jwks", func(w http.ResponseWriter, r *http.Request) {
+		json.NewEncoder(w).Encode(map[string]interface{}{
+			"keys": []map[string]string{{
+				"kty": "RSA",
+				"kid": m.kid,
+				"use": "sig",
+				"alg": "RS256",
+				"n":   base64.RawURLEncoding.EncodeToString(m.key.N.Bytes()),
+				"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(m.key.E)).Bytes()),
+			}},
+		})
+	})
+	mux.HandleFunc("GET /authorize", m.handleAuthorize)
+	mux.HandleFunc("POST /token", m.handleToken)
+
+	m.server = httptest.NewServer(mux)
+	t.Cleanup(m.server.Close)
+	return m
+}
+
+func (m *mockProvider) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != testClientID || q.Get("redirect_uri") != testRedirectURL ||
+		q.Get("response_type") != "code" || q.Get("code_challenge_method") != "S256" {
+		http.Error(w, "bad authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := "code-" + q.Get("state")
+	m.mu.Lock()
+	m.codes[code] = pendingCode{challenge: q.Get("code_challenge"), nonce: q.Get("nonce")}
+	m.mu.Unlock()
+
+	redirect := q.Get("redirect_uri") + "?" + url.Values{"code": {code}, "state": {q.Get("state")}}.Encode()
+	http.Redirect(w, r, redirect, http.StatusFound)
+}
+
+func (m *mockProvider) handleToken(w http.ResponseWriter, r *http.Request) {
+	tokenError := func(code string) {
+		w.WriteHeader(http.StatusBadRequest)
+		json.NewEncoder(w).Encode(map[string]string{"error": code})
+	}
+
+	id, secret, ok := r.BasicAuth()
+	if !ok || id != testClientID || secret != testClientSecret {
+		w.WriteHeader(http.StatusUnauthorized)
+		json.NewEncoder(w).Encode(map[string]string{"error": "invalid_client"})
+		return
+	}
+	if r.FormValue("grant_type") != "authorization_code" || r.FormValue("redirect_uri") != testRedirectURL {
+		tokenError("invalid_request")
+		return
+	}
+
+	m.mu.Lock()
+	pending, ok := m.codes[r.FormValue("code")]
+	delete(m.codes, r.FormValue("code"))
+	m.mu.Unlock()
+	if !ok || CodeChallenge(r.FormValue("code_verifier")) != pending.challenge {
+		tokenError("invalid_grant")
+		return
+	}
+
+	claims := jwt.MapClaims{
+		"iss":            m.server.URL,
+		"sub":            "user-123",
+		"aud":            testClientID,
+		"iat":            time.Now().Unix(),
+		"exp":            time.Now().Add(time.Hour).Unix(),
+		"nonce":          pending.nonce,
+		"email":          "wizard@example.com",
+		"email_verified": true,
+		"name":           "Wizard",
+	}
+	if m.claims != nil {
+		m.claims(claims)
+	}
+
+	json.NewEncoder(w).Encode(map[string]string{
+		"access_token": "opaque",
+		"token_type":   "Bearer",
+		"id_token":     m.sign(claims, m.key, m.kid),
+	})
+}
+
+func (m *mockProvider) sign(claims jwt.MapClaims, key *rsa.PrivateKey, kid string) string {
+	m.t.Helper()
+	token := jwt.NewWithClaims(jwt.SigningMethodRS256, claims)
+	token.Header["kid"] = kid
+	signed, err := token.SignedString(key)
+	if err != nil {
+		m.t.Fatalf("signing id token: %v", err)
+	}
+	return signed
+}
+
+func (m *mockProvider) discover(t *testing.T) *Provider {
+	t.Helper()
+	p, err := Discover(context.Background(), Config{
+		Issuer:       m.server.URL,
+		ClientID:     testClientID,
+		ClientSecret: testClientSecret,
+		RedirectURL:  testRedirectURL,
+	}, m.server.Client())
+	if err != nil {
+		t.Fatalf("Discover: %v", err)
+	}
+	return p
+}
+
+// authorize follows the authorization URL like a browser would and returns
+// the code from the redirect back to the application.
+func (m *mockProvider) authorize(t *testing.T, p *Provider, req AuthRequest) string {
+	t.Helper()
+
+	client := m.server.Client()
+	client.CheckRedirect = func(*http.Request, []*http.Request) error {
+		return http.ErrUseLastResponse
+	}
+
+	resp, err := client.Get(p.AuthCodeURL(req))
+	if err != nil {
+		t.Fatalf("authorize: %v", err)
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusFound {
+		t.Fatalf("authorize: expected redirect, got %d", resp.StatusCode)
+	}
+
+	location, err := url.Parse(resp.Header.Get("Location"))
+	if err != nil {
+		t.Fatalf("parsing redirect: %v", err)
+	}
+	if location.Query().Get("state") != req.State {
+		t.Fatalf("state was not echoed back")
+	}
+	return location.Query().Get("code")
+}
+
+func TestAuthorizationCodeFlow(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.discover(t)
+
+	req, err := NewAuthRequest()
+	if err != nil {
+		t.Fatalf("NewAuthRequest: %v", err)
+	}
+
+	authURL, err := url.Parse(p.AuthCodeURL(req))
+	if err != nil {
+		t.Fatalf("parsing auth URL: %v", err)
+	}
+	if got := authURL.Query().Get("code_challenge"); got != CodeChallenge(req.CodeVerifier) {
+		t.Fatalf("expected S256 challenge of the verifier, got %q", got)
+	}
+	if strings.Contains(authURL.RawQuery, req.CodeVerifier) {
+		t.Fatalf("auth URL leaks the code verifier")
+	}
+
+	code := m.authorize(t, p, req)
+
+	claims, err := p.Exchange(context.Background(), code, req.Nonce, req.CodeVerifier)
+	if err != nil {
+		t.Fatalf("Exchange: %v", err)
+	}
+
+	want := Claims{Subject: "user-123", Email: "wizard@example.com", EmailVerified: true, Name: "Wizard"}
+	if claims != want {
+		t.Fatalf("expected %+v, got %+v", want, claims)
+	}
+
+	if _, err := p.Exchange(context.Background(), code, req.Nonce, req.CodeVerifier); err == nil {
+		t.Fatalf("expected a redeemed code to be rejected")
+	}
+}
+
+func TestExchangeRejectsWrongVerifier(t *testing.T) {
+	m := newMockProvider(t)
+	p := m.discover(t)
+
+	req, _ := NewAuthRequest()
+	other, _ := NewAuthRequest()
+	code := m.authorize(t, p, req)
+
+	if _, err := p.Exchange(context.Background(), code, req.Nonce, other.CodeVerifier); err == nil {
+		t.Fatalf("expected a mismatched code verifier to be rejected")
+	}
+}
+
+func TestExchangeRejectsInvalidIDTokens(t *testing.T) {
+	otherKey, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		t.Fatalf("generating key: %v", err)
+	}
+
+	tests := []struct {
+		name   string
+		claims func(jwt.MapClaims)
+		nonce  func(AuthRequest) string
+	}{
+		{name: "wrong nonce", nonce: func(AuthRequest) string { return "other" }},
+		{name: "wrong audience", claims: func(c jwt.MapClaims) { c["aud"] = "someone-else" }},
+		{name: "wrong issuer", claims: func(c jwt.MapClaims) { c["iss"] = "https://evil.example" }},
+		{name: "expired", claims: func(c jwt.MapClaims) { c["exp"] = time.Now().Add(-time.Hour).Unix() }},
+		{name: "no subject", claims: func(c jwt.MapClaims) { delete(c, "sub") }},
+		{name: "untrusted azp", claims: func(c jwt.MapClaims) {
+			c["aud"] = []string{testClientID, "other-client"}
+			c["azp"] = "other-client"
+		}},
+	}
+
+	for _, tc := range tests {
+		t.Run(tc.name, func(t *testing.T) {
+			m := newMockProvider(t)
+			m.claims = tc.claims
+			p := m.discover(t)
+
+			req, _ := NewAuthRequest()
+			code := m.authorize(t, p, req)
+
+			nonce := req.Nonce
+			if tc.nonce != nil {
+				nonce = tc.nonce(req)
+			}
+
+			if _, err := p.Exchange(context.Background(), code, nonce, req.CodeVerifier); err == nil {
+				t.Fatalf("expected the id token to be rejected")
+			}
+		})
+	}
+
+	t.Run("unknown signing key", func(t *testing.T) {
+		m := newMockProvider(t)
+		p := m.discover(t)
+
+		token := m.sign(jwt.MapClaims{
+			"iss":   m.server.URL,
+			"sub":   "user-123",
+			"aud":   testClientID,
+			"iat":   time.Now().Unix(),
+			"exp":   time.Now().Add(time.Hour).Unix(),
+			"nonce": "n",
+		}, otherKey, m.kid)
+
+		if _, err := p.VerifyIDToken(context.Background(), token, "n"); err == nil {
+			t.Fatalf("expected a token signed by another key to be rejected")
+		}
+	})
+}
+
+func TestDiscoverRejectsIssuerMismatch(t *testing.T) {
+	m := newMockProvider(t)
+
+	_, err := Discover(context.Background(), Config{
+		Issuer:   m.server.URL + "/",
+		ClientID: testClientID,
+	}, m.server.Client())
+	if err == nil {
+		t.Fatalf("expected an issuer mismatch to be rejected")
+	}
+}
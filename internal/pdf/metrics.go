@@ -0,0 +1,77 @@
+package pdf
+
+// Glyph widths of the printable ASCII characters, from space to tilde, in
+// thousandths of the font size, as published in the Adobe font metrics.
+// Helvetica-Oblique has the same widths as Helvetica.
+var asciiWidths = [][95]int{
+	Helvetica: {
+		278, 278, 355, 556, 556, 889, 667, 191, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 278, 278, 584, 584, 584, 556,
+		1015, 667, 667, 722, 722, 667, 611, 778, 722, 278, 500, 667, 556, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 278, 278, 278, 469, 556,
+		333, 556, 556, 500, 556, 556, 278, 556, 556, 222, 222, 500, 222, 833, 556, 556,
+		556, 556, 333, 500, 278, 556, 500, 722, 500, 500, 500, 334, 260, 334, 584,
+	},
+	HelveticaBold: {
+		278, 333, 474, 556, 556, 889, 722, 238, 333, 333, 389, 584, 278, 333, 278, 278,
+		556, 556, 556, 556, 556, 556, 556, 556, 556, 556, 333, 333, 584, 584, 584, 611,
+		975, 722, 722, 722, 722, 667, 611, 778, 722, 278, 556, 722, 611, 833, 722, 778,
+		667, 778, 722, 667, 611, 722, 667, 944, 667, 667, 611, 333, 278, 333, 584, 556,
+		333, 556, 611, 556, 611, 556, 333, 611, 611, 278, 278, 556, 278, 889, 611, 611,
+		611, 611, 389, 556, 333, 611, 556, 778, 556, 556, 500, 389, 280, 389, 584,
+	},
+}
+
+// winAnsi maps the characters outside Latin-1 that spell text uses to their
+// WinAnsiEncoding bytes.
+var winAnsi = map[rune]byte{
+	'€': 0x80, '‚': 0x82, '„': 0x84, '…': 0x85, '†': 0x86, '‡': 0x87,
+	'‘': 0x91, '’': 0x92, '“': 0x93, '”': 0x94, '•': 0x95, '–': 0x96,
+	'—': 0x97, '™': 0x99, '×': 0xd7,
+}
+
+// specialWidths holds the widths of the non-ASCII bytes that differ from
+// the default used for accented letters. They are the same in every font.
+var specialWidths = map[byte]int{
+	0x82: 222, 0x84: 333, 0x85: 1000, 0x91: 222, 0x92: 222, 0x93: 333,
+	0x94: 333, 0x95: 350, 0x96: 556, 0x97: 1000, 0x99: 1000, 0xa0: 278,
+	0xb0: 400, 0xd7: 584,
+}
+
+// encode converts s to WinAnsiEncoding. Characters it can't represent
+// become question marks.
+func encode(s string) []byte {
+	b := make([]byte, 0, len(s))
+	for _, r := range s {
+		switch {
+		case r < 0x80 || (r >= 0xa0 && r <= 0xff):
+			b = append(b, byte(r))
+		case winAnsi[r] != 0:
+			b = append(b, winAnsi[r])
+		default:
+			b = append(b, '?')
+		}
+	}
+	return b
+}
+
+// Width returns how wide s is in points when set in font at size.
+func Width(font Font, size float64, s string) float64 {
+	widths := asciiWidths[Helvetica]
+	if font == HelveticaBold {
+		widths = asciiWidths[HelveticaBold]
+	}
+
+	total := 0
+	for _, c := range encode(s) {
+		switch {
+		case c >= 32 && c <= 126:
+			total += widths[c-32]
+		case specialWidths[c] != 0:
+			total += specialWidths[c]
+		default:
+			total += 556
+		}
+	}
+	return float64(total) * size / 1000
+}
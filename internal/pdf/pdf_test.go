@@ -0,0 +1,106 @@
+package pdf
+
+import (
+	"bytes"
+	"compress/zlib"
+	"fmt"
+	"io"
+	"math"
+	"regexp"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+func TestWidth(t *testing.T) {
+	cases := []struct {
+		font Font
+		size float64
+		s    string
+		want float64
+	}{
+		{Helvetica, 10, "Hello", 22.78},
+		{HelveticaOblique, 10, "Hello", 22.78},
+		{HelveticaBold, 10, "Hello", 24.45},
+		{Helvetica, 12, "", 0},
+		{Helvetica, 10, "—", 10},
+	}
+	for _, c := range cases {
+		if got := Width(c.font, c.size, c.s); math.Abs(got-c.want) > 0.001 {
+			t.Errorf("Width(%d, %v, %q) = %v, want %v", c.font, c.size, c.s, got, c.want)
+		}
+	}
+}
+
+func TestEncode(t *testing.T) {
+	got := encode("It’s “café” — 漢")
+	want := []byte("It\x92s \x93caf\xe9\x94 \x97 ?")
+	if !bytes.Equal(got, want) {
+		t.Errorf("encode = %q, want %q", got, want)
+	}
+}
+
+func TestEscape(t *testing.T) {
+	if got := escape([]byte("a (b) \\c\n")); got != `a \(b\) \\c\012` {
+		t.Errorf("escape = %s", got)
+	}
+}
+
+func TestWriteTo(t *testing.T) {
+	doc := New(LetterWidth, LetterHeight)
+	first := doc.AddPage()
+	first.Text(HelveticaBold, 12, 10, 20, "Hello (world)")
+	first.Rect(10, 30, 100, 50, 1)
+	doc.AddPage().Line(0, 0, 612, 792, 0.5)
+
+	var buf bytes.Buffer
+	n, err := doc.WriteTo(&buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if n != int64(buf.Len()) {
+		t.Errorf("WriteTo reported %d bytes, wrote %d", n, buf.Len())
+	}
+	out := buf.String()
+
+	if !strings.HasPrefix(out, "%PDF-1.4\n") || !strings.HasSuffix(out, "%%EOF\n") {
+		t.Fatalf("missing header or trailer:\n%s", out)
+	}
+	if !strings.Contains(out, "/Count 2") {
+		t.Error("page tree doesn't count two pages")
+	}
+
+	// Every xref entry has to point at the start of its object.
+	startxref := regexp.MustCompile(`startxref\n(\d+)\n`).FindStringSubmatch(out)
+	if startxref == nil {
+		t.Fatal("no startxref")
+	}
+	xref, _ := strconv.Atoi(startxref[1])
+	if !strings.HasPrefix(out[xref:], "xref\n") {
+		t.Fatalf("startxref %d doesn't point at the xref table", xref)
+	}
+	entries := regexp.MustCompile(`(\d{10}) 00000 n `).FindAllStringSubmatch(out[xref:], -1)
+	if len(entries) != 9 {
+		t.Fatalf("got %d objects, want 9", len(entries))
+	}
+	for i, entry := range entries {
+		offset, _ := strconv.Atoi(entry[1])
+		if want := fmt.Sprintf("%d 0 obj\n", i+1); !strings.HasPrefix(out[offset:], want) {
+			t.Errorf("xref entry %d points at %q", i+1, out[offset:offset+10])
+		}
+	}
+
+	// The first page's content draws the text 20 points below the top.
+	stream := regexp.MustCompile(`(?s)stream\n(.*?)\nendstream`).FindStringSubmatch(out)
+	zr, err := zlib.NewReader(strings.NewReader(stream[1]))
+	if err != nil {
+		t.Fatal(err)
+	}
+	content, _ := io.ReadAll(zr)
+	if want := `BT /F2 12 Tf 10 772 Td (Hello \(world\)) Tj ET`; !strings.Contains(string(content), want) {
+		t.Errorf("content %q doesn't contain %q", content, want)
+	}
+	if want := "1 w 10 712 100 50 re S"; !strings.Contains(string(content), want) {
+		t.Errorf("content %q doesn't contain %q", content, want)
+	}
+}
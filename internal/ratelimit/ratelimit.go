@@ -0,0 +1,152 @@
+// Package ratelimit implements keyed token bucket rate limiting.
+package ratelimit
+
+import (
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"golang.org/x/time/rate"
+)
+
+// Policy allows Requests requests per Window. Requests is also the bucket
+// size, so a client that has been idle can burst up to the full quota.
+type Policy struct {
+	Requests int
+	Window   time.Duration
+}
+
+// ParsePolicy parses a policy written as "<requests>/<unit>", where unit is
+// s, m or h, for example "120/m".
+func ParsePolicy(s string) (Policy, error) {
+	n, unit, ok := strings.Cut(strings.TrimSpace(s), "/")
+	if !ok {
+		return Policy{}, fmt.Errorf("invalid rate limit %q, expected <requests>/<s|m|h>", s)
+	}
+
+	requests, err := strconv.Atoi(n)
+	if err != nil || requests <= 0 {
+		return Policy{}, fmt.Errorf("invalid rate limit %q, requests must be a positive integer", s)
+	}
+
+	windows := map[string]time.Duration{"s": time.Second, "m": time.Minute, "h": time.Hour}
+	window, ok := windows[unit]
+	if !ok {
+		return Policy{}, fmt.Errorf("invalid rate limit %q, unit must be s, m or h", s)
+	}
+
+	return Policy{Requests: requests, Window: window}, nil
+}
+
+// String formats the policy as a RateLimit-Policy header value.
+func (p Policy) String() string {
+	return fmt.Sprintf("%d;w=%d", p.Requests, int(p.Window.Seconds()))
+}
+
+func (p Policy) rate() rate.Limit {
+	return rate.Limit(float64(p.Requests) / p.Window.Seconds())
+}
+
+// Decision is the outcome of one request against a bucket.
+type Decision struct {
+	Allowed   bool
+	Limit     int
+	Remaining int
+	// Reset is how long until the bucket is full again.
+	Reset time.Duration
+	// RetryAfter is how long until the next request would be allowed. It is
+	// zero when the request was allowed.
+	RetryAfter time.Duration
+}
+
+// Limiter keeps one token bucket per key. Buckets that have been idle long
+// enough to refill completely are indistinguishable from new ones, so they
+// are evicted to keep memory bounded by the number of active clients.
+type Limiter struct {
+	policy Policy
+	now    func() time.Time
+
+	mu        sync.Mutex
+	buckets   map[string]*bucket
+	lastSweep time.Time
+}
+
+type bucket struct {
+	limiter  *rate.Limiter
+	lastSeen time.Time
+}
+
+func New(policy Policy) *Limiter {
+	return &Limiter{
+		policy:  policy,
+		now:     time.Now,
+		buckets: make(map[string]*bucket),
+	}
+}
+
+func (l *Limiter) Policy() Policy {
+	return l.policy
+}
+
+// Allow takes a token from key's bucket if one is available.
+func (l *Limiter) Allow(key string) Decision {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	now := l.now()
+	l.sweep(now)
+
+	b, ok := l.buckets[key]
+	if !ok {
+		b = &bucket{limiter: rate.NewLimiter(l.policy.rate(), l.policy.Requests)}
+		l.buckets[key] = b
+	}
+	b.lastSeen = now
+
+	allowed := b.limiter.AllowN(now, 1)
+	tokens := b.limiter.TokensAt(now)
+
+	d := Decision{
+		Allowed:   allowed,
+		Limit:     l.policy.Requests,
+		Remaining: int(math.Max(0, math.Floor(tokens))),
+		Reset:     l.refillTime(float64(l.policy.Requests) - tokens),
+	}
+	if !allowed {
+		d.RetryAfter = l.refillTime(1 - tokens)
+	}
+
+	return d
+}
+
+// refillTime returns how long the bucket takes to regain tokens.
+func (l *Limiter) refillTime(tokens float64) time.Duration {
+	if tokens <= 0 {
+		return 0
+	}
+	return time.Duration(tokens / float64(l.policy.rate()) * float64(time.Second))
+}
+
+// sweep evicts idle buckets at most once per window.
+func (l *Limiter) sweep(now time.Time) {
+	if now.Sub(l.lastSweep) < l.policy.Window {
+		return
+	}
+	l.lastSweep = now
+
+	for key, b := range l.buckets {
+		if now.Sub(b.lastSeen) >= l.policy.Window {
+			delete(l.buckets, key)
+		}
+	}
+}
+
+// Len returns the number of buckets currently tracked.
+func (l *Limiter) Len() int {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	return len(l.buckets)
+}
@@ -0,0 +1,111 @@
+package ratelimit
+
+import (
+	"testing"
+	"time"
+)
+
+type fakeClock struct {
+	t time.Time
+}
+
+func (c *fakeClock) now() time.Time {
+	return c.t
+}
+
+func newTestLimiter(policy Policy) (*Limiter, *fakeClock) {
+	clock := &fakeClock{t: time.Date(2025, 1, 1, 0, 0, 0, 0, time.UTC)}
+	l := New(policy)
+	l.now = clock.now
+	return l, clock
+}
+
+func TestParsePolicy(t *testing.T) {
+	valid := map[string]Policy{
+		"10/s":  {Requests: 10, Window: time.Second},
+		"120/m": {Requests: 120, Window: time.Minute},
+		" 5/h ": {Requests: 5, Window: time.Hour},
+	}
+	for s, want := range valid {
+		got, err := ParsePolicy(s)
+		if err != nil {
+			t.Fatalf("ParsePolicy(%q): %v", s, err)
+		}
+		if got != want {
+			t.Fatalf("ParsePolicy(%q): expected %+v, got %+v", s, want, got)
+		}
+	}
+
+	for _, s := range []string{"", "10", "10/d", "0/m", "-1/s", "x/m"} {
+		if _, err := ParsePolicy(s); err == nil {
+			t.Fatalf("ParsePolicy(%q): expected an error", s)
+		}
+	}
+
+	if got := (Policy{Requests: 120, Window: time.Minute}).String(); got != "120;w=60" {
+		t.Fatalf("unexpected policy header %q", got)
+	}
+}
+
+func TestLimiterBurstAndRefill(t *testing.T) {
+	l, clock := newTestLimiter(Policy{Requests: 3, Window: 3 * time.Second})
+
+	for i, wantRemaining := range []int{2, 1, 0} {
+		d := l.Allow("a")
+		if !d.Allowed || d.Remaining != wantRemaining || d.Limit != 3 {
+			t.Fatalf("request %d: unexpected decision %+v", i, d)
+		}
+	}
+
+	d := l.Allow("a")
+	if d.Allowed {
+		t.Fatalf("expected the fourth request to be limited")
+	}
+	if d.RetryAfter != time.Second {
+		t.Fatalf("expected to retry after 1s, got %v", d.RetryAfter)
+	}
+	if d.Reset != 3*time.Second {
+		t.Fatalf("expected the bucket to be full in 3s, got %v", d.Reset)
+	}
+
+	clock.t = clock.t.Add(time.Second)
+	if d := l.Allow("a"); !d.Allowed {
+		t.Fatalf("expected a request to be allowed after refilling one token, got %+v", d)
+	}
+}
+
+func TestLimiterKeysAreIndependent(t *testing.T) {
+	l, _ := newTestLimiter(Policy{Requests: 1, Window: time.Minute})
+
+	if !l.Allow("user:a").Allowed {
+		t.Fatalf("expected the first request for a to be allowed")
+	}
+	if l.Allow("user:a").Allowed {
+		t.Fatalf("expected the second request for a to be limited")
+	}
+	if !l.Allow("user:b").Allowed {
+		t.Fatalf("expected b not to be limited by a's requests")
+	}
+}
+
+func TestLimiterEvictsIdleBuckets(t *testing.T) {
+	l, clock := newTestLimiter(Policy{Requests: 2, Window: time.Minute})
+
+	l.Allow("idle")
+	clock.t = clock.t.Add(30 * time.Second)
+	l.Allow("active")
+	if l.Len() != 2 {
+		t.Fatalf("expected 2 buckets, got %d", l.Len())
+	}
+
+	clock.t = clock.t.Add(45 * time.Second)
+	l.Allow("active")
+	if l.Len() != 1 {
+		t.Fatalf("expected the idle bucket to be evicted, got %d buckets", l.Len())
+	}
+
+	// A key that was evicted starts again with a full bucket.
+	if d := l.Allow("idle"); !d.Allowed || d.Remaining != 1 {
+		t.Fatalf("expected a full bucket after eviction, got %+v", d)
+	}
+}
@@ -0,0 +1,256 @@
+// Package spellcards lays out spells as poker-size cards, nine to a letter
+// page, ready to print and cut out.
+package spellcards
+
+import (
+	"io"
+	"strings"
+
+	"github.com/kblasti/spellbook/internal/pdf"
+)
+
+// Card sizes in points: 2.5 by 3.5 inches.
+const (
+	CardWidth  = 180
+	CardHeight = 252
+)
+
+const (
+	columns     = 3
+	rows        = 3
+	padding     = 9
+	titleSize   = 11
+	minTitle    = 7
+	statSize    = 6.5
+	maxBodySize = 8
+	minBodySize = 4.5
+	footerSize  = 5.5
+	lineSpacing = 1.2
+)
+
+// Card is the text of one spell card.
+type Card struct {
+	Name     string
+	Subtitle string
+	Stats    []Stat
+	Body     []Paragraph
+	Footer   string
+}
+
+// Stat is one labelled line under the card title, such as the range.
+type Stat struct {
+	Label string
+	Value string
+}
+
+// Paragraph is a paragraph of the card body. Lead, if set, is run into the
+// start of the paragraph in bold.
+type Paragraph struct {
+	Lead string
+	Text string
+}
+
+// Render writes cards to w as a PDF, filling each page left to right and
+// top to bottom.
+func Render(w io.Writer, cards []Card) error {
+	doc := pdf.New(pdf.LetterWidth, pdf.LetterHeight)
+	marginX := float64(pdf.LetterWidth-columns*CardWidth) / 2
+	marginY := float64(pdf.LetterHeight-rows*CardHeight) / 2
+
+	var page *pdf.Page
+	for i, card := range cards {
+		slot := i % (columns * rows)
+		if slot == 0 {
+			page = doc.AddPage()
+		}
+		x := marginX + float64(slot%columns*CardWidth)
+		y := marginY + float64(slot/columns*CardHeight)
+		drawCard(page, x, y, card)
+	}
+	if len(cards) == 0 {
+		doc.AddPage()
+	}
+
+	_, err := doc.WriteTo(w)
+	return err
+}
+
+func drawCard(page *pdf.Page, x, y float64, card Card) {
+	page.Rect(x, y, CardWidth, CardHeight, 0.75)
+
+	left := x + padding
+	width := float64(CardWidth - 2*padding)
+	cursor := y + padding
+
+	size := fitSize(card.Name, pdf.HelveticaBold, width, titleSize, minTitle)
+	cursor += size
+	page.Text(pdf.HelveticaBold, size, left, cursor, card.Name)
+
+	if card.Subtitle != "" {
+		cursor += 9
+		page.Text(pdf.HelveticaOblique, 7, left, cursor, card.Subtitle)
+	}
+
+	cursor += 5
+	page.Line(left, cursor, left+width, cursor, 0.5)
+	cursor += 2
+
+	for _, stat := range card.Stats {
+		for _, line := range wrap([]Paragraph{{Lead: stat.Label + ":", Text: stat.Value}}, statSize, width) {
+			cursor += statSize * lineSpacing
+			drawLine(page, left, cursor, statSize, line)
+		}
+	}
+
+	cursor += 4
+	page.Line(left, cursor, left+width, cursor, 0.5)
+	cursor += 2
+
+	bottom := y + CardHeight - padding
+	if card.Footer != "" {
+		page.Text(pdf.HelveticaOblique, footerSize, left, bottom, card.Footer)
+		bottom -= footerSize + 3
+	}
+
+	size, lines := fitBody(card.Body, width, bottom-cursor)
+	for _, line := range lines {
+		cursor += line.gap + size*lineSpacing
+		drawLine(page, left, cursor, size, line)
+	}
+}
+
+// fitSize returns the largest size no bigger than max, and no smaller than
+// min, at which s fits in width.
+func fitSize(s string, font pdf.Font, width, max, min float64) float64 {
+	size := max
+	for size > min && pdf.Width(font, size, s) > width {
+		size -= 0.25
+	}
+	return size
+}
+
+// fitBody finds the largest text size at which paragraphs fit in a box of
+// the given width and height, wrapping them into lines. If they don't fit
+// even at the smallest size, the text is cut short with an ellipsis.
+func fitBody(paragraphs []Paragraph, width, height float64) (float64, []line) {
+	size := float64(maxBodySize)
+	for {
+		lines := wrap(paragraphs, size, width)
+		if linesHeight(lines, size) <= height {
+			return size, lines
+		}
+		if size <= minBodySize {
+			return size, truncate(lines, size, width, height)
+		}
+		size -= 0.25
+	}
+}
+
+func linesHeight(lines []line, size float64) float64 {
+	total := 0.0
+	for _, l := range lines {
+		total += l.gap + size*lineSpacing
+	}
+	return total
+}
+
+// truncate drops the lines that don't fit in height and marks the last one
+// that does with an ellipsis.
+func truncate(lines []line, size, width, height float64) []line {
+	n := 0
+	for n < len(lines) && linesHeight(lines[:n+1], size) <= height {
+		n++
+	}
+	if n == 0 {
+		return nil
+	}
+
+	lines = append([]line(nil), lines[:n]...)
+	last := lines[n-1]
+	last.words = append([]word(nil), last.words...)
+	for len(last.words) > 1 && last.width(size)+pdf.Width(pdf.Helvetica, size, " …") > width {
+		last.words = last.words[:len(last.words)-1]
+	}
+	last.words = append(last.words, word{text: "…", font: pdf.Helvetica})
+	lines[n-1] = last
+	return lines
+}
+
+// word is a run of text without spaces, set in one font.
+type word struct {
+	text string
+	font pdf.Font
+}
+
+// line is one wrapped line. gap is the extra space above it, which is
+// non-zero for the first line of every paragraph but the first.
+type line struct {
+	words []word
+	gap   float64
+}
+
+func (l line) width(size float64) float64 {
+	total := 0.0
+	for i, w := range l.words {
+		if i > 0 {
+			total += pdf.Width(w.font, size, " ")
+		}
+		total += pdf.Width(w.font, size, w.text)
+	}
+	return total
+}
+
+// wrap breaks paragraphs into lines no wider than width at size. A word too
+// long for a line of its own is left to overflow it.
+func wrap(paragraphs []Paragraph, size, width float64) []line {
+	var lines []line
+	for i, p := range paragraphs {
+		var words []word
+		for _, text := range strings.Fields(p.Lead) {
+			words = append(words, word{text: text, font: pdf.HelveticaBold})
+		}
+		for _, text := range strings.Fields(p.Text) {
+			words = append(words, word{text: text, font: pdf.Helvetica})
+		}
+		if len(words) == 0 {
+			continue
+		}
+
+		current := line{}
+		if i > 0 && len(lines) > 0 {
+			current.gap = size * 0.4
+		}
+		for _, w := range words {
+			candidate := line{words: append(current.words[:len(current.words):len(current.words)], w)}
+			if len(current.words) > 0 && candidate.width(size) > width {
+				lines = append(lines, current)
+				current = line{words: []word{w}}
+				continue
+			}
+			current.words = candidate.words
+		}
+		lines = append(lines, current)
+	}
+	return lines
+}
+
+// drawLine sets a wrapped line with its baseline at y, one run of text per
+// change of font.
+func drawLine(page *pdf.Page, x, y, size float64, l line) {
+	start := 0
+	for i := 1; i <= len(l.words); i++ {
+		if i < len(l.words) && l.words[i].font == l.words[start].font {
+			continue
+		}
+
+		font := l.words[start].font
+		texts := make([]string, 0, i-start)
+		for _, w := range l.words[start:i] {
+			texts = append(texts, w.text)
+		}
+		run := strings.Join(texts, " ")
+		page.Text(font, size, x, y, run)
+		x += pdf.Width(font, size, run+" ")
+		start = i
+	}
+}
@@ -0,0 +1,126 @@
+package spellcards
+
+import (
+	"bytes"
+	"strings"
+	"testing"
+
+	"github.com/kblasti/spellbook/internal/pdf"
+)
+
+func lineText(l line) string {
+	texts := make([]string, len(l.words))
+	for i, w := range l.words {
+		texts[i] = w.text
+	}
+	return strings.Join(texts, " ")
+}
+
+func TestWrap(t *testing.T) {
+	paragraphs := []Paragraph{
+		{Lead: "Range:", Text: "150 feet"},
+		{Text: "A bright streak flashes from your pointing finger to a point you choose within range and then blossoms with a low roar into an explosion of flame."},
+	}
+	width := 100.0
+
+	lines := wrap(paragraphs, 8, width)
+	if len(lines) < 3 {
+		t.Fatalf("got %d lines, expected the description to wrap", len(lines))
+	}
+	if got := lineText(lines[0]); got != "Range: 150 feet" {
+		t.Errorf("first line = %q", got)
+	}
+	if lines[0].words[0].font != pdf.HelveticaBold || lines[0].words[1].font != pdf.Helvetica {
+		t.Error("lead should be bold and text regular")
+	}
+	if lines[0].gap != 0 || lines[1].gap == 0 || lines[2].gap != 0 {
+		t.Errorf("gaps = %v %v %v, want a gap before the second paragraph only", lines[0].gap, lines[1].gap, lines[2].gap)
+	}
+
+	var words []string
+	for _, l := range lines[1:] {
+		if l.width(8) > width {
+			t.Errorf("line %q is %v wide, more than %v", lineText(l), l.width(8), width)
+		}
+		words = append(words, lineText(l))
+	}
+	if strings.Join(words, " ") != paragraphs[1].Text {
+		t.Error("wrapping lost or reordered words")
+	}
+}
+
+func TestFitSize(t *testing.T) {
+	if size := fitSize("Shield", pdf.HelveticaBold, 162, titleSize, minTitle); size != titleSize {
+		t.Errorf("short title shrunk to %v", size)
+	}
+	long := "Tenser's Transformation of the Extraordinarily Long Name"
+	size := fitSize(long, pdf.HelveticaBold, 162, titleSize, minTitle)
+	if size >= titleSize || size < minTitle {
+		t.Errorf("long title size = %v", size)
+	}
+	if size > minTitle && pdf.Width(pdf.HelveticaBold, size, long) > 162 {
+		t.Errorf("long title still overflows at %v", size)
+	}
+}
+
+func TestFitBody(t *testing.T) {
+	short := []Paragraph{{Text: "You create a shimmering barrier."}}
+	size, lines := fitBody(short, 162, 150)
+	if size != maxBodySize || len(lines) != 1 {
+		t.Errorf("short body = size %v, %d lines", size, len(lines))
+	}
+
+	long := []Paragraph{{Text: strings.Repeat("The target must make a Wisdom saving throw. ", 40)}}
+	size, lines = fitBody(long, 162, 150)
+	if size >= maxBodySize {
+		t.Errorf("long body wasn't shrunk, size %v", size)
+	}
+	if h := linesHeight(lines, size); h > 150 {
+		t.Errorf("long body is %v high, more than 150", h)
+	}
+
+	huge := []Paragraph{{Text: strings.Repeat("The target must make a Wisdom saving throw. ", 200)}}
+	size, lines = fitBody(huge, 162, 150)
+	if size != minBodySize {
+		t.Errorf("huge body size = %v, want %v", size, float64(minBodySize))
+	}
+	if h := linesHeight(lines, size); h > 150 {
+		t.Errorf("huge body is %v high, more than 150", h)
+	}
+	last := lines[len(lines)-1]
+	if last.words[len(last.words)-1].text != "…" {
+		t.Errorf("truncated body should end with an ellipsis, ends %q", lineText(last))
+	}
+	if last.width(size) > 162 {
+		t.Errorf("last line is %v wide", last.width(size))
+	}
+}
+
+func TestRender(t *testing.T) {
+	cards := make([]Card, 10)
+	for i := range cards {
+		cards[i] = Card{
+			Name:     "Magic Missile",
+			Subtitle: "1st-level Evocation",
+			Stats:    []Stat{{Label: "Range", Value: "120 feet"}},
+			Body:     []Paragraph{{Text: "You create three glowing darts of magical force."}},
+			Footer:   "Elminster",
+		}
+	}
+
+	var buf bytes.Buffer
+	if err := Render(&buf, cards); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "/Count 2") {
+		t.Error("ten cards should take two pages")
+	}
+
+	buf.Reset()
+	if err := Render(&buf, nil); err != nil {
+		t.Fatal(err)
+	}
+	if !strings.Contains(buf.String(), "/Count 1") {
+		t.Error("no cards should still make a valid one page document")
+	}
+}
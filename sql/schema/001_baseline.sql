@@ -0,0 +1,101 @@
+-- +goose Up
+-- The schema the first deployments were created with by hand. Everything is
+-- IF NOT EXISTS so databases that predate migrations can adopt them.
+CREATE TABLE IF NOT EXISTS users (
+    id UUID PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    email TEXT NOT NULL UNIQUE,
+    hashed_password TEXT NOT NULL DEFAULT 'unset',
+    "role" TEXT NOT NULL DEFAULT 'user'
+);
+
+CREATE TABLE IF NOT EXISTS refresh_tokens (
+    token TEXT PRIMARY KEY,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID REFERENCES users(id) ON DELETE CASCADE,
+    expires_at TIMESTAMP NOT NULL,
+    revoked_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS classes (
+    id SERIAL PRIMARY KEY,
+    "index" TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    url TEXT
+);
+
+CREATE TABLE IF NOT EXISTS subclasses (
+    id SERIAL PRIMARY KEY,
+    "index" TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    url TEXT
+);
+
+CREATE TABLE IF NOT EXISTS spells (
+    id SERIAL PRIMARY KEY,
+    "index" TEXT NOT NULL UNIQUE,
+    name TEXT NOT NULL,
+    range TEXT,
+    material TEXT,
+    ritual BOOLEAN,
+    duration TEXT,
+    concentration BOOLEAN,
+    casting_time TEXT,
+    "level" INTEGER,
+    attack_type TEXT,
+    school JSONB,
+    "desc" TEXT[],
+    higher_level TEXT[],
+    components TEXT[],
+    damage JSONB,
+    url TEXT NOT NULL,
+    updated_at TIMESTAMP
+);
+
+CREATE TABLE IF NOT EXISTS spell_classes (
+    spell_id INTEGER NOT NULL REFERENCES spells(id) ON DELETE CASCADE,
+    class_id INTEGER NOT NULL REFERENCES classes(id) ON DELETE CASCADE,
+    PRIMARY KEY (spell_id, class_id)
+);
+
+CREATE TABLE IF NOT EXISTS spell_subclasses (
+    spell_id INTEGER NOT NULL REFERENCES spells(id) ON DELETE CASCADE,
+    subclass_id INTEGER NOT NULL REFERENCES subclasses(id) ON DELETE CASCADE,
+    PRIMARY KEY (spell_id, subclass_id)
+);
+
+CREATE TABLE IF NOT EXISTS spell_slots (
+    caster_type TEXT NOT NULL,
+    caster_level INTEGER NOT NULL,
+    slots JSONB NOT NULL,
+    PRIMARY KEY (caster_type, caster_level)
+);
+
+CREATE TABLE IF NOT EXISTS characters (
+    id UUID PRIMARY KEY,
+    name TEXT NOT NULL,
+    class_levels JSONB NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    updated_at TIMESTAMP NOT NULL,
+    user_id UUID NOT NULL REFERENCES users(id) ON DELETE CASCADE
+);
+
+CREATE TABLE IF NOT EXISTS characters_spells (
+    spell_id INTEGER NOT NULL REFERENCES spells(id) ON DELETE CASCADE,
+    char_id UUID NOT NULL REFERENCES characters(id) ON DELETE CASCADE,
+    PRIMARY KEY (spell_id, char_id)
+);
+
+-- +goose Down
+DROP TABLE characters_spells;
+DROP TABLE characters;
+DROP TABLE spell_slots;
+DROP TABLE spell_subclasses;
+DROP TABLE spell_classes;
+DROP TABLE spells;
+DROP TABLE subclasses;
+DROP TABLE classes;
+DROP TABLE refresh_tokens;
+DROP TABLE users;
@@ -0,0 +1,26 @@
+-- +goose Up
+CREATE EXTENSION IF NOT EXISTS pg_trgm;
+
+-- +goose StatementBegin
+CREATE FUNCTION spells_search_vector(name TEXT, description TEXT[], higher_level TEXT[])
+RETURNS tsvector
+LANGUAGE sql IMMUTABLE
+AS $$
+    SELECT setweight(to_tsvector('english', COALESCE(name, '')), 'A') ||
+           setweight(to_tsvector('english', COALESCE(array_to_string(description, ' '), '')), 'B') ||
+           setweight(to_tsvector('english', COALESCE(array_to_string(higher_level, ' '), '')), 'C')
+$$;
+-- +goose StatementEnd
+
+ALTER TABLE spells
+ADD COLUMN search_vector tsvector
+GENERATED ALWAYS AS (spells_search_vector(name, "desc", higher_level)) STORED;
+
+CREATE INDEX spells_search_vector_idx ON spells USING GIN (search_vector);
+CREATE INDEX spells_name_trgm_idx ON spells USING GIN (name gin_trgm_ops);
+
+-- +goose Down
+DROP INDEX IF EXISTS spells_name_trgm_idx;
+DROP INDEX IF EXISTS spells_search_vector_idx;
+ALTER TABLE spells DROP COLUMN IF EXISTS search_vector;
+DROP FUNCTION IF EXISTS spells_search_vector(TEXT, TEXT[], TEXT[]);
@@ -0,0 +1,12 @@
+-- +goose Up
+ALTER TABLE refresh_tokens
+ADD COLUMN user_agent TEXT,
+ADD COLUMN ip_address TEXT;
+
+CREATE INDEX refresh_tokens_user_id_idx ON refresh_tokens (user_id);
+
+-- +goose Down
+DROP INDEX IF EXISTS refresh_tokens_user_id_idx;
+ALTER TABLE refresh_tokens
+DROP COLUMN IF EXISTS ip_address,
+DROP COLUMN IF EXISTS user_agent;
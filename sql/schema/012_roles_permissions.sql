@@ -0,0 +1,43 @@
+-- +goose Up
+CREATE TABLE roles (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE permissions (
+    name TEXT PRIMARY KEY,
+    description TEXT NOT NULL DEFAULT ''
+);
+
+CREATE TABLE role_permissions (
+    role TEXT NOT NULL REFERENCES roles(name) ON DELETE CASCADE,
+    permission TEXT NOT NULL REFERENCES permissions(name) ON DELETE CASCADE,
+    PRIMARY KEY (role, permission)
+);
+
+INSERT INTO roles (name, description) VALUES
+    ('user', 'Manages their own characters'),
+    ('editor', 'Edits the spell compendium'),
+    ('moderator', 'Reviews homebrew submissions'),
+    ('admin', 'Full access');
+
+INSERT INTO permissions (name, description) VALUES
+    ('spells:edit', 'Create, update and delete spells'),
+    ('homebrew:review', 'Approve or reject homebrew submissions'),
+    ('users:manage', 'Manage user accounts and roles');
+
+INSERT INTO role_permissions (role, permission) VALUES
+    ('editor', 'spells:edit'),
+    ('moderator', 'homebrew:review'),
+    ('admin', 'spells:edit'),
+    ('admin', 'homebrew:review'),
+    ('admin', 'users:manage');
+
+ALTER TABLE users
+    ADD CONSTRAINT users_role_fkey FOREIGN KEY ("role") REFERENCES roles(name);
+
+-- +goose Down
+ALTER TABLE users DROP CONSTRAINT users_role_fkey;
+DROP TABLE role_permissions;
+DROP TABLE permissions;
+DROP TABLE roles;
@@ -0,0 +1,50 @@
+-- +goose Up
+-- editor_id deliberately has no foreign key: revisions are immutable, so
+-- they keep the editor's ID even after the account is deleted.
+CREATE TABLE spell_revisions (
+    id UUID PRIMARY KEY,
+    spell_index TEXT NOT NULL,
+    revision INTEGER NOT NULL,
+    created_at TIMESTAMP NOT NULL,
+    editor_id UUID,
+    action TEXT NOT NULL,
+    snapshot JSONB NOT NULL,
+    UNIQUE (spell_index, revision)
+);
+
+-- +goose StatementBegin
+CREATE FUNCTION spell_revisions_immutable() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'spell revisions are immutable';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER spell_revisions_immutable
+    BEFORE UPDATE OR DELETE ON spell_revisions
+    FOR EACH ROW EXECUTE FUNCTION spell_revisions_immutable();
+
+-- Existing spells start their history with the text they were imported with.
+INSERT INTO spell_revisions (id, spell_index, revision, created_at, editor_id, action, snapshot)
+SELECT gen_random_uuid(), "index", 1, COALESCE(updated_at, NOW()), NULL, 'import', jsonb_build_object(
+    'index', "index",
+    'name', name,
+    'range', COALESCE(range, ''),
+    'material', COALESCE(material, ''),
+    'ritual', COALESCE(ritual, false),
+    'duration', COALESCE(duration, ''),
+    'concentration', COALESCE(concentration, false),
+    'casting_time', COALESCE(casting_time, ''),
+    'level', COALESCE("level", 0),
+    'attack_type', COALESCE(attack_type, ''),
+    'school', school,
+    'desc', to_jsonb("desc"),
+    'higher_level', to_jsonb(higher_level),
+    'components', to_jsonb(components),
+    'damage', damage
+)
+FROM spells;
+
+-- +goose Down
+DROP TABLE spell_revisions;
+DROP FUNCTION spell_revisions_immutable();
@@ -0,0 +1,38 @@
+-- +goose Up
+ALTER TABLE audit_log
+    ADD COLUMN request_id TEXT,
+    ADD COLUMN "before" JSONB,
+    ADD COLUMN "after" JSONB;
+
+-- The log is append-only, so entries keep their actor's ID after the
+-- account is deleted instead of being updated to NULL.
+ALTER TABLE audit_log DROP CONSTRAINT audit_log_actor_id_fkey;
+
+-- +goose StatementBegin
+CREATE FUNCTION audit_log_append_only() RETURNS trigger AS $$
+BEGIN
+    RAISE EXCEPTION 'the audit log is append-only';
+END;
+$$ LANGUAGE plpgsql;
+-- +goose StatementEnd
+
+CREATE TRIGGER audit_log_append_only
+    BEFORE UPDATE OR DELETE ON audit_log
+    FOR EACH ROW EXECUTE FUNCTION audit_log_append_only();
+
+CREATE INDEX audit_log_actor_id_idx ON audit_log (actor_id, created_at);
+CREATE INDEX audit_log_action_idx ON audit_log (action, created_at);
+
+-- +goose Down
+DROP INDEX audit_log_action_idx;
+DROP INDEX audit_log_actor_id_idx;
+DROP TRIGGER audit_log_append_only ON audit_log;
+DROP FUNCTION audit_log_append_only();
+UPDATE audit_log SET actor_id = NULL
+WHERE actor_id IS NOT NULL AND actor_id NOT IN (SELECT id FROM users);
+ALTER TABLE audit_log
+    ADD CONSTRAINT audit_log_actor_id_fkey FOREIGN KEY (actor_id) REFERENCES users(id) ON DELETE SET NULL;
+ALTER TABLE audit_log
+    DROP COLUMN "after",
+    DROP COLUMN "before",
+    DROP COLUMN request_id;
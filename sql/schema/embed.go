@@ -0,0 +1,8 @@
+// Package schema embeds the database migrations so the binaries can apply
+// them without the SQL files on disk.
+package schema
+
+import "embed"
+
+//go:embed *.sql
+var FS embed.FS